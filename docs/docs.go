@@ -19,19 +19,641 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/archive": {
+            "get": {
+                "description": "Export all credentials and presentations of the account with their metadata as archive. In remote mode the archive is returned as JWE encrypted for the device key with the receipt of the renewed nonce, in direct mode as JSON or, with Accept application/x-ndjson, as one item per line.",
+                "produces": [
+                    "application/json",
+                    "application/x-ndjson",
+                    "application/jose"
+                ],
+                "tags": [
+                    "archive"
+                ],
+                "summary": "Export all credentials and presentations of the account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "archive",
+                        "schema": {
+                            "$ref": "#/definitions/model.ArchiveModel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Import the items of an archive as exported, as JSON object or with content type application/x-ndjson as one item per line. In remote mode the archive is the decrypted export, its items must be JWEs like on PUT. The items are validated and stored like on PUT, the result reports the outcome of each item. In remote mode the nonce is renewed once per import and the result carries its receipt. Archives above 64 MiB or with more than 10000 items are refused with 413.",
+                "consumes": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "archive"
+                ],
+                "summary": "Import an archive into the account",
+                "parameters": [
+                    {
+                        "description": "archive",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.ArchiveModel"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Handling of existing ids: skip (default), overwrite or rename",
+                        "name": "conflict",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "result per item",
+                        "schema": {
+                            "$ref": "#/definitions/model.ImportResultModel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Archive too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/credentials": {
+            "get": {
+                "description": "List the credentials of the account ordered by id. In remote mode the response contains a receipt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "credentials"
+                ],
+                "summary": "List credentials page by page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of credentials, 0 returns all",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this credential type, requires the metadata index",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this issuer, requires the metadata index",
+                        "name": "issuer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this format, requires the metadata index",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this verifiable credential type, requires the metadata index",
+                        "name": "vct",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return expired items too, flagged in expired",
+                        "name": "includeExpired",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "credentials",
+                        "schema": {
+                            "$ref": "#/definitions/model.GetCredentialModel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Get credentials from the storage. A DCQL query is accepted as application/dcql+json body or as dcql_query member, its matches are grouped by credential query id. Other content types are rejected, credentials are created by POST on /credentials/create.",
+                "consumes": [
+                    "application/json",
+                    "application/dcql+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "credentials"
+                ],
+                "summary": "Get credentials from the storage",
+                "parameters": [
+                    {
+                        "description": "Presentation definition details",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/presentation.PresentationDefinition"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this credential type, requires the metadata index",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this issuer, requires the metadata index",
+                        "name": "issuer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this format, requires the metadata index",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this verifiable credential type, requires the metadata index",
+                        "name": "vct",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return expired items too, flagged in expired",
+                        "name": "includeExpired",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "credentials",
+                        "schema": {
+                            "$ref": "#/definitions/model.GetCredentialModel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/credentials/create": {
+            "post": {
+                "description": "Store a credential like on PUT under an id derived from its id or jti, or a generated one. In direct mode POST on the collection is the query route, so credentials are created on this route, in remote mode by POST on the collection.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "credentials"
+                ],
+                "summary": "Create a credential with an id chosen by the service",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "The VerifiableCredential raw data to upload",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "id of the stored credential",
+                        "schema": {
+                            "$ref": "#/definitions/model.CreatedModel"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the stored item"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "Path of the stored credential"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request, e.g. an unsupported or malformed format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/credentials/{id}": {
+            "get": {
+                "description": "Get a single credential from the storage. In remote mode the response contains a receipt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "credentials"
+                ],
+                "summary": "Get a single credential from the storage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the credential",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "credential",
+                        "schema": {
+                            "$ref": "#/definitions/model.GetCredentialItemModel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Add a credential to the storage. In direct mode the format is detected and validated, supported are W3C JSON-LD, VC-JWT, JWT VP, SD-JWT VC and mdoc.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "credentials"
+                ],
+                "summary": "Add a credential to the storage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "The VerifiableCredential raw data to upload",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the credential",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity tag of the expected version, or * for an existing item",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "* stores only a new item",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the stored item"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request, e.g. an unsupported or malformed format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict, the item exists already",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed, the version does not match",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/presentations": {
+            "get": {
+                "description": "List the presentations of the account ordered by id. In remote mode the response contains a receipt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "presentations"
+                ],
+                "summary": "List presentations page by page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of presentations, 0 returns all",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this credential type, requires the metadata index",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this issuer, requires the metadata index",
+                        "name": "issuer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this format, requires the metadata index",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this verifiable credential type, requires the metadata index",
+                        "name": "vct",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return expired items too, flagged in expired",
+                        "name": "includeExpired",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "presentations",
+                        "schema": {
+                            "$ref": "#/definitions/model.GetCredentialModel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "Get credentials from the storage",
+                "description": "Add a presentation to the storage. A DCQL query is accepted as application/dcql+json body or as dcql_query member, its matches are grouped by credential query id. Other content types are rejected, presentations are created by POST on /presentations/create.",
                 "consumes": [
-                    "application/json"
+                    "application/json",
+                    "application/dcql+json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "credentials"
+                    "presentations"
                 ],
-                "summary": "Get credentials from the storage",
+                "summary": "Add a presentation to the storage",
                 "parameters": [
                     {
                         "description": "Presentation definition details",
@@ -41,6 +663,36 @@ const docTemplate = `{
                             "$ref": "#/definitions/presentation.PresentationDefinition"
                         }
                     },
+                    {
+                        "type": "string",
+                        "description": "Only items of this credential type, requires the metadata index",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this issuer, requires the metadata index",
+                        "name": "issuer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this format, requires the metadata index",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only items of this verifiable credential type, requires the metadata index",
+                        "name": "vct",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return expired items too, flagged in expired",
+                        "name": "includeExpired",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "Account ID",
@@ -58,7 +710,7 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "credentials",
+                        "description": "presentations",
                         "schema": {
                             "$ref": "#/definitions/model.GetCredentialModel"
                         }
@@ -78,16 +730,19 @@ const docTemplate = `{
                 }
             }
         },
-        "/credentials/{id}": {
-            "put": {
-                "description": "Add a credential to the storage",
+        "/presentations/create": {
+            "post": {
+                "description": "Store a presentation like on PUT under an id derived from its id or jti, or a generated one. In direct mode POST on the collection is the query route, so presentations are created on this route, in remote mode by POST on the collection.",
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "credentials"
+                    "presentations"
                 ],
-                "summary": "Add a credential to the storage",
+                "summary": "Create a presentation with an id chosen by the service",
                 "parameters": [
                     {
                         "type": "string",
@@ -97,7 +752,7 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "The VerifiableCredential raw data to upload",
+                        "description": "The presentation raw data to upload",
                         "name": "data",
                         "in": "body",
                         "required": true,
@@ -118,24 +773,27 @@ const docTemplate = `{
                         "name": "tenantId",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "ID of the credential",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "id of the stored presentation",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/model.CreatedModel"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the stored item"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "Path of the stored presentation"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Bad Request, e.g. an unsupported or malformed format",
                         "schema": {
                             "type": "string"
                         }
@@ -149,27 +807,23 @@ const docTemplate = `{
                 }
             }
         },
-        "/presentations": {
-            "post": {
-                "description": "Add a presentation to the storage",
-                "consumes": [
-                    "application/json"
-                ],
+        "/presentations/{id}": {
+            "get": {
+                "description": "Get a single presentation from the storage. In remote mode the response contains a receipt.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "presentations"
                 ],
-                "summary": "Add a presentation to the storage",
+                "summary": "Get a single presentation from the storage",
                 "parameters": [
                     {
-                        "description": "Presentation definition details",
-                        "name": "request",
-                        "in": "body",
-                        "schema": {
-                            "$ref": "#/definitions/presentation.PresentationDefinition"
-                        }
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
                     },
                     {
                         "type": "string",
@@ -184,13 +838,20 @@ const docTemplate = `{
                         "name": "tenantId",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the presentation",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "presentations",
+                        "description": "presentation",
                         "schema": {
-                            "$ref": "#/definitions/model.GetCredentialModel"
+                            "$ref": "#/definitions/model.GetCredentialItemModel"
                         }
                     },
                     "400": {
@@ -199,18 +860,16 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
-            }
-        },
-        "/presentations/{id}": {
+            },
             "put": {
-                "description": "Add a presentation to the storage",
+                "description": "Add a presentation to the storage. In direct mode the format is detected and validated, supported are W3C JSON-LD, VC-JWT, JWT VP, SD-JWT VC and mdoc.",
                 "consumes": [
                     "application/json"
                 ],
@@ -255,6 +914,18 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity tag of the expected version, or * for an existing item",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "* stores only a new item",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -262,10 +933,28 @@ const docTemplate = `{
                         "description": "Receipt",
                         "schema": {
                             "type": "string"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the stored item"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Bad Request, e.g. an unsupported or malformed format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict, the item exists already",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed, the version does not match",
                         "schema": {
                             "type": "string"
                         }
@@ -281,6 +970,104 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "dcql.Result": {
+            "type": "object",
+            "properties": {
+                "credentials": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/presentation.CredentialResult"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.ArchiveItem": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "expiry": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "issuer": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "updated": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.ArchiveModel": {
+            "type": "object",
+            "properties": {
+                "exported": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ArchiveItem"
+                    }
+                },
+                "receipt": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.CreatedModel": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.GetCredentialItemModel": {
+            "type": "object",
+            "properties": {
+                "credential": {},
+                "expired": {
+                    "type": "boolean"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "receipt": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
         "model.GetCredentialModel": {
             "type": "object",
             "properties": {
@@ -288,12 +1075,76 @@ const docTemplate = `{
                     "type": "object",
                     "additionalProperties": true
                 },
+                "expired": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "formats": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "groups": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/presentation.FilterResult"
                     }
                 },
+                "matches": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dcql.Result"
+                    }
+                },
+                "next": {
+                    "type": "string"
+                },
+                "receipt": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "model.ImportItemResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "storedId": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.ImportResultModel": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ImportItemResult"
+                    }
+                },
                 "receipt": {
                     "type": "string"
                 }
@@ -332,6 +1183,15 @@ const docTemplate = `{
                 }
             }
         },
+        "presentation.CredentialResult": {
+            "type": "object",
+            "properties": {
+                "data": {},
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
         "presentation.Description": {
             "type": "object",
             "properties": {
@@ -408,7 +1268,9 @@ const docTemplate = `{
             "properties": {
                 "credentials": {
                     "type": "object",
-                    "additionalProperties": true
+                    "additionalProperties": {
+                        "$ref": "#/definitions/presentation.CredentialResult"
+                    }
                 },
                 "description": {
                     "$ref": "#/definitions/presentation.Description"
@@ -569,6 +1431,8 @@ var SwaggerInfo = &swag.Spec{
 	Description:      "Service responsible for storing and retrieving credentials and presentations",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
+	LeftDelim:        "{{",
+	RightDelim:       "}}",
 }
 
 func init() {
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/admin"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+func AddTenantRoutes(g *gin.RouterGroup, env *common.Environment, replication repository.Replication) {
+	g.POST("", func(c *gin.Context) {
+		handlers.CreateTenant(c, env, replication)
+	})
+
+	g.GET("", func(c *gin.Context) {
+		handlers.ListTenants(c, env)
+	})
+
+	g.GET("/:name", func(c *gin.Context) {
+		handlers.GetTenant(c, env, c.Param("name"), 200)
+	})
+
+	g.DELETE("/:name", func(c *gin.Context) {
+		handlers.DeleteTenant(c, env, c.Param("name"))
+	})
+}
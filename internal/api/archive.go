@@ -0,0 +1,12 @@
+package api
+
+import (
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/credentials"
+	"github.com/gin-gonic/gin"
+)
+
+func AddArchiveRoutes(g *gin.RouterGroup, env *common.Environment) {
+	handlers.Export(g, env)
+	handlers.Import(g, env)
+}
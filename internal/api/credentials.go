@@ -6,7 +6,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AddCredentialRoutes(g *gin.RouterGroup, env *common.Environment) {
+// AddCredentialRoutes mounts the routes of the content type, the DIRECT ones for JSON and the REMOTE ones for JOSE.
+func AddCredentialRoutes(g *gin.RouterGroup, env *common.Environment, contentType string) {
 	g.PUT("/:id", func(c *gin.Context) {
 		handlers.AddCredential(c, env)
 	})
@@ -15,17 +16,23 @@ func AddCredentialRoutes(g *gin.RouterGroup, env *common.Environment) {
 		handlers.Remove(c, env, false)
 	})
 
-	if env.GetContentType() == common.EncryptedContentType {
-		g.GET("", func(c *gin.Context) {
-			handlers.Get(c, env, false)
-		})
-	}
+	handlers.ListCredentials(g, env)
+	handlers.GetCredential(g, env)
 
-	if env.GetContentType() == common.NormalContentType {
+	if contentType == common.NormalContentType {
+		// POST on the collection queries, so items are created on their own route
 		handlers.GetCredentials(g, env)
 
+		g.POST(handlers.CreatePath, func(c *gin.Context) {
+			handlers.CreateCredential(c, env)
+		})
+
 		g.POST("/chain", func(c *gin.Context) {
 			handlers.Chain(c, env)
 		})
+	} else {
+		g.POST("", func(c *gin.Context) {
+			handlers.CreateCredential(c, env)
+		})
 	}
 }
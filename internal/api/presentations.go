@@ -7,7 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AddPresentationRoutes(g *gin.RouterGroup, env *common.Environment) {
+// AddPresentationRoutes mounts the routes of the content type, the DIRECT ones for JSON and the REMOTE ones for JOSE.
+func AddPresentationRoutes(g *gin.RouterGroup, env *common.Environment, contentType string) {
 	g.PUT("/:id", func(c *gin.Context) {
 		handlers.AddPresentation(c, env)
 	})
@@ -16,13 +17,19 @@ func AddPresentationRoutes(g *gin.RouterGroup, env *common.Environment) {
 		handlers.Remove(c, env, true)
 	})
 
-	if env.GetContentType() == common.EncryptedContentType {
-		g.GET("", func(c *gin.Context) {
-			handlers.Get(c, env, true)
-		})
-	}
+	handlers.ListPresentations(g, env)
+	handlers.GetPresentation(g, env)
 
-	if env.GetContentType() == common.NormalContentType {
+	if contentType == common.NormalContentType {
+		// POST on the collection queries, so items are created on their own route
 		handlers.GetPresentations(g, env)
+
+		g.POST(handlers.CreatePath, func(c *gin.Context) {
+			handlers.CreatePresentation(c, env)
+		})
+	} else {
+		g.POST("", func(c *gin.Context) {
+			handlers.CreatePresentation(c, env)
+		})
 	}
 }
@@ -29,4 +29,22 @@ func AddRemoteRoutes(g *gin.RouterGroup, env *common.Environment) {
 	g.DELETE("/delete", func(c *gin.Context) {
 		handlers.DeleteDevice(c, env)
 	})
+
+	g.DELETE("/account", func(c *gin.Context) {
+		handlers.DeleteAccount(c, env)
+	})
+}
+
+func AddDeviceRoutes(g *gin.RouterGroup, env *common.Environment) {
+	g.GET("", func(c *gin.Context) {
+		handlers.ListDevices(c, env)
+	})
+
+	g.POST("", func(c *gin.Context) {
+		handlers.AddAccountDevice(c, env)
+	})
+
+	g.DELETE("/:deviceId", func(c *gin.Context) {
+		handlers.RevokeDevice(c, env)
+	})
 }
@@ -6,6 +6,9 @@ const (
 
 	EncryptedContentType = "application/jose"
 	NormalContentType    = "application/json"
+	DcqlContentType      = "application/dcql+json"
 
 	BasePath = "/storage/{account}"
+
+	EventSource = "storage-service"
 )
@@ -5,6 +5,12 @@ import (
 	"github.com/eclipse-xfsc/credential-storage-service/internal/config"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/connection"
 	cryptoProvider "github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/lifecycle"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/status"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	logPkg "github.com/eclipse-xfsc/microservice-core-go/pkg/logr"
@@ -14,11 +20,17 @@ import (
 
 type Environment struct {
 	session         connection.SessionInterface
+	repository      repository.Repository
+	indexer         *metadata.Indexer
+	statusChecker   *status.Checker
+	publisher       *lifecycle.Publisher
+	tenantResolver  *tenancy.Resolver
+	overrides       *tenancy.Overrides
 	mode            string
 	cryptoNamespace string
 	signKey         string
+	endToEnd        bool
 	unitTestModeOn  bool
-	contentType     string
 	logger          logPkg.Logger
 	isHealthy       bool
 }
@@ -35,22 +47,93 @@ func GetEnvironment() *Environment {
 
 func (e *Environment) SetSession(session connection.SessionInterface) {
 	e.session = session
+	e.repository = repository.NewCassandraRepository(session)
 }
 
 func (e *Environment) GetSession() connection.SessionInterface {
 	return e.session
 }
 
+func (e *Environment) SetRepository(repository repository.Repository) {
+	e.repository = repository
+}
+
+func (e *Environment) GetRepository() repository.Repository {
+	return e.repository
+}
+
+func (e *Environment) SetIndexer(indexer *metadata.Indexer) {
+	e.indexer = indexer
+}
+
+// GetIndexer returns the metadata indexer, nil when metadata indexing is not configured.
+func (e *Environment) GetIndexer() *metadata.Indexer {
+	return e.indexer
+}
+
+func (e *Environment) SetStatusChecker(checker *status.Checker) {
+	e.statusChecker = checker
+}
+
+// GetStatusChecker returns the status list checker, nil when status checking is not enabled.
+func (e *Environment) GetStatusChecker() *status.Checker {
+	return e.statusChecker
+}
+
+func (e *Environment) SetPublisher(publisher *lifecycle.Publisher) {
+	e.publisher = publisher
+}
+
+// GetPublisher returns the publisher of lifecycle events, nil when no lifecycle topic is configured.
+func (e *Environment) GetPublisher() *lifecycle.Publisher {
+	return e.publisher
+}
+
+func (e *Environment) SetTenantResolver(resolver *tenancy.Resolver) {
+	e.tenantResolver = resolver
+}
+
+// GetTenantResolver returns the allow-list of tenants, nil only in tests.
+func (e *Environment) GetTenantResolver() *tenancy.Resolver {
+	return e.tenantResolver
+}
+
+func (e *Environment) SetTenantOverrides(overrides *tenancy.Overrides) {
+	e.overrides = overrides
+}
+
+// GetTenantOverrides returns the settings of tenants, nil when no settings file is configured.
+func (e *Environment) GetTenantOverrides() *tenancy.Overrides {
+	return e.overrides
+}
+
+func (e *Environment) GetAccountKey(authModel model.AuthModel) repository.AccountKey {
+	keyspace := authModel.Keyspace
+	if keyspace == "" {
+		// models built in tests address the keyspace by the tenant id
+		keyspace = authModel.TenantId
+	}
+
+	return repository.AccountKey{
+		Tenant:    keyspace,
+		Partition: e.GetAccountPartition(authModel.Account),
+		Region:    e.GetRegion(authModel.TenantId),
+		Country:   e.GetCountry(authModel.TenantId),
+		Account:   authModel.Account,
+	}
+}
+
 func (e *Environment) GetCryptoProvider() types.CryptoProvider {
 	return cryptoProvider.GetCryptoProvider()
 }
 
-func (e *Environment) GetRegion() string {
-	return config.CurrentStorageConfig.Region
+// GetRegion returns the region of the tenant, the global one when the tenant does not override it.
+func (e *Environment) GetRegion(tenantId string) string {
+	return override(e.overrides.Get(tenantId).Region, config.CurrentStorageConfig.Region)
 }
 
-func (e *Environment) GetCountry() string {
-	return config.CurrentStorageConfig.Country
+func (e *Environment) GetCountry(tenantId string) string {
+	return override(e.overrides.Get(tenantId).Country, config.CurrentStorageConfig.Country)
 }
 
 func (e *Environment) GetAccountPartition(account string) string {
@@ -64,24 +147,28 @@ func (e *Environment) SetCryptoNamespace(namespace string) {
 	e.cryptoNamespace = namespace
 }
 
-func (e *Environment) GetCryptoNamespace() string {
-	return e.cryptoNamespace
+func (e *Environment) GetCryptoNamespace(tenantId string) string {
+	return override(e.overrides.Get(tenantId).CryptoNamespace, e.cryptoNamespace)
 }
 
-func (e *Environment) SetContentType(contentType string) {
-	e.contentType = contentType
+func (e *Environment) SetCryptoSignKey(signKey string) {
+	e.signKey = signKey
 }
 
-func (e *Environment) GetContentType() string {
-	return e.contentType
+func (e *Environment) GetCryptoSignKey(tenantId string) string {
+	return override(e.overrides.Get(tenantId).SignKey, e.signKey)
 }
 
-func (e *Environment) SetCryptoSignKey(signKey string) {
-	e.signKey = signKey
+func (e *Environment) SetEndToEnd(endToEnd bool) {
+	e.endToEnd = endToEnd
 }
 
-func (e *Environment) GetCryptoSignKey() string {
-	return e.signKey
+// IsEndToEnd reports whether the REMOTE items of the tenant are stored as the device encrypted them.
+func (e *Environment) IsEndToEnd(tenantId string) bool {
+	if endToEnd := e.overrides.Get(tenantId).EndToEnd; endToEnd != nil {
+		return *endToEnd
+	}
+	return e.endToEnd
 }
 
 func (e *Environment) SetMode(mode string) {
@@ -92,6 +179,18 @@ func (e *Environment) GetMode() string {
 	return e.mode
 }
 
+// IsModeEnabled reports whether the tenant may use the mode, all modes are enabled for tenants without overrides.
+func (e *Environment) IsModeEnabled(tenantId string, mode string) bool {
+	return e.overrides.Get(tenantId).ModeEnabled(mode)
+}
+
+func override(value string, global string) string {
+	if value == "" {
+		return global
+	}
+	return value
+}
+
 func (e *Environment) SetUnitTestModeOn(mode bool) {
 	e.unitTestModeOn = mode
 }
@@ -111,7 +210,7 @@ func (e *Environment) SetHealthy(isHealthy bool) {
 }
 
 func (e *Environment) IsHealthy() bool {
-	return !e.session.Closed()
+	return e.repository != nil && !e.repository.Closed()
 }
 
 func (env *Environment) SetSwaggerBasePath(path string) {
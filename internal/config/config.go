@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	configPkg "github.com/eclipse-xfsc/microservice-core-go/pkg/config"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -8,22 +10,44 @@ import (
 type storageConfiguration struct {
 	configPkg.BaseConfig `mapstructure:",squash"`
 	Profile              string `mapstructure:"profile" envconfig:"STORAGESERVICE_PROFILE" default:"DEBUG:LOCAL"`
-	Mode                 string `mapstructure:"mode" envconfig:"STORAGESERVICE_MODE" default:"DIRECT"`
-	UnitTestModeOn       bool   `mapstructure:"unitTestModeOn" envconfig:"STORAGESERVICE_UNITTESTMODEON" default:"false"`
-	Country              string `mapstructure:"country" envconfig:"STORAGESERVICE_COUNTRY"`
-	Region               string `mapstructure:"region" envconfig:"STORAGESERVICE_REGION"`
+	// Mode is DIRECT, REMOTE or DIRECT,REMOTE to serve both, then the REMOTE routes are served on the RemoteListenPort.
+	Mode             string `mapstructure:"mode" envconfig:"STORAGESERVICE_MODE" default:"DIRECT"`
+	RemoteListenPort int    `mapstructure:"remoteListenPort" envconfig:"STORAGESERVICE_REMOTELISTENPORT"`
+	UnitTestModeOn   bool   `mapstructure:"unitTestModeOn" envconfig:"STORAGESERVICE_UNITTESTMODEON" default:"false"`
+	Country          string `mapstructure:"country" envconfig:"STORAGESERVICE_COUNTRY"`
+	Region           string `mapstructure:"region" envconfig:"STORAGESERVICE_REGION"`
+	Backend          string `mapstructure:"backend" envconfig:"STORAGESERVICE_BACKEND" default:"CASSANDRA"`
+	// ShutdownTimeout bounds the draining of HTTP requests, NATS messages and the expiry sweep on SIGTERM.
+	ShutdownTimeout time.Duration `mapstructure:"shutdownTimeout" envconfig:"STORAGESERVICE_SHUTDOWNTIMEOUT" default:"25s"`
 
 	Messaging struct {
 		Enabled      bool   `mapstructure:"enabled" envconfig:"STORAGESERVICE_MESSAGING_ENABLED" default:"false"`
 		StorageTopic string `mapstructure:"storageTopic" envconfig:"STORAGESERVICE_MESSAGING_STORAGETOPIC"`
-		Url          string `mapstructure:"url" envconfig:"STORAGESERVICE_MESSAGING_URL"`
-		QueueGroup   string `mapstructure:"queueGroup" envconfig:"STORAGESERVICE_MESSAGING_QUEUEGROUP"`
+		QueryTopic   string `mapstructure:"queryTopic" envconfig:"STORAGESERVICE_MESSAGING_QUERYTOPIC"`
+		ResultTopic  string `mapstructure:"resultTopic" envconfig:"STORAGESERVICE_MESSAGING_RESULTTOPIC"`
+		// LifecycleTopic receives the lifecycle events of the LifecycleTenants, of all tenants if none are given.
+		LifecycleTopic   string   `mapstructure:"lifecycleTopic" envconfig:"STORAGESERVICE_MESSAGING_LIFECYCLETOPIC"`
+		LifecycleTenants []string `mapstructure:"lifecycleTenants" envconfig:"STORAGESERVICE_MESSAGING_LIFECYCLETENANTS"`
+		Url              string   `mapstructure:"url" envconfig:"STORAGESERVICE_MESSAGING_URL"`
+		QueueGroup       string   `mapstructure:"queueGroup" envconfig:"STORAGESERVICE_MESSAGING_QUEUEGROUP"`
+		// JetStream replaces the core NATS subscription of the storage topic by a durable pull consumer.
+		JetStream struct {
+			Enabled    bool            `mapstructure:"enabled" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_ENABLED" default:"false"`
+			Stream     string          `mapstructure:"stream" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_STREAM"`
+			Durable    string          `mapstructure:"durable" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_DURABLE" default:"storage-service"`
+			AckWait    time.Duration   `mapstructure:"ackWait" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_ACKWAIT" default:"30s"`
+			MaxDeliver int             `mapstructure:"maxDeliver" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_MAXDELIVER" default:"5"`
+			BackOff    []time.Duration `mapstructure:"backOff" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_BACKOFF" default:"1s,10s,1m,5m"`
+			DeadLetter string          `mapstructure:"deadLetter" envconfig:"STORAGESERVICE_MESSAGING_JETSTREAM_DEADLETTER"`
+		} `mapstructure:"jetstream"`
 	} `mapstructure:"messaging"`
 
 	Crypto struct {
 		Namespace  string `mapstructure:"namespace" envconfig:"STORAGESERVICE_CRYPTO_NAMESPACE"`
 		SignKey    string `mapstructure:"signKey" envconfig:"STORAGESERVICE_CRYPTO_SIGNKEY"`
 		PluginPath string `mapstructure:"pluginPath" envconfig:"STORAGESERVICE_CRYPTO_PLUGINPATH" default:"/etc/plugins"`
+		// EndToEnd stores REMOTE items as the device encrypted them, the service holds no key for their content.
+		EndToEnd bool `mapstructure:"endToEnd" envconfig:"STORAGESERVICE_CRYPTO_ENDTOEND" default:"false"`
 	} `mapstructure:"crypto"`
 
 	Cassandra struct {
@@ -32,6 +56,56 @@ type storageConfiguration struct {
 		User     string `mapstructure:"user, omitempty" envconfig:"STORAGESERVICE_CASSANDRA_USER"`
 		Password string `mapstructure:"password, omitempty" envconfig:"STORAGESERVICE_CASSANDRA_PASSWORD"`
 	} `mapstructure:"cassandra"`
+
+	Metadata struct {
+		Mode string `mapstructure:"mode" envconfig:"STORAGESERVICE_METADATA_MODE" default:"NONE"`
+		Salt string `mapstructure:"salt" envconfig:"STORAGESERVICE_METADATA_SALT"`
+	} `mapstructure:"metadata"`
+
+	Expiry struct {
+		Policy      string        `mapstructure:"policy" envconfig:"STORAGESERVICE_EXPIRY_POLICY" default:"NONE"`
+		GracePeriod time.Duration `mapstructure:"gracePeriod" envconfig:"STORAGESERVICE_EXPIRY_GRACEPERIOD" default:"720h"`
+		Interval    time.Duration `mapstructure:"interval" envconfig:"STORAGESERVICE_EXPIRY_INTERVAL" default:"1h"`
+		// Tenants are the ids of the swept tenants, resolved by the allow-list, default the configured tenants.
+		Tenants []string `mapstructure:"tenants" envconfig:"STORAGESERVICE_EXPIRY_TENANTS"`
+	} `mapstructure:"expiry"`
+
+	Status struct {
+		Enabled  bool          `mapstructure:"enabled" envconfig:"STORAGESERVICE_STATUS_ENABLED" default:"false"`
+		CacheTtl time.Duration `mapstructure:"cacheTtl" envconfig:"STORAGESERVICE_STATUS_CACHETTL" default:"5m"`
+		Timeout  time.Duration `mapstructure:"timeout" envconfig:"STORAGESERVICE_STATUS_TIMEOUT" default:"10s"`
+		LocalDir string        `mapstructure:"localDir" envconfig:"STORAGESERVICE_STATUS_LOCALDIR"`
+		// AllowedHosts restricts the fetched lists to these hosts, without only public addresses are fetched.
+		AllowedHosts []string `mapstructure:"allowedHosts" envconfig:"STORAGESERVICE_STATUS_ALLOWEDHOSTS"`
+	} `mapstructure:"status"`
+
+	// Admin configures the tenant administration API, which is only served when a token is set.
+	Admin struct {
+		Token string `mapstructure:"token" envconfig:"STORAGESERVICE_ADMIN_TOKEN"`
+		// Replication is used for keyspaces of tenants which are created without replication.
+		Replication struct {
+			Class       string         `mapstructure:"class" envconfig:"STORAGESERVICE_ADMIN_REPLICATION_CLASS" default:"SimpleStrategy"`
+			Factor      int            `mapstructure:"factor" envconfig:"STORAGESERVICE_ADMIN_REPLICATION_FACTOR" default:"1"`
+			DataCenters map[string]int `mapstructure:"dataCenters" envconfig:"STORAGESERVICE_ADMIN_REPLICATION_DATACENTERS"`
+		} `mapstructure:"replication"`
+	} `mapstructure:"admin"`
+
+	// Tenants is the allow-list of the tenant ids in routes and messages, unknown tenants are rejected before their keyspace is queried.
+	Tenants struct {
+		// Keyspaces maps tenant ids to keyspaces, the configured keyspace is allowed as its own tenant if none are given.
+		Keyspaces map[string]string `mapstructure:"keyspaces" envconfig:"STORAGESERVICE_TENANTS_KEYSPACES"`
+		// Registry allows the tenants provisioned by the administration API as well.
+		Registry bool          `mapstructure:"registry" envconfig:"STORAGESERVICE_TENANTS_REGISTRY" default:"true"`
+		CacheTtl time.Duration `mapstructure:"cacheTtl" envconfig:"STORAGESERVICE_TENANTS_CACHETTL" default:"1m"`
+		// Settings is a YAML file overriding country, region, crypto namespace, sign key and modes per tenant.
+		Settings       string        `mapstructure:"settings" envconfig:"STORAGESERVICE_TENANTS_SETTINGS"`
+		ReloadInterval time.Duration `mapstructure:"reloadInterval" envconfig:"STORAGESERVICE_TENANTS_RELOADINTERVAL" default:"30s"`
+	} `mapstructure:"tenants"`
+
+	Sql struct {
+		Driver string `mapstructure:"driver" envconfig:"STORAGESERVICE_SQL_DRIVER" default:"postgres"`
+		Dsn    string `mapstructure:"dsn" envconfig:"STORAGESERVICE_SQL_DSN"`
+	} `mapstructure:"sql"`
 }
 
 var CurrentStorageConfig storageConfiguration
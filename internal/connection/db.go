@@ -16,11 +16,19 @@ type SessionInterface interface {
 
 type QueryInterface interface {
 	Scan(...interface{}) error
+	// MapScanCAS executes a lightweight transaction, the current values are stored in the map when it is not applied.
+	MapScanCAS(map[string]interface{}) (bool, error)
 	Exec() error
+	Iter() IterInterface
 	WithContext(ctx context.Context) QueryInterface
 	Consistency(consistency gocql.Consistency) QueryInterface
 }
 
+type IterInterface interface {
+	Scan(...interface{}) bool
+	Close() error
+}
+
 type Session struct {
 	session *gocql.Session
 }
@@ -49,11 +57,19 @@ func (q *Query) Exec() error {
 	return q.query.Exec()
 }
 
+func (q *Query) Iter() IterInterface {
+	return q.query.Iter()
+}
+
 // Scan wraps the query's Scan method
 func (q *Query) Scan(dest ...interface{}) error {
 	return q.query.Scan(dest...)
 }
 
+func (q *Query) MapScanCAS(dest map[string]interface{}) (bool, error) {
+	return q.query.MapScanCAS(dest)
+}
+
 func (q *Query) WithContext(c context.Context) QueryInterface {
 	return NewQuery(q.query.WithContext(c))
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 
 	"github.com/sirupsen/logrus"
 
@@ -33,6 +34,19 @@ func CreateCryptoProvider(unitTestMode bool, stdCryptoProvider types.CryptoProvi
 	}
 }
 
+/*
+	Usage: Releases the crypto provider on shutdown, if it holds resources like connections.
+
+	Notes: A loaded plugin itself can not be unloaded in Go.
+*/
+
+func CloseCryptoProvider() error {
+	if closer, ok := cProvider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 /*
 	Usage: Encrypts JWE messages before they are going out to storage.
 
@@ -102,6 +116,39 @@ func DecryptMessage(id string, cipher []byte, namespace string, group string, ct
 	}
 }
 
+/*
+	Usage: Deletes the content key of an account. Stored content which was encrypted by it, is afterwards not more readable.
+*/
+
+func DeleteMessageKey(id string, namespace string, group string, ctx context.Context, provider types.CryptoProvider) error {
+	identifier := types.CryptoIdentifier{
+		KeyId: id,
+		CryptoContext: types.CryptoContext{
+			Namespace: namespace,
+			Context:   ctx,
+			Group:     group,
+		},
+	}
+
+	exists, err := provider.IsKeyExisting(identifier)
+
+	if err != nil {
+		return errors.Join(errors.New("failed to check existence"), err)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	err = provider.DeleteKey(identifier)
+
+	if err != nil {
+		return errors.Join(errors.New("failed to delete key"), err)
+	}
+
+	return nil
+}
+
 func GenerateNonce(namespace string, group string, ctx context.Context) ([]byte, error) {
 	return cProvider.GenerateRandom(
 		types.CryptoContext{Namespace: namespace, Context: ctx, Group: group}, 32)
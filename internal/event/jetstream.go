@@ -0,0 +1,227 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/config"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+
+	cenats "github.com/cloudevents/sdk-go/protocol/nats/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	msgCommon "github.com/eclipse-xfsc/nats-message-library/common"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// fetchBatch is the number of store messages pulled at once, all of them are handled before a shutdown completes.
+	fetchBatch = 10
+	fetchWait  = time.Second
+
+	// Headers added to dead letters, the original headers and payload are kept so that the message can be replayed.
+	DeadLetterErrorHeader   = "Storage-Error"
+	DeadLetterErrorIdHeader = "Storage-Error-Id"
+)
+
+type disposition int
+
+const (
+	acknowledge disposition = iota
+	redeliver
+	deadLetter
+)
+
+/*
+jetstreamConsumer pulls the store messages from a durable JetStream consumer. Messages are acknowledged after they
+are stored, failed ones are redelivered with back off and end up on the dead letter subject when they are malformed
+or still fail at the last delivery.
+*/
+type jetstreamConsumer struct {
+	conn       *nats.Conn
+	sub        *nats.Subscription
+	maxDeliver int
+	backOff    []time.Duration
+	deadLetter string
+}
+
+func newJetstreamConsumer(url string, topic string) (*jetstreamConsumer, error) {
+	conf := config.CurrentStorageConfig.Messaging.JetStream
+
+	if conf.Stream == "" {
+		return nil, errors.New("jetstream stream must be configured")
+	}
+
+	if conf.MaxDeliver < 1 {
+		return nil, errors.New("jetstream max deliver must be positive")
+	}
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	consumerConfig := &nats.ConsumerConfig{
+		Durable:       conf.Durable,
+		FilterSubject: topic,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       conf.AckWait,
+		MaxDeliver:    conf.MaxDeliver,
+		BackOff:       conf.BackOff,
+	}
+
+	// the consumer is created here and not by the subscription, otherwise unsubscribing would delete it
+	if _, err = js.ConsumerInfo(conf.Stream, conf.Durable); errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(conf.Stream, consumerConfig)
+	} else if err == nil {
+		_, err = js.UpdateConsumer(conf.Stream, consumerConfig)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	sub, err := js.PullSubscribe(topic, conf.Durable, nats.Bind(conf.Stream, conf.Durable))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &jetstreamConsumer{
+		conn:       conn,
+		sub:        sub,
+		maxDeliver: conf.MaxDeliver,
+		backOff:    conf.BackOff,
+		deadLetter: conf.DeadLetter,
+	}, nil
+}
+
+// run pulls messages until the context is cancelled. The pulled batch is handled completely before it returns.
+func (c *jetstreamConsumer) run(ctx context.Context) {
+	defer storagemessaging.receivers.Done()
+
+	for ctx.Err() == nil {
+		msgs, err := c.sub.Fetch(fetchBatch, nats.MaxWait(fetchWait))
+
+		if err != nil && !errors.Is(err, nats.ErrTimeout) {
+			log.Errorf("error fetching store messages: %v", err)
+			time.Sleep(fetchWait)
+			continue
+		}
+
+		for _, msg := range msgs {
+			c.handle(msg)
+		}
+	}
+}
+
+func (c *jetstreamConsumer) handle(msg *nats.Msg) {
+	var delivered uint64 = 1
+
+	if metadata, err := msg.Metadata(); err == nil {
+		delivered = metadata.NumDelivered
+	}
+
+	result := c.store(msg)
+	storagemessaging.publishResult(result)
+
+	var err error
+
+	switch dispose(result, delivered, c.maxDeliver) {
+	case acknowledge:
+		err = msg.Ack()
+	case redeliver:
+		err = msg.NakWithDelay(retryDelay(c.backOff, delivered))
+	case deadLetter:
+		c.publishDeadLetter(msg, result.Error)
+		err = msg.Term()
+	}
+
+	if err != nil {
+		log.Errorf("error settling store message: %v", err)
+	}
+}
+
+func (c *jetstreamConsumer) store(msg *nats.Msg) messaging.StorageServiceStoreResult {
+	var result messaging.StorageServiceStoreResult
+
+	e, err := binding.ToEvent(context.Background(), cenats.NewMessage(msg))
+
+	if err != nil {
+		result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidMessageError, Msg: err.Error()}
+		return result
+	}
+
+	var storeMessage messaging.StorageServiceStoreMessage
+
+	if err := json.Unmarshal(e.Data(), &storeMessage); err != nil {
+		result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidMessageError, Msg: err.Error()}
+		return result
+	}
+
+	return store(context.Background(), storeMessage, common.GetEnvironment())
+}
+
+func (c *jetstreamConsumer) publishDeadLetter(msg *nats.Msg, storeError *msgCommon.Error) {
+	if c.deadLetter == "" {
+		log.Errorf("store message dropped after %d deliveries: %s", c.maxDeliver, storeError.Msg)
+		return
+	}
+
+	deadLetter := nats.NewMsg(c.deadLetter)
+	deadLetter.Data = msg.Data
+
+	for key, values := range msg.Header {
+		deadLetter.Header[key] = values
+	}
+
+	deadLetter.Header.Set(DeadLetterErrorHeader, storeError.Msg)
+	deadLetter.Header.Set(DeadLetterErrorIdHeader, storeError.Id)
+
+	if err := c.conn.PublishMsg(deadLetter); err != nil {
+		log.Errorf("error publishing dead letter: %v", err)
+	}
+}
+
+// close unsubscribes without deleting the durable consumer and closes the connection.
+func (c *jetstreamConsumer) close() error {
+	err := c.sub.Unsubscribe()
+	c.conn.Close()
+	return err
+}
+
+// dispose decides on a handled message. Malformed messages are not retried, failures until the last delivery.
+func dispose(result messaging.StorageServiceStoreResult, delivered uint64, maxDeliver int) disposition {
+	switch {
+	case result.Success:
+		return acknowledge
+	case result.Error != nil && result.Error.Status < 500:
+		return deadLetter
+	case delivered >= uint64(maxDeliver):
+		return deadLetter
+	}
+	return redeliver
+}
+
+// retryDelay returns the back off of the delivery, the last one is kept for further deliveries.
+func retryDelay(backOff []time.Duration, delivered uint64) time.Duration {
+	if len(backOff) == 0 || delivered == 0 {
+		return 0
+	}
+
+	if delivered > uint64(len(backOff)) {
+		return backOff[len(backOff)-1]
+	}
+
+	return backOff[delivered-1]
+}
@@ -0,0 +1,231 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/config"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+
+	cenats "github.com/cloudevents/sdk-go/protocol/nats/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/eclipse-xfsc/cloud-event-provider"
+	msgCommon "github.com/eclipse-xfsc/nats-message-library/common"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestDispose(t *testing.T) {
+	stored := messaging.StorageServiceStoreResult{Success: true}
+	malformed := messaging.StorageServiceStoreResult{Reply: msgCommon.Reply{Error: &msgCommon.Error{Status: 400, Id: messaging.InvalidPayloadError}}}
+	failed := messaging.StorageServiceStoreResult{Reply: msgCommon.Reply{Error: &msgCommon.Error{Status: 500, Id: messaging.StoreError}}}
+
+	for _, c := range []struct {
+		result    messaging.StorageServiceStoreResult
+		delivered uint64
+		expected  disposition
+	}{
+		{stored, 1, acknowledge},
+		{stored, 5, acknowledge},
+		{malformed, 1, deadLetter},
+		{failed, 1, redeliver},
+		{failed, 4, redeliver},
+		{failed, 5, deadLetter},
+	} {
+		if d := dispose(c.result, c.delivered, 5); d != c.expected {
+			t.Error("disposition is wrong", c.delivered, c.result.Error, d)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	backOff := []time.Duration{time.Second, time.Minute}
+
+	for delivered, expected := range map[uint64]time.Duration{1: time.Second, 2: time.Minute, 7: time.Minute} {
+		if d := retryDelay(backOff, delivered); d != expected {
+			t.Error("retry delay is wrong", delivered, d)
+		}
+	}
+
+	if d := retryDelay(nil, 3); d != 0 {
+		t.Error("retry without back off should be immediate", d)
+	}
+}
+
+// failingRepository fails the stores of an id for the given number of attempts.
+type failingRepository struct {
+	repository.Repository
+	mutex    sync.Mutex
+	failures map[string]int
+}
+
+func (r *failingRepository) StoreItemIf(ctx context.Context, key repository.AccountKey, id string, content string, metadata repository.ItemMetadata, presentation bool, condition repository.Condition) (int64, error) {
+	r.mutex.Lock()
+	failing := r.failures[id] > 0
+	r.failures[id]--
+	r.mutex.Unlock()
+
+	if failing {
+		return 0, errors.New("storage not available")
+	}
+
+	return r.Repository.StoreItemIf(ctx, key, id, content, metadata, presentation, condition)
+}
+
+func (r *failingRepository) remaining(id string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.failures[id]
+}
+
+func publishStore(t *testing.T, js nats.JetStreamContext, id string) {
+	data, _ := json.Marshal(messaging.StorageServiceStoreMessage{
+		Request:     msgCommon.Request{TenantId: "tenant_space", RequestId: id},
+		AccountId:   "ABCD123",
+		Type:        messaging.StoreCredentialType,
+		Payload:     []byte(`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"]}`),
+		ContentType: common.NormalContentType,
+		Id:          id,
+	})
+
+	e, err := cloudeventprovider.NewEvent("test", messaging.StoreCredentialType, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, _ := json.Marshal(e)
+
+	if _, err := js.Publish("storage.store", msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJetstreamConsumer(t *testing.T) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	defer s.Shutdown()
+
+	conn, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "STORAGE", Subjects: []string{"storage.store"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters, err := conn.SubscribeSync("storage.dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.CurrentStorageConfig.Messaging.JetStream
+	previous := *conf
+	defer func() { *conf = previous }()
+
+	conf.Stream = "STORAGE"
+	conf.Durable = "storage-test"
+	conf.AckWait = time.Second
+	conf.MaxDeliver = 3
+	conf.BackOff = []time.Duration{50 * time.Millisecond}
+	conf.DeadLetter = "storage.dead"
+
+	env := testEnvironment(t)
+	repo := &failingRepository{Repository: env.GetRepository(), failures: map[string]int{"retried": 1, "broken": 10}}
+	env.SetRepository(repo)
+
+	consumer, err := newJetstreamConsumer(s.ClientURL(), "storage.store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.close()
+
+	common.WithTestEnvironment(env, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		storagemessaging.receivers.Add(1)
+		go consumer.run(ctx)
+		defer func() {
+			cancel()
+			storagemessaging.receivers.Wait()
+		}()
+
+		publishStore(t, js, "stored")
+		publishStore(t, js, "retried")
+		publishStore(t, js, "broken")
+
+		if _, err := js.Publish("storage.store", []byte("no cloud event")); err != nil {
+			t.Fatal(err)
+		}
+
+		// the malformed message is dead lettered at once, the failing store after its last delivery
+		expected := map[string]string{"": messaging.InvalidMessageError, "broken": messaging.StoreError}
+
+		for range expected {
+			msg, err := deadLetters.NextMsg(10 * time.Second)
+			if err != nil {
+				t.Fatal("dead letter should arrive", err)
+			}
+
+			var stored messaging.StorageServiceStoreMessage
+			if e, err := binding.ToEvent(ctx, cenats.NewMessage(msg)); err == nil {
+				json.Unmarshal(e.Data(), &stored)
+			}
+
+			if id, ok := expected[stored.Id]; !ok || msg.Header.Get(DeadLetterErrorIdHeader) != id || msg.Header.Get(DeadLetterErrorHeader) == "" {
+				t.Error("dead letter is wrong", stored.Id, msg.Header, string(msg.Data))
+			}
+			delete(expected, stored.Id)
+		}
+
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			info, err := js.ConsumerInfo("STORAGE", "storage-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.NumAckPending == 0 && info.NumPending == 0 && info.NumRedelivered == 0 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("messages should be settled", info.NumAckPending, info.NumPending, info.NumRedelivered)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		items, _ := env.GetRepository().LoadItems(ctx, env.GetAccountKey(model.AuthModel{Account: "ABCD123", TenantId: "tenant_space"}), false)
+
+		if _, ok := items["stored"]; !ok {
+			t.Error("stored message should be acknowledged after the store", items)
+		}
+
+		if _, ok := items["retried"]; !ok || repo.remaining("retried") != -1 {
+			t.Error("failed store should be redelivered", items, repo.remaining("retried"))
+		}
+
+		if _, ok := items["broken"]; ok || repo.remaining("broken") != 10-conf.MaxDeliver {
+			t.Error("failing store should be delivered max deliver times", repo.remaining("broken"))
+		}
+	})
+}
@@ -3,81 +3,265 @@ package event
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/config"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	credentials "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/credentials"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/lifecycle"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/dcql"
 	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
 
 	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/eclipse-xfsc/cloud-event-provider"
-	logPkg "github.com/eclipse-xfsc/microservice-core-go/pkg/logr"
+	msgCommon "github.com/eclipse-xfsc/nats-message-library/common"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwe"
 	log "github.com/sirupsen/logrus"
 )
 
 type StorageMessaging struct {
-	client *cloudeventprovider.CloudEventProviderClient
-	logger *logPkg.Logger
+	client          *cloudeventprovider.CloudEventProviderClient
+	replyClient     *cloudeventprovider.CloudEventProviderClient
+	resultClient    *cloudeventprovider.CloudEventProviderClient
+	lifecycleClient *cloudeventprovider.CloudEventProviderClient
+	jetstream       *jetstreamConsumer
+	// cancel stops the receivers, which are tracked by the wait group until their messages in flight are handled
+	cancel    context.CancelFunc
+	receivers sync.WaitGroup
 }
 
 var storagemessaging = new(StorageMessaging)
 
-func StartCloudEvents() error {
+// contentType of the items exchanged by messages, JSON unless the messages carry the JWEs of REMOTE devices.
+var contentType = common.NormalContentType
+
+func StartCloudEvents(itemContentType string) error {
 	log.Info("start messaging!")
-	client, err := cloudeventprovider.New(cloudeventprovider.Config{
-		Protocol: cloudeventprovider.ProtocolTypeNats,
-		Settings: cloudeventprovider.NatsConfig{
-			Url:        config.CurrentStorageConfig.Messaging.Url,
-			QueueGroup: config.CurrentStorageConfig.Messaging.QueueGroup,
-		},
-	}, cloudeventprovider.ConnectionTypeSub, config.CurrentStorageConfig.Messaging.StorageTopic)
-	if err != nil {
-		log.Fatal(err)
+	contentType = itemContentType
+
+	if config.CurrentStorageConfig.Messaging.JetStream.Enabled {
+		consumer, err := newJetstreamConsumer(config.CurrentStorageConfig.Messaging.Url, config.CurrentStorageConfig.Messaging.StorageTopic)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		storagemessaging.jetstream = consumer
+	} else {
+		client, err := cloudeventprovider.New(cloudeventprovider.Config{
+			Protocol: cloudeventprovider.ProtocolTypeNats,
+			Settings: cloudeventprovider.NatsConfig{
+				Url:        config.CurrentStorageConfig.Messaging.Url,
+				QueueGroup: config.CurrentStorageConfig.Messaging.QueueGroup,
+			},
+		}, cloudeventprovider.ConnectionTypeSub, config.CurrentStorageConfig.Messaging.StorageTopic)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		storagemessaging.client = client
+	}
+
+	if config.CurrentStorageConfig.Messaging.ResultTopic != "" {
+		resultClient, err := cloudeventprovider.New(cloudeventprovider.Config{
+			Protocol: cloudeventprovider.ProtocolTypeNats,
+			Settings: cloudeventprovider.NatsConfig{
+				Url: config.CurrentStorageConfig.Messaging.Url,
+			},
+		}, cloudeventprovider.ConnectionTypePub, config.CurrentStorageConfig.Messaging.ResultTopic)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		storagemessaging.resultClient = resultClient
 	}
 
-	storagemessaging.client = client
+	if config.CurrentStorageConfig.Messaging.LifecycleTopic != "" {
+		lifecycleClient, err := cloudeventprovider.New(cloudeventprovider.Config{
+			Protocol: cloudeventprovider.ProtocolTypeNats,
+			Settings: cloudeventprovider.NatsConfig{
+				Url: config.CurrentStorageConfig.Messaging.Url,
+			},
+		}, cloudeventprovider.ConnectionTypePub, config.CurrentStorageConfig.Messaging.LifecycleTopic)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		storagemessaging.lifecycleClient = lifecycleClient
+		common.GetEnvironment().SetPublisher(lifecycle.NewPublisher(lifecycleClient, common.EventSource, config.CurrentStorageConfig.Messaging.LifecycleTenants))
+	}
 
-	/*defer func() {
-		if err := client.Close(); err != nil {
-			log.Error(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	storagemessaging.cancel = cancel
+
+	storagemessaging.receivers.Add(1)
+	if storagemessaging.jetstream != nil {
+		go storagemessaging.jetstream.run(ctx)
+	} else {
+		go storagemessaging.listen(ctx)
+	}
+
+	if config.CurrentStorageConfig.Messaging.QueryTopic != "" {
+		replyClient, err := cloudeventprovider.New(cloudeventprovider.Config{
+			Protocol: cloudeventprovider.ProtocolTypeNats,
+			Settings: cloudeventprovider.NatsConfig{
+				Url:        config.CurrentStorageConfig.Messaging.Url,
+				QueueGroup: config.CurrentStorageConfig.Messaging.QueueGroup,
+			},
+		}, cloudeventprovider.ConnectionTypeRep, config.CurrentStorageConfig.Messaging.QueryTopic)
+		if err != nil {
+			log.Fatal(err)
 		}
-	}()*/
 
-	go storagemessaging.listen()
+		storagemessaging.replyClient = replyClient
+
+		storagemessaging.receivers.Add(1)
+		go storagemessaging.reply(ctx)
+	}
 
 	return nil
 }
 
-func (s *StorageMessaging) listen() {
-	for {
-		if err := s.client.SubCtx(context.Background(), handler); err != nil {
-			s.logger.Error(err, "error retrieving message")
+func (s *StorageMessaging) listen(ctx context.Context) {
+	defer s.receivers.Done()
+
+	for ctx.Err() == nil {
+		if err := s.client.SubCtx(ctx, handler); err != nil && ctx.Err() == nil {
+			log.Errorf("error retrieving message: %v", err)
+		}
+	}
+}
+
+// reply answers requests until the reply client is closed, closing it drains the subscription.
+func (s *StorageMessaging) reply(ctx context.Context) {
+	defer s.receivers.Done()
+
+	for ctx.Err() == nil {
+		if err := s.replyClient.ReplyCtx(context.Background(), requestHandler); err != nil && ctx.Err() == nil {
+			log.Errorf("error replying to request: %v", err)
+		}
+	}
+}
+
+/*
+Drain stops receiving store messages and requests and waits until the messages in flight are handled, at most until
+the context is done. The publishing clients stay open for the remaining HTTP requests.
+*/
+func Drain(ctx context.Context) error {
+	if storagemessaging.cancel == nil {
+		return nil
+	}
+
+	storagemessaging.cancel()
+
+	if storagemessaging.replyClient != nil {
+		// the reply client stops replying only when it is closed
+		go storagemessaging.replyClient.Close()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		storagemessaging.receivers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the NATS connections of the remaining clients, after Drain.
+func Close() error {
+	var errs []error
+
+	for _, client := range []*cloudeventprovider.CloudEventProviderClient{storagemessaging.client, storagemessaging.resultClient,
+		storagemessaging.lifecycleClient} {
+		if client != nil && client.Alive() {
+			if err := client.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if storagemessaging.jetstream != nil {
+		if err := storagemessaging.jetstream.close(); err != nil {
+			errs = append(errs, err)
 		}
 	}
+
+	return errors.Join(errs...)
 }
 
 func handler(event event.Event) {
 	var newMessage messaging.StorageServiceStoreMessage
-	err := json.Unmarshal(event.Data(), &newMessage)
-	if err != nil {
+	var result messaging.StorageServiceStoreResult
+
+	if err := json.Unmarshal(event.Data(), &newMessage); err != nil {
 		log.Errorf("error occured while unmarshal Message %v: %v", event, err)
+		result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidMessageError, Msg: err.Error()}
+	} else {
+		log.Debugf("new Message received: %v", newMessage)
+		result = store(context.Background(), newMessage, common.GetEnvironment())
 	}
 
-	log.Debugf("new Message received: %v", newMessage)
+	storagemessaging.publishResult(result)
+}
 
-	getType(newMessage, common.GetEnvironment())
+// publishResult sends the outcome of a store message to the result topic, if one is configured.
+func (s *StorageMessaging) publishResult(result messaging.StorageServiceStoreResult) {
+	if s.resultClient == nil {
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Errorf("error marshalling store result: %v", err)
+		return
+	}
+
+	resultEvent, err := cloudeventprovider.NewEvent(common.EventSource, messaging.StoreResultType, data)
+	if err != nil {
+		log.Errorf("error creating store result: %v", err)
+		return
+	}
+
+	if err := s.resultClient.PubCtx(context.Background(), resultEvent); err != nil {
+		log.Errorf("error publishing store result: %v", err)
+	}
 }
 
-func getType(msg messaging.StorageServiceStoreMessage, env *common.Environment) {
+/*
+store saves the payload of the message. Malformed payloads are reported with status 400, failures of the storage
+with 500, the error id tells which step failed.
+*/
+func store(ctx context.Context, msg messaging.StorageServiceStoreMessage, env *common.Environment) messaging.StorageServiceStoreResult {
 	logger := env.GetLogger()
 
-	authModel := model.AuthModel{
-		Account:  msg.AccountId,
-		TenantId: msg.TenantId,
+	result := messaging.StorageServiceStoreResult{
+		Reply: msgCommon.Reply{
+			TenantId:  msg.TenantId,
+			RequestId: msg.RequestId,
+		},
+		AccountId: msg.AccountId,
+		Type:      msg.Type,
+		Id:        msg.Id,
+	}
+
+	authModel, tenantError := resolveTenant(ctx, env, msg.TenantId, msg.AccountId)
+
+	if tenantError != nil {
+		result.Error = tenantError
+		return result
 	}
 
 	presentation := false
@@ -86,36 +270,381 @@ func getType(msg messaging.StorageServiceStoreMessage, env *common.Environment)
 		presentation = true
 	}
 
-	if msg.ContentType == common.EncryptedContentType {
+	// the payload is stored with the content type of the service, a message can not choose another one
+	if msg.ContentType != authModel.ContentType {
+		logger.Error(nil, "content type of the message does not match the service", "contentType", msg.ContentType)
+		result.Error = &msgCommon.Error{Status: 400, Id: messaging.WrongContentTypeError, Msg: handlers.WrongContentType}
+		return result
+	}
+
+	if authModel.ContentType == common.EncryptedContentType {
 		message, err := jwe.Parse(msg.Payload)
 		if err != nil {
 			logger.Error(err, "body parse error")
-			return
+			result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidPayloadError, Msg: err.Error()}
+			return result
 		}
 		if message.ProtectedHeaders().Algorithm() != jwa.ECDH_ES_A256KW {
 			logger.Error(nil, handlers.InvalidKeyEncryptionAlgorithm)
-			return
+			result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidPayloadError, Msg: handlers.InvalidKeyEncryptionAlgorithm}
+			return result
 		}
 		if message.ProtectedHeaders().ContentEncryption() != jwa.ContentEncryptionAlgorithm(jwa.A256GCM) {
 			logger.Error(nil, handlers.InvalidContentEncryptionAlgorithm)
-			return
+			result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidPayloadError, Msg: handlers.InvalidContentEncryptionAlgorithm}
+			return result
 		}
-		recipients := message.Recipients()
-		if len(recipients) == 1 {
-			if _, err := services.StoreMessage(context.Background(), msg.Id, msg.Payload, authModel, env, presentation); err != nil {
-				logger.Error(err, "could not store message")
-				return
-			}
+		if len(message.Recipients()) != 1 {
+			logger.Error(nil, "payload must have exactly one recipient")
+			result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidPayloadError, Msg: "payload must have exactly one recipient"}
+			return result
 		}
+	}
+
+	/*var message map[string]interface{} // DO NOT PARSE, SD-JWT is just a string
+	if err := json.Unmarshal(msg.Payload, &message); err != nil {
+		logger.Error(err, "not a json body")
+		return
+	}*/
+	condition := repository.Condition{IdempotencyKey: msg.IdempotencyKey}
+
+	var receipt *model.Receipt
+	var version int64
+	var err error
+
+	if msg.Id == "" {
+		// the chosen id is reported in the result
+		result.Id, receipt, version, err = services.CreateMessage(ctx, msg.Payload, authModel, env, presentation, condition)
 	} else {
-		/*var message map[string]interface{} // DO NOT PARSE, SD-JWT is just a string
-		if err := json.Unmarshal(msg.Payload, &message); err != nil {
-			logger.Error(err, "not a json body")
-			return
-		}*/
-		if _, err := services.StoreMessage(context.Background(), msg.Id, msg.Payload, authModel, env, presentation); err != nil {
-			logger.Error(err, "could not store message")
-			return
+		receipt, version, err = services.StoreMessage(ctx, msg.Id, msg.Payload, authModel, env, presentation, condition)
+	}
+
+	if err == nil && receipt == nil && authModel.ContentType == common.EncryptedContentType {
+		err = errors.New("Receipt Failure")
+	}
+
+	if errors.Is(err, metadata.ErrInvalidFormat) {
+		logger.Error(err, "invalid credential format")
+		result.Error = &msgCommon.Error{Status: 400, Id: messaging.InvalidFormatError, Msg: err.Error()}
+		return result
+	}
+
+	if err != nil {
+		logger.Error(err, "could not store message")
+		result.Error = &msgCommon.Error{Status: 500, Id: messaging.StoreError, Msg: err.Error()}
+		return result
+	}
+
+	result.Success = true
+	result.Version = version
+
+	if receipt != nil {
+		result.Receipt = receipt.Receipt
+	}
+
+	return result
+}
+
+/*
+requestHandler answers the requests on the query topic by their event type, requests of unknown types are taken as
+queries. Malformed requests are answered with status 400.
+*/
+func requestHandler(ctx context.Context, e event.Event) (*event.Event, error) {
+	env := common.GetEnvironment()
+
+	var reply interface{}
+	var replyType string
+	var err error
+
+	switch e.Type() {
+	case messaging.StoreCredentialType, messaging.StorePresentationType:
+		var msg messaging.StorageServiceStoreMessage
+		if err = json.Unmarshal(e.Data(), &msg); err == nil {
+			reply = store(ctx, msg, env)
+		}
+		replyType = messaging.StoreResultType
+	case messaging.GetType:
+		var msg messaging.StorageServiceGetMessage
+		if err = json.Unmarshal(e.Data(), &msg); err == nil {
+			reply = get(ctx, msg, env)
+		}
+		replyType = messaging.GetReplyType
+	case messaging.ListType:
+		var msg messaging.StorageServiceListMessage
+		if err = json.Unmarshal(e.Data(), &msg); err == nil {
+			reply = list(ctx, msg, env)
+		}
+		replyType = messaging.ListReplyType
+	case messaging.DeleteType:
+		var msg messaging.StorageServiceDeleteMessage
+		if err = json.Unmarshal(e.Data(), &msg); err == nil {
+			reply = remove(ctx, msg, env)
+		}
+		replyType = messaging.DeleteReplyType
+	case messaging.ChainType:
+		var msg messaging.StorageServiceChainMessage
+		if err = json.Unmarshal(e.Data(), &msg); err == nil {
+			reply = chain(ctx, msg, env)
+		}
+		replyType = messaging.ChainReplyType
+	default:
+		var msg messaging.StorageServiceQueryMessage
+		if err = json.Unmarshal(e.Data(), &msg); err == nil {
+			reply = query(ctx, msg, env)
 		}
+		replyType = messaging.QueryReplyType
+	}
+
+	if err != nil {
+		log.Errorf("error occured while unmarshal Message %v: %v", e, err)
+		// all replies embed the reply envelope, so the bare envelope is a valid reply of each type
+		reply = msgCommon.Reply{Error: &msgCommon.Error{Status: 400, Id: messaging.InvalidMessageError, Msg: err.Error()}}
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
 	}
+
+	replyEvent, err := cloudeventprovider.NewEvent(common.EventSource, replyType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replyEvent, nil
+}
+
+// resolveTenant checks the tenant of a message against the allow-list and addresses its keyspace.
+func resolveTenant(ctx context.Context, env *common.Environment, tenantId string, accountId string) (model.AuthModel, *msgCommon.Error) {
+	authModel := model.AuthModel{
+		Account:     accountId,
+		TenantId:    tenantId,
+		ContentType: contentType,
+	}
+
+	tenant, err := env.GetTenantResolver().Resolve(ctx, env.GetRepository(), tenantId)
+
+	if errors.Is(err, tenancy.ErrUnknownTenant) {
+		return authModel, &msgCommon.Error{Status: 403, Id: messaging.UnknownTenantError, Msg: err.Error()}
+	}
+
+	if err != nil {
+		return authModel, replyError(env, err)
+	}
+
+	authModel.Keyspace = tenant.Keyspace
+	return authModel, nil
+}
+
+// replyError maps a failed request onto the error of its reply.
+func replyError(env *common.Environment, err error) *msgCommon.Error {
+	switch {
+	case errors.Is(err, dcql.ErrInvalidQuery), errors.Is(err, repository.ErrInvalidCursor):
+		return &msgCommon.Error{Status: 400, Msg: err.Error()}
+	case errors.Is(err, repository.ErrNotFound):
+		return &msgCommon.Error{Status: 404, Msg: err.Error()}
+	}
+
+	env.GetLogger().Error(err, "could not answer request")
+	return &msgCommon.Error{Status: 500, Msg: err.Error()}
+}
+
+func get(ctx context.Context, msg messaging.StorageServiceGetMessage, env *common.Environment) messaging.StorageServiceGetReply {
+	reply := messaging.StorageServiceGetReply{
+		Reply: msgCommon.Reply{
+			TenantId:  msg.TenantId,
+			RequestId: msg.RequestId,
+		},
+	}
+
+	authModel, tenantError := resolveTenant(ctx, env, msg.TenantId, msg.AccountId)
+
+	if tenantError != nil {
+		reply.Error = tenantError
+		return reply
+	}
+
+	item, err := credentials.GetItemModel(ctx, authModel, env, msg.Id, msg.Type == messaging.StorePresentationType)
+
+	if err != nil {
+		reply.Error = replyError(env, err)
+		return reply
+	}
+
+	reply.Id = item.Id
+	reply.Credential = item.Credential
+	reply.Format = item.Format
+	reply.Expired = item.Expired
+	reply.Status = item.Status
+	reply.Version = item.Version
+	reply.Receipt = item.Receipt
+
+	return reply
+}
+
+func list(ctx context.Context, msg messaging.StorageServiceListMessage, env *common.Environment) messaging.StorageServiceListReply {
+	reply := messaging.StorageServiceListReply{
+		Reply: msgCommon.Reply{
+			TenantId:  msg.TenantId,
+			RequestId: msg.RequestId,
+		},
+	}
+
+	authModel, tenantError := resolveTenant(ctx, env, msg.TenantId, msg.AccountId)
+
+	if tenantError != nil {
+		reply.Error = tenantError
+		return reply
+	}
+
+	if msg.Limit < 0 {
+		reply.Error = &msgCommon.Error{Status: 400, Msg: "limit must not be negative"}
+		return reply
+	}
+
+	page, err := credentials.GetPageModel(ctx, authModel, env, msg.Type == messaging.StorePresentationType, msg.Limit, msg.Cursor, metadata.Query{}, msg.IncludeExpired)
+
+	if err != nil {
+		reply.Error = replyError(env, err)
+		return reply
+	}
+
+	reply.Credentials = page.Credentials
+	reply.Next = page.Next
+	reply.Formats = page.Formats
+	reply.Expired = page.Expired
+	reply.Status = page.Status
+	reply.Receipt = page.Receipt
+
+	return reply
+}
+
+/*
+query evaluates the DCQL query of the message or, without one, its presentation definition. Invalid queries are
+answered with status 400, failures with 500.
+*/
+func query(ctx context.Context, msg messaging.StorageServiceQueryMessage, env *common.Environment) messaging.StorageServiceQueryReply {
+	reply := messaging.StorageServiceQueryReply{
+		Reply: msgCommon.Reply{
+			TenantId:  msg.TenantId,
+			RequestId: msg.RequestId,
+		},
+	}
+
+	authModel, tenantError := resolveTenant(ctx, env, msg.TenantId, msg.AccountId)
+
+	if tenantError != nil {
+		reply.Error = tenantError
+		return reply
+	}
+
+	presentation := msg.Type == messaging.StorePresentationType
+
+	var result *model.GetCredentialModel
+	var err error
+
+	if msg.DcqlQuery != nil {
+		result, err = services.QueryCredentials(ctx, authModel, env, msg.DcqlQuery, metadata.Query{}, msg.IncludeExpired, presentation)
+	} else {
+		result, err = credentials.GetCredentialsModel(ctx, authModel, env, msg.PresentationDefinition, metadata.Query{}, msg.IncludeExpired, presentation)
+	}
+
+	if err != nil {
+		reply.Error = replyError(env, err)
+		return reply
+	}
+
+	reply.Matches = result.Matches
+	reply.Groups = result.Groups
+	reply.Receipt = result.Receipt
+	reply.Expired = result.Expired
+	reply.Status = result.Status
+
+	if result.Receipt != "" {
+		reply.Credentials = result.Credentials
+	}
+
+	return reply
+}
+
+// remove deletes the item of the message, in remote mode the reply carries a receipt.
+func remove(ctx context.Context, msg messaging.StorageServiceDeleteMessage, env *common.Environment) messaging.StorageServiceDeleteReply {
+	reply := messaging.StorageServiceDeleteReply{
+		Reply: msgCommon.Reply{
+			TenantId:  msg.TenantId,
+			RequestId: msg.RequestId,
+		},
+	}
+
+	authModel, tenantError := resolveTenant(ctx, env, msg.TenantId, msg.AccountId)
+
+	if tenantError != nil {
+		reply.Error = tenantError
+		return reply
+	}
+
+	if authModel.ContentType == common.EncryptedContentType {
+		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+		if receipt == nil {
+			reply.Error = replyError(env, errors.New("Receipt Failure"))
+			return reply
+		}
+
+		reply.Receipt = receipt.Receipt
+	}
+
+	if err := credentials.RemoveCredential(ctx, msg.Id, authModel, env, msg.Type == messaging.StorePresentationType); err != nil {
+		reply.Receipt = ""
+		reply.Error = replyError(env, err)
+	}
+
+	return reply
+}
+
+func chain(ctx context.Context, msg messaging.StorageServiceChainMessage, env *common.Environment) messaging.StorageServiceChainReply {
+	reply := messaging.StorageServiceChainReply{
+		Reply: msgCommon.Reply{
+			TenantId:  msg.TenantId,
+			RequestId: msg.RequestId,
+		},
+	}
+
+	authModel, tenantError := resolveTenant(ctx, env, msg.TenantId, msg.AccountId)
+
+	if tenantError != nil {
+		reply.Error = tenantError
+		return reply
+	}
+
+	statement := model.ChainStatement{
+		Root:      msg.Root,
+		Chain:     chainItems(msg.Chain),
+		ChainName: msg.ChainName,
+	}
+
+	result, err := credentials.ChainCredentials(ctx, statement, authModel, env)
+
+	if err != nil {
+		reply.Error = replyError(env, err)
+		return reply
+	}
+
+	reply.Chain = result
+
+	return reply
+}
+
+func chainItems(items []messaging.ChainItem) []model.ChainItem {
+	if items == nil {
+		return nil
+	}
+
+	result := make([]model.ChainItem, 0, len(items))
+
+	for _, item := range items {
+		result = append(result, model.ChainItem{Item: item.Item, Chain: chainItems(item.Chain)})
+	}
+
+	return result
 }
@@ -1,7 +1,305 @@
 package event
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/dcql"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+
+	"github.com/eclipse-xfsc/cloud-event-provider"
+	"github.com/eclipse-xfsc/microservice-core-go/pkg/logr"
+	msgCommon "github.com/eclipse-xfsc/nats-message-library/common"
+	oid4vip "github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
+)
 
 func TestStoreMessage(t *testing.T) {
+	env := testEnvironment(t)
+	ctx := context.Background()
+
+	msg := messaging.StorageServiceStoreMessage{
+		Request:     msgCommon.Request{TenantId: "tenant_space", RequestId: "3"},
+		AccountId:   "ABCD123",
+		Type:        messaging.StoreCredentialType,
+		Payload:     []byte(`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"]}`),
+		ContentType: common.NormalContentType,
+		Id:          "stored",
+	}
+
+	result := store(ctx, msg, env)
+
+	if !result.Success || result.Error != nil || result.Id != "stored" || result.RequestId != "3" {
+		t.Error("store result is wrong", result)
+	}
+
+	msg.Payload = []byte(`{"type":"VerifiableCredential"`)
+	result = store(ctx, msg, env)
+
+	if result.Success || result.Error == nil || result.Error.Status != 400 || result.Error.Id != messaging.InvalidFormatError {
+		t.Error("malformed credential should be reported", result)
+	}
+
+	// a JWE can not be stored by a service storing JSON, and a JSON message not by one storing JWEs
+	msg.ContentType = common.EncryptedContentType
+	result = store(ctx, msg, env)
+
+	if result.Success || result.Error == nil || result.Error.Id != messaging.WrongContentTypeError {
+		t.Error("jwe should be rejected by a json service", result)
+	}
+
+	contentType = common.EncryptedContentType
+	defer func() { contentType = common.NormalContentType }()
+
+	result = store(ctx, msg, env)
+
+	if result.Success || result.Error == nil || result.Error.Id != messaging.InvalidPayloadError {
+		t.Error("malformed jwe should be reported", result)
+	}
+
+	msg.ContentType = common.NormalContentType
+	msg.Payload = []byte(`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"]}`)
+	result = store(ctx, msg, env)
+
+	if result.Success || result.Error == nil || result.Error.Id != messaging.WrongContentTypeError {
+		t.Error("json should be rejected by a jwe service", result)
+	}
+}
+
+func TestStoreMessageIdempotency(t *testing.T) {
+	env := testEnvironment(t)
+	ctx := context.Background()
+
+	msg := messaging.StorageServiceStoreMessage{
+		Request:        msgCommon.Request{TenantId: "tenant_space", RequestId: "4"},
+		AccountId:      "ABCD123",
+		Type:           messaging.StoreCredentialType,
+		Payload:        []byte(`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"]}`),
+		ContentType:    common.NormalContentType,
+		Id:             "stored",
+		IdempotencyKey: "message-1",
+	}
+
+	for n := 0; n < 2; n++ {
+		if result := store(ctx, msg, env); !result.Success || result.Version != 1 {
+			t.Error("redelivered message should not create a version", n, result)
+		}
+	}
+
+	msg.IdempotencyKey = "message-2"
+
+	if result := store(ctx, msg, env); !result.Success || result.Version != 2 {
+		t.Error("new message should create a version", result)
+	}
+}
+
+func TestStoreMessageWithoutId(t *testing.T) {
+	env := testEnvironment(t)
+	ctx := context.Background()
+
+	msg := messaging.StorageServiceStoreMessage{
+		Request:     msgCommon.Request{TenantId: "tenant_space", RequestId: "5"},
+		AccountId:   "ABCD123",
+		Type:        messaging.StoreCredentialType,
+		Payload:     []byte(`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"]}`),
+		ContentType: common.NormalContentType,
+	}
+
+	result := store(ctx, msg, env)
+
+	if !result.Success || result.Id == "" {
+		t.Error("store without id should create an item", result)
+	}
+
+	item := get(ctx, messaging.StorageServiceGetMessage{Request: msg.Request, AccountId: "ABCD123", Type: messaging.StoreCredentialType, Id: result.Id}, env)
+
+	if item.Error != nil || item.Credential != string(msg.Payload) {
+		t.Error("created item should be stored", item)
+	}
+}
+
+func testEnvironment(t *testing.T) *common.Environment {
+	env := new(common.Environment)
+	logger, err := logr.New("info", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.SetLogger(*logger)
+	env.SetCryptoNamespace("event")
+	env.SetRepository(repository.NewMemoryRepository())
+	crypto.CreateCryptoProvider(true, nil)
+
+	resolver, err := tenancy.NewResolver(map[string]string{"tenant_space": "tenant_space"}, false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.SetTenantResolver(resolver)
+
+	return env
+}
+
+func TestQueryMessage(t *testing.T) {
+	env := testEnvironment(t)
+
+	credential := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"credentialSubject":{"name":"Bob"}}`
+	authModel := model.AuthModel{Account: "ABCD123", TenantId: "tenant_space", ContentType: common.NormalContentType}
+
+	if _, _, err := services.StoreMessage(context.Background(), "degree", []byte(credential), authModel, env, false, repository.Condition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := messaging.StorageServiceQueryMessage{
+		Request:   msgCommon.Request{TenantId: "tenant_space", RequestId: "1"},
+		AccountId: "ABCD123",
+		Type:      messaging.StoreCredentialType,
+		DcqlQuery: &dcql.Query{Credentials: []dcql.CredentialQuery{{
+			Id:     "name",
+			Format: "ldp_vc",
+			Claims: []dcql.ClaimsQuery{{Path: []interface{}{"credentialSubject", "name"}, Values: []interface{}{"Bob"}}},
+		}}},
+	}
+
+	reply := query(context.Background(), msg, env)
+
+	if reply.Error != nil || reply.RequestId != "1" || len(reply.Matches) != 1 || reply.Matches[0].Credentials["degree"].Data != credential {
+		t.Error("reply is wrong", reply)
+	}
+
+	msg.DcqlQuery = &dcql.Query{}
+	reply = query(context.Background(), msg, env)
+
+	if reply.Error == nil || reply.Error.Status != 400 {
+		t.Error("invalid query should be rejected", reply)
+	}
+}
+
+func TestUnknownTenantMessages(t *testing.T) {
+	env := testEnvironment(t)
+	ctx := context.Background()
+	request := msgCommon.Request{TenantId: "system_schema", RequestId: "4"}
+
+	result := store(ctx, messaging.StorageServiceStoreMessage{Request: request, AccountId: "ABCD123", Type: messaging.StoreCredentialType, Payload: []byte(`{}`), Id: "stored"}, env)
+
+	if result.Success || result.Error == nil || result.Error.Status != 403 || result.Error.Id != messaging.UnknownTenantError {
+		t.Error("store of unknown tenant should be rejected", result)
+	}
+
+	item := get(ctx, messaging.StorageServiceGetMessage{Request: request, AccountId: "ABCD123", Id: "stored"}, env)
+
+	if item.Error == nil || item.Error.Status != 403 {
+		t.Error("get of unknown tenant should be rejected", item)
+	}
+}
+
+func TestRequestMessages(t *testing.T) {
+	env := testEnvironment(t)
+	ctx := context.Background()
+
+	credential := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"credentialSubject":{"name":"Alice"}}`
+	authModel := model.AuthModel{Account: "ABCD123", TenantId: "tenant_space", ContentType: common.NormalContentType}
+	request := msgCommon.Request{TenantId: "tenant_space", RequestId: "2"}
+
+	for _, id := range []string{"a", "b"} {
+		if _, _, err := services.StoreMessage(ctx, id, []byte(credential), authModel, env, false, repository.Condition{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item := get(ctx, messaging.StorageServiceGetMessage{Request: request, AccountId: "ABCD123", Type: messaging.StoreCredentialType, Id: "a"}, env)
+
+	if item.Error != nil || item.RequestId != "2" || item.Credential != credential || item.Format != "ldp_vc" {
+		t.Error("get reply is wrong", item)
+	}
+
+	item = get(ctx, messaging.StorageServiceGetMessage{Request: request, AccountId: "ABCD123", Id: "unknown"}, env)
+
+	if item.Error == nil || item.Error.Status != 404 {
+		t.Error("unknown item should not be found", item)
+	}
+
+	page := list(ctx, messaging.StorageServiceListMessage{Request: request, AccountId: "ABCD123", Type: messaging.StoreCredentialType, Limit: 1}, env)
+
+	if page.Error != nil || len(page.Credentials) != 1 || page.Next == "" {
+		t.Error("list reply is wrong", page)
+	}
+
+	page = list(ctx, messaging.StorageServiceListMessage{Request: request, AccountId: "ABCD123", Limit: 1, Cursor: page.Next}, env)
+
+	if page.Error != nil || page.Credentials["b"] != credential || page.Next != "" {
+		t.Error("second page is wrong", page)
+	}
+
+	result := query(ctx, messaging.StorageServiceQueryMessage{Request: request, AccountId: "ABCD123", PresentationDefinition: &oid4vip.PresentationDefinition{}}, env)
+
+	if result.Error != nil || len(result.Groups) == 0 || len(result.Groups[0].Credentials) != 2 {
+		t.Error("presentation definition reply is wrong", result)
+	}
+
+	deleted := remove(ctx, messaging.StorageServiceDeleteMessage{Request: request, AccountId: "ABCD123", Id: "a"}, env)
+
+	if deleted.Error != nil || deleted.RequestId != "2" {
+		t.Error("delete reply is wrong", deleted)
+	}
+
+	item = get(ctx, messaging.StorageServiceGetMessage{Request: request, AccountId: "ABCD123", Id: "a"}, env)
+
+	if item.Error == nil || item.Error.Status != 404 {
+		t.Error("deleted item should not be found", item)
+	}
+
+	chained := chain(ctx, messaging.StorageServiceChainMessage{Request: request, AccountId: "ABCD123"}, env)
+
+	if chained.Error == nil {
+		t.Error("chain without root should be rejected", chained)
+	}
+}
+
+func TestStoreRequest(t *testing.T) {
+	e, err := cloudeventprovider.NewEvent("test", messaging.StoreCredentialType, []byte(`{"payload":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replyEvent, err := requestHandler(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result messaging.StorageServiceStoreResult
+	if err := json.Unmarshal(replyEvent.Data(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if replyEvent.Type() != messaging.StoreResultType || result.Success || result.Error == nil || result.Error.Status != 400 {
+		t.Error("malformed store request should be rejected", replyEvent.Type(), result)
+	}
+}
+
+func TestMalformedRequest(t *testing.T) {
+	e, err := cloudeventprovider.NewEvent("test", messaging.GetType, []byte(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replyEvent, err := requestHandler(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply messaging.StorageServiceGetReply
+	if err := json.Unmarshal(replyEvent.Data(), &reply); err != nil {
+		t.Fatal(err)
+	}
 
+	if replyEvent.Type() != messaging.GetReplyType || reply.Error == nil || reply.Error.Status != 400 {
+		t.Error("malformed request should be rejected", replyEvent.Type(), reply)
+	}
 }
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+const tenantExistsError = "Tenant already exists."
+const tenantNotFoundError = "Tenant not found."
+const tenantError = "Error during tenant administration."
+
+/*
+CreateTenant provisions the storage of a tenant, in Cassandra its keyspace with tables and indexes. Tenants without
+replication get the given default.
+*/
+func CreateTenant(c *gin.Context, env *common.Environment, replication repository.Replication) {
+	body, err := handlers.ExtractBody(c.Request)
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, handlers.NoBodyError, err)
+		return
+	}
+
+	var tenant model.TenantModel
+
+	if err := json.Unmarshal(body, &tenant); err != nil {
+		_ = handlers.ErrorResponse(c, handlers.BodyParseError, err)
+		return
+	}
+
+	if tenant.Replication == nil {
+		tenant.Replication = &replication
+	}
+
+	err = env.GetRepository().CreateTenant(c.Request.Context(), repository.Tenant{
+		Name:        tenant.Name,
+		Replication: *tenant.Replication,
+		Metadata:    tenant.Metadata,
+	})
+
+	switch {
+	case errors.Is(err, repository.ErrInvalidTenant):
+		_ = handlers.ErrorResponse(c, err.Error(), err)
+	case errors.Is(err, repository.ErrExists):
+		_ = handlers.ConflictResponse(c, tenantExistsError, err)
+	case err != nil:
+		_ = handlers.InternalErrorResponse(c, tenantError, err)
+	default:
+		env.GetTenantResolver().Forget(tenant.Name)
+		GetTenant(c, env, tenant.Name, 201)
+	}
+}
+
+func ListTenants(c *gin.Context, env *common.Environment) {
+	tenants, err := env.GetRepository().ListTenants(c.Request.Context())
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, tenantError, err)
+		return
+	}
+
+	result := make([]model.TenantModel, 0, len(tenants))
+	for _, tenant := range tenants {
+		result = append(result, tenantModel(tenant))
+	}
+
+	c.JSON(200, result)
+}
+
+func GetTenant(c *gin.Context, env *common.Environment, name string, status int) {
+	tenant, err := env.GetRepository().LoadTenant(c.Request.Context(), name)
+
+	if errors.Is(err, repository.ErrNotFound) {
+		_ = handlers.NotFoundResponse(c, tenantNotFoundError, err)
+		return
+	}
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, tenantError, err)
+		return
+	}
+
+	c.JSON(status, tenantModel(*tenant))
+}
+
+// DeleteTenant removes a tenant with all accounts and items, in Cassandra by dropping its keyspace.
+func DeleteTenant(c *gin.Context, env *common.Environment, name string) {
+	err := env.GetRepository().DeleteTenant(c.Request.Context(), name)
+
+	if errors.Is(err, repository.ErrNotFound) {
+		_ = handlers.NotFoundResponse(c, tenantNotFoundError, err)
+		return
+	}
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, tenantError, err)
+		return
+	}
+
+	env.GetTenantResolver().Forget(name)
+	c.Status(204)
+}
+
+func tenantModel(tenant repository.Tenant) model.TenantModel {
+	result := model.TenantModel{
+		Name:        tenant.Name,
+		Replication: &tenant.Replication,
+		Metadata:    tenant.Metadata,
+	}
+
+	if !tenant.Created.IsZero() {
+		created := tenant.Created.UTC().Truncate(time.Second)
+		result.Created = &created
+	}
+
+	return result
+}
@@ -12,6 +12,14 @@ const (
 	WrongContentType                  = "Wrong Content Type."
 	DeviceAlreadyExist                = "Device already exist."
 	DeviceRegistrationFailed          = "Device Registration failed."
+	DeviceDeletionFailed              = "Device Deletion failed."
+	AccountDeletionFailed             = "Account Deletion failed."
+	DeviceNotFound                    = "Device not found."
+	LastDeviceRevocation              = "The last device can not be revoked, delete the account instead."
+	NonceNotValid                     = "Nonce not valid."
 	InvalidKeySigningAlgorithm        = "Invalid Key Signing Algorithm"
 	CryptoProviderError               = "Error happened in Crypto Provider"
+	InvalidPrecondition               = "Invalid If-Match or If-None-Match header."
+	VersionMismatch                   = "Item version does not match."
+	ItemAlreadyExists                 = "Item already exists."
 )
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
 	"github.com/gin-gonic/gin"
 )
 
@@ -33,3 +34,61 @@ func InternalErrorResponse(c *gin.Context, err string, exception error) error {
 	})
 	return errors.New(err)
 }
+
+func NotFoundResponse(c *gin.Context, err string, exception error) error {
+	env := common.GetEnvironment()
+	log := env.GetLogger()
+	log.Debug(err, "Error", exception)
+
+	c.JSON(404, gin.H{
+		"message": err,
+	})
+	return errors.New(err)
+}
+
+func ConflictResponse(c *gin.Context, err string, exception error) error {
+	env := common.GetEnvironment()
+	log := env.GetLogger()
+	log.Debug(err, "Error", exception)
+
+	c.JSON(409, gin.H{
+		"message": err,
+	})
+	return errors.New(err)
+}
+
+func PreconditionFailedResponse(c *gin.Context, err string, exception error) error {
+	env := common.GetEnvironment()
+	log := env.GetLogger()
+	log.Debug(err, "Error", exception)
+
+	c.JSON(412, gin.H{
+		"message": err,
+	})
+	return errors.New(err)
+}
+
+// TooLargeResponse answers a request whose body exceeds a limit of the route.
+func TooLargeResponse(c *gin.Context, err string, exception error) error {
+	env := common.GetEnvironment()
+	log := env.GetLogger()
+	log.Debug(err, "Error", exception)
+
+	c.JSON(413, gin.H{
+		"message": err,
+	})
+	return errors.New(err)
+}
+
+// ReceiptErrorResponse answers a failed request whose nonce was renewed already, the receipt carries the new nonce.
+func ReceiptErrorResponse(c *gin.Context, status int, err string, receipt *model.Receipt, exception error) error {
+	env := common.GetEnvironment()
+	log := env.GetLogger()
+	log.Debug(err, "Error", exception)
+
+	c.JSON(status, gin.H{
+		"message": err,
+		"receipt": receipt.Receipt,
+	})
+	return errors.New(err)
+}
@@ -3,8 +3,6 @@ package handlers
 import (
 	"context"
 	b64 "encoding/base64"
-	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
@@ -14,7 +12,7 @@ import (
 
 func CreateTransactionReciept(ctx context.Context, authModel model.AuthModel, env *common.Environment) *model.Receipt {
 	log := env.GetLogger()
-	nonce, err := crypto.GenerateNonce(env.GetCryptoNamespace(), common.StorageCryptoContext, ctx)
+	nonce, err := crypto.GenerateNonce(env.GetCryptoNamespace(authModel.TenantId), common.StorageCryptoContext, ctx)
 
 	if err == nil {
 		expire := time.Now().Add(time.Minute * 5)
@@ -23,25 +21,13 @@ func CreateTransactionReciept(ctx context.Context, authModel model.AuthModel, en
 			Expire: expire.Unix(),
 		}
 
-		session := env.GetSession()
+		repo := env.GetRepository()
 
-		if session == nil {
+		if repo == nil {
 			return nil
 		}
 
-		queryString := fmt.Sprintf(`UPDATE %s.credentials USING TTL %s SET nonce=? WHERE accountPartition=? AND 
-																					region=? AND 
-																					country=? AND
-																					account=?;`,
-			authModel.TenantId,
-			strconv.Itoa(5*60))
-
-		err := session.Query(queryString,
-			b64.StdEncoding.EncodeToString([]byte(nonce)),
-			env.GetAccountPartition(authModel.Account),
-			env.GetRegion(),
-			env.GetCountry(),
-			authModel.Account).WithContext(ctx).Exec()
+		err := repo.SetNonce(ctx, env.GetAccountKey(authModel), authModel.DeviceId, b64.StdEncoding.EncodeToString([]byte(nonce)), time.Minute*5)
 
 		if err == nil {
 
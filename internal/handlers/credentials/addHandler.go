@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"errors"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/lestrrat-go/jwx/v2/jwa"
@@ -13,74 +18,209 @@ import (
 )
 
 func add(c *gin.Context, env *common.Environment, presentation bool) {
-	contentType := c.GetHeader("Content-Type")
-	if contentType != env.GetContentType() {
+	body, ok := storeBody(c, env)
+
+	if ok {
+		store(c, env, presentation, c.Param("id"), body)
+	}
+}
+
+// CreatePath is the route creating items in direct mode, where POST on the collection queries.
+const CreatePath = "/create"
+
+// create stores the body under an id chosen by the service.
+func create(c *gin.Context, env *common.Environment, presentation bool) {
+	body, ok := storeBody(c, env)
+
+	if ok {
+		store(c, env, presentation, "", body)
+	}
+}
+
+func storeBody(c *gin.Context, env *common.Environment) ([]byte, bool) {
+	authModel := c.Request.Context().Value(model.AuthModelKey).(model.AuthModel)
+
+	if c.GetHeader("Content-Type") != authModel.ContentType {
 		_ = handlers.ErrorResponse(c, handlers.WrongContentType, errors.New(""))
-		return
+		return nil, false
+	}
+
+	body, err := handlers.ExtractBody(c.Request)
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, handlers.NoBodyError, err)
+		return nil, false
 	}
-	ctx := c.Request.Context()
 
-	id := c.Param("id")
+	return body, true
+}
+
+/*
+store saves the body under the id. Without id the service chooses one and answers with 201, the location of the
+item and in direct mode its id.
+*/
+func store(c *gin.Context, env *common.Environment, presentation bool, id string, body []byte) {
+	ctx := c.Request.Context()
 
 	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
 
-	body, err := handlers.ExtractBody(c.Request)
-	if err == nil {
-		if contentType == common.EncryptedContentType {
-			msg, err := jwe.Parse(body)
-			if err == nil {
-				if msg.ProtectedHeaders().Algorithm() == jwa.ECDH_ES_A256KW {
-					if msg.ProtectedHeaders().ContentEncryption() == jwa.ContentEncryptionAlgorithm(jwa.A256GCM) {
-						recipients := msg.Recipients()
-						if len(recipients) == 1 {
-							receipt, err := services.StoreMessage(ctx, id, body, authModel, env, presentation)
-							if err == nil && receipt != nil {
-								c.Header("Content-Type", common.EncryptedContentType)
-								c.String(200, receipt.Receipt)
-								return
-							} else {
-								_ = handlers.ErrorResponse(c, handlers.StoreMessageFailed, err)
-								return
-							}
-						} else {
-							_ = handlers.ErrorResponse(c, handlers.InvalidAmountOfRecipients, err)
-							return
-						}
-					} else {
-						_ = handlers.ErrorResponse(c, handlers.InvalidContentEncryptionAlgorithm, err)
-						return
-					}
-				} else {
-					_ = handlers.ErrorResponse(c, handlers.InvalidKeyEncryptionAlgorithm, err)
-					return
-				}
-			} else {
-				_ = handlers.ErrorResponse(c, handlers.BodyParseError, err)
-				return
-			}
+	condition, ok := storeCondition(c)
+
+	if !ok {
+		return
+	}
+
+	save := func() (*model.Receipt, int64, error) {
+		if id != "" {
+			return services.StoreMessage(ctx, id, body, authModel, env, presentation, condition)
 		}
 
-		if contentType == common.NormalContentType {
+		var receipt *model.Receipt
+		var version int64
+		var err error
+		id, receipt, version, err = services.CreateMessage(ctx, body, authModel, env, presentation, condition)
+		return receipt, version, err
+	}
+	created := id == ""
+
+	if authModel.ContentType == common.EncryptedContentType {
+		if problem, err := checkJwe(body); err != nil {
+			_ = handlers.ErrorResponse(c, problem, err)
+			return
+		}
+
+		receipt, version, err := save()
+		if storeConflict(c, err, receipt) {
+			return
+		}
+		if err != nil && receipt != nil {
+			_ = handlers.ReceiptErrorResponse(c, 400, handlers.StoreMessageFailed, receipt, err)
+			return
+		}
+		if err != nil || receipt == nil {
+			_ = handlers.ErrorResponse(c, handlers.StoreMessageFailed, err)
+			return
+		}
+		c.Header("Content-Type", common.EncryptedContentType)
+		c.Header("ETag", etag(version))
+		if created {
+			c.Header("Location", location(c, id))
+			c.String(201, receipt.Receipt)
+			return
+		}
+		c.String(200, receipt.Receipt)
+		return
+	}
+
+	_, version, err := save()
+	if storeConflict(c, err, nil) {
+		return
+	}
+	if errors.Is(err, metadata.ErrInvalidFormat) {
+		_ = handlers.ErrorResponse(c, err.Error(), err)
+		return
+	}
+	if err != nil {
+		_ = handlers.ErrorResponse(c, handlers.StoreMessageFailed, err)
+		return
+	}
+	c.Header("ETag", etag(version))
+	if created {
+		c.Header("Location", location(c, id))
+		c.JSON(201, model.CreatedModel{Id: id})
+	}
+}
+
+/*
+checkJwe accepts only JWEs which are encrypted by the device for itself, with ECDH-ES+A256KW, A256GCM and a single
+recipient. Returns the message of the violated rule.
+*/
+func checkJwe(body []byte) (string, error) {
+	msg, err := jwe.Parse(body)
+
+	switch {
+	case err != nil:
+		return handlers.BodyParseError, err
+	case msg.ProtectedHeaders().Algorithm() != jwa.ECDH_ES_A256KW:
+		return handlers.InvalidKeyEncryptionAlgorithm, errors.New(handlers.InvalidKeyEncryptionAlgorithm)
+	case msg.ProtectedHeaders().ContentEncryption() != jwa.ContentEncryptionAlgorithm(jwa.A256GCM):
+		return handlers.InvalidContentEncryptionAlgorithm, errors.New(handlers.InvalidContentEncryptionAlgorithm)
+	case len(msg.Recipients()) != 1:
+		return handlers.InvalidAmountOfRecipients, errors.New(handlers.InvalidAmountOfRecipients)
+	}
+
+	return "", nil
+}
+
+// location is the path of the created item below the collection of the request.
+func location(c *gin.Context, id string) string {
+	collection := strings.TrimSuffix(strings.TrimSuffix(c.Request.URL.Path, "/"), CreatePath)
+	return collection + "/" + url.PathEscape(id)
+}
+
+// etag formats the version of an item as entity tag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+/*
+storeCondition reads the preconditions of a store. If-None-Match: * only creates the item, If-Match requires the
+item to exist, with an entity tag in the given version.
+*/
+func storeCondition(c *gin.Context) (repository.Condition, bool) {
+	var condition repository.Condition
+
+	if noneMatch := c.GetHeader("If-None-Match"); noneMatch != "" {
+		if noneMatch != "*" {
+			_ = handlers.ErrorResponse(c, handlers.InvalidPrecondition, errors.New(handlers.InvalidPrecondition))
+			return condition, false
+		}
+		condition.Absent = true
+	}
+
+	if match := c.GetHeader("If-Match"); match != "" {
+		condition.Exists = true
+
+		if match != "*" {
+			version, err := strconv.Unquote(match)
+
 			if err == nil {
-				_, err := services.StoreMessage(ctx, id, body, authModel, env, presentation)
-				if err != nil {
-					_ = handlers.ErrorResponse(c, handlers.StoreMessageFailed, err)
-					return
-				}
-				return
-			} else {
-				_ = handlers.ErrorResponse(c, handlers.BodyParseError, err)
-				return
+				condition.Version, err = strconv.ParseInt(version, 10, 64)
+			}
+
+			if err != nil || condition.Version < 1 {
+				_ = handlers.ErrorResponse(c, handlers.InvalidPrecondition, errors.New(handlers.InvalidPrecondition))
+				return condition, false
 			}
 		}
 	}
 
-	_ = handlers.ErrorResponse(c, handlers.NoBodyError, err)
+	return condition, true
+}
+
+/*
+storeConflict answers failed preconditions with 412 and existing items of a create with 409. The receipt of a remote
+device is part of the answer, its nonce was renewed before the store.
+*/
+func storeConflict(c *gin.Context, err error, receipt *model.Receipt) bool {
+	switch {
+	case errors.Is(err, repository.ErrVersionMismatch) && receipt != nil:
+		_ = handlers.ReceiptErrorResponse(c, 412, handlers.VersionMismatch, receipt, err)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		_ = handlers.PreconditionFailedResponse(c, handlers.VersionMismatch, err)
+	case errors.Is(err, repository.ErrExists) && receipt != nil:
+		_ = handlers.ReceiptErrorResponse(c, 409, handlers.ItemAlreadyExists, receipt, err)
+	case errors.Is(err, repository.ErrExists):
+		_ = handlers.ConflictResponse(c, handlers.ItemAlreadyExists, err)
+	default:
+		return false
+	}
+	return true
 }
 
 // AddPresentation  godoc
 // @Summary Add a presentation to the storage
-// @Description Add a presentation to the storage
+// @Description Add a presentation to the storage. In direct mode the format is detected and validated, supported are W3C JSON-LD, VC-JWT, JWT VP, SD-JWT VC and mdoc.
 // @Tags presentations
 // @Accept  application/json
 // @Param Content-Type header string true "application/json"
@@ -88,8 +228,13 @@ func add(c *gin.Context, env *common.Environment, presentation bool) {
 // @Param account path string true "Account ID"
 // @Param tenantId path string true "Tenant ID"
 // @Param id path string true "ID of the presentation"
+// @Param If-Match header string false "Entity tag of the expected version, or * for an existing item"
+// @Param If-None-Match header string false "* stores only a new item"
 // @Success 200 {string} string "Receipt"
-// @Failure 400 {string} string "Bad Request"
+// @Header 200 {string} ETag "Version of the stored item"
+// @Failure 400 {string} string "Bad Request, e.g. an unsupported or malformed format"
+// @Failure 409 {string} string "Conflict, the item exists already"
+// @Failure 412 {string} string "Precondition Failed, the version does not match"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /presentations/{id} [put]
 func AddPresentation(c *gin.Context, env *common.Environment) {
@@ -98,7 +243,7 @@ func AddPresentation(c *gin.Context, env *common.Environment) {
 
 // AddCredential  godoc
 // @Summary Add a credential to the storage
-// @Description Add a credential to the storage
+// @Description Add a credential to the storage. In direct mode the format is detected and validated, supported are W3C JSON-LD, VC-JWT, JWT VP, SD-JWT VC and mdoc.
 // @Tags credentials
 // @Accept  application/json
 // @Param Content-Type header string true "application/json"
@@ -106,10 +251,55 @@ func AddPresentation(c *gin.Context, env *common.Environment) {
 // @Param account path string true "Account ID"
 // @Param tenantId path string true "Tenant ID"
 // @Param id path string true "ID of the credential"
+// @Param If-Match header string false "Entity tag of the expected version, or * for an existing item"
+// @Param If-None-Match header string false "* stores only a new item"
 // @Success 200 {string} string "OK"
-// @Failure 400 {string} string "Bad Request"
+// @Header 200 {string} ETag "Version of the stored item"
+// @Failure 400 {string} string "Bad Request, e.g. an unsupported or malformed format"
+// @Failure 409 {string} string "Conflict, the item exists already"
+// @Failure 412 {string} string "Precondition Failed, the version does not match"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /credentials/{id} [put]
 func AddCredential(c *gin.Context, env *common.Environment) {
 	add(c, env, false)
 }
+
+// CreatePresentation godoc
+// @Summary Create a presentation with an id chosen by the service
+// @Description Store a presentation like on PUT under an id derived from its id or jti, or a generated one. In direct mode POST on the collection is the query route, so presentations are created on this route, in remote mode by POST on the collection.
+// @Tags presentations
+// @Accept  application/json
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param data body string true "The presentation raw data to upload"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Success 201 {object} model.CreatedModel "id of the stored presentation"
+// @Header 201 {string} Location "Path of the stored presentation"
+// @Header 201 {string} ETag "Version of the stored item"
+// @Failure 400 {string} string "Bad Request, e.g. an unsupported or malformed format"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /presentations/create [post]
+func CreatePresentation(c *gin.Context, env *common.Environment) {
+	create(c, env, true)
+}
+
+// CreateCredential godoc
+// @Summary Create a credential with an id chosen by the service
+// @Description Store a credential like on PUT under an id derived from its id or jti, or a generated one. In direct mode POST on the collection is the query route, so credentials are created on this route, in remote mode by POST on the collection.
+// @Tags credentials
+// @Accept  application/json
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param data body string true "The VerifiableCredential raw data to upload"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Success 201 {object} model.CreatedModel "id of the stored credential"
+// @Header 201 {string} Location "Path of the stored credential"
+// @Header 201 {string} ETag "Version of the stored item"
+// @Failure 400 {string} string "Bad Request, e.g. an unsupported or malformed format"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /credentials/create [post]
+func CreateCredential(c *gin.Context, env *common.Environment) {
+	create(c, env, false)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+const NdjsonContentType = "application/x-ndjson"
+
+const exportError = "Error during export."
+const archiveParseError = "Archive could not be parsed."
+const invalidConflictPolicyError = "Invalid conflict parameter."
+const deviceKeyMissingError = "Device key not present."
+const receiptError = "Receipt Failure"
+const archiveTooLargeError = "Archive too large."
+
+// maxArchiveLine limits the size of a single item of an NDJSON archive.
+const maxArchiveLine = 16 << 20
+
+// maxArchiveSize limits the body of an import, maxArchiveItems the number of items stored by one import.
+const maxArchiveSize = 64 << 20
+const maxArchiveItems = 10000
+
+var errTooManyItems = errors.New("archive has too many items")
+
+func export(c *gin.Context, env *common.Environment) {
+	ctx := c.Request.Context()
+	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
+
+	archive, err := services.ExportArchive(ctx, authModel, env)
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, exportError, err)
+		return
+	}
+
+	if authModel.ContentType == common.EncryptedContentType {
+		if authModel.Device_Key == nil {
+			_ = handlers.ErrorResponse(c, deviceKeyMissingError, errors.New(deviceKeyMissingError))
+			return
+		}
+
+		// the export is a read of the device, it renews the nonce like every other read
+		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+		if receipt == nil {
+			_ = handlers.InternalErrorResponse(c, exportError, errors.New(receiptError))
+			return
+		}
+
+		archive.Receipt = receipt.Receipt
+
+		msg, err := crypto.CreateJweMessage(archive, *authModel.Device_Key)
+
+		if err != nil || msg == nil {
+			_ = handlers.InternalErrorResponse(c, exportError, err)
+			return
+		}
+
+		compact, err := jwe.Compact(msg)
+
+		if err != nil {
+			_ = handlers.InternalErrorResponse(c, exportError, err)
+			return
+		}
+
+		c.Data(200, common.EncryptedContentType, compact)
+		return
+	}
+
+	if !strings.Contains(c.GetHeader("Accept"), NdjsonContentType) {
+		c.JSON(200, archive)
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+
+	for _, item := range archive.Items {
+		if err := encoder.Encode(item); err != nil {
+			_ = handlers.InternalErrorResponse(c, exportError, err)
+			return
+		}
+	}
+
+	c.Data(200, NdjsonContentType, buffer.Bytes())
+}
+
+func archiveImport(c *gin.Context, env *common.Environment) {
+	ctx := c.Request.Context()
+	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
+
+	policy, err := services.ParseConflictPolicy(c.Query("conflict"))
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, invalidConflictPolicyError, err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxArchiveSize)
+	body, err := handlers.ExtractBody(c.Request)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		_ = handlers.TooLargeResponse(c, archiveTooLargeError, err)
+		return
+	}
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, handlers.NoBodyError, err)
+		return
+	}
+
+	items, err := archiveItems(c.ContentType(), body)
+
+	if errors.Is(err, errTooManyItems) {
+		_ = handlers.TooLargeResponse(c, archiveTooLargeError, err)
+		return
+	}
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, archiveParseError, err)
+		return
+	}
+
+	result := model.ImportResultModel{Items: make([]model.ImportItemResult, 0, len(items))}
+
+	if authModel.ContentType == common.EncryptedContentType {
+		// one receipt for the whole import, the items are stored without renewing the nonce
+		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+		if receipt == nil {
+			_ = handlers.InternalErrorResponse(c, handlers.StoreMessageFailed, errors.New(receiptError))
+			return
+		}
+
+		result.Receipt = receipt.Receipt
+	}
+
+	for _, item := range items {
+		if authModel.ContentType == common.EncryptedContentType {
+			// the items stay encrypted by the device, so they are checked like a PUT
+			if problem, err := checkJwe([]byte(item.Content)); err != nil {
+				result.Items = append(result.Items, model.ImportItemResult{Kind: item.Kind, Id: item.Id, Status: model.ImportFailed, Error: problem})
+				continue
+			}
+		}
+
+		result.Items = append(result.Items, services.ImportItem(ctx, authModel, env, item, policy))
+	}
+
+	c.JSON(200, result)
+}
+
+/*
+archiveItems reads the items of an archive object or of an NDJSON stream with one item per line. Archives with more
+than maxArchiveItems items are refused with errTooManyItems, NDJSON streams are not read beyond the limit.
+*/
+func archiveItems(contentType string, body []byte) ([]model.ArchiveItem, error) {
+	switch contentType {
+	case common.NormalContentType:
+		var archive model.ArchiveModel
+		if err := json.Unmarshal(body, &archive); err != nil {
+			return nil, err
+		}
+
+		if len(archive.Items) > maxArchiveItems {
+			return nil, errTooManyItems
+		}
+		return archive.Items, nil
+	case NdjsonContentType:
+		items := make([]model.ArchiveItem, 0)
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(nil, maxArchiveLine)
+
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+
+			if len(line) == 0 {
+				continue
+			}
+
+			if len(items) == maxArchiveItems {
+				return nil, errTooManyItems
+			}
+
+			var item model.ArchiveItem
+			if err := json.Unmarshal(line, &item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+
+		return items, scanner.Err()
+	}
+
+	return nil, errors.New(badContentTypeError)
+}
+
+// Export godoc
+// @Summary Export all credentials and presentations of the account
+// @Description Export all credentials and presentations of the account with their metadata as archive. In remote mode the archive is returned as JWE encrypted for the device key with the receipt of the renewed nonce, in direct mode as JSON or, with Accept application/x-ndjson, as one item per line.
+// @Tags archive
+// @Produce json
+// @Produce application/x-ndjson
+// @Produce application/jose
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Success 200 {object} model.ArchiveModel "archive"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /archive [get]
+func Export(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
+	return g.GET("", func(c *gin.Context) {
+		export(c, env)
+	})
+}
+
+// Import godoc
+// @Summary Import an archive into the account
+// @Description Import the items of an archive as exported, as JSON object or with content type application/x-ndjson as one item per line. In remote mode the archive is the decrypted export, its items must be JWEs like on PUT. The items are validated and stored like on PUT, the result reports the outcome of each item. In remote mode the nonce is renewed once per import and the result carries its receipt. Archives above 64 MiB or with more than 10000 items are refused with 413.
+// @Tags archive
+// @Accept json
+// @Accept application/x-ndjson
+// @Produce json
+// @Param request body model.ArchiveModel true "archive"
+// @Param conflict query string false "Handling of existing ids: skip (default), overwrite or rename"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Success 200 {object} model.ImportResultModel "result per item"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Archive too large"
+// @Router /archive [post]
+func Import(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
+	return g.POST("", func(c *gin.Context) {
+		archiveImport(c, env)
+	})
+}
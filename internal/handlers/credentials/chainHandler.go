@@ -7,6 +7,7 @@ import (
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
 
 	"github.com/gin-gonic/gin"
@@ -17,14 +18,15 @@ const NoValidChain = "No chain building possible"
 const CredentialNotFound = "Credential not found"
 
 func Chain(c *gin.Context, env *common.Environment) {
+	ctx := c.Request.Context()
+
+	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
+
 	contentType := c.GetHeader("Content-Type")
-	if contentType != env.GetContentType() {
+	if contentType != authModel.ContentType {
 		_ = handlers.ErrorResponse(c, handlers.WrongContentType, errors.New(""))
 		return
 	}
-	ctx := c.Request.Context()
-
-	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
 
 	body, err := handlers.ExtractBody(c.Request)
 	if err == nil {
@@ -61,7 +63,7 @@ func ChainCredentials(ctx context.Context, chainStatement model.ChainStatement,
 		return nil, errors.New(handlers.InvalidRequest)
 	}
 
-	credentials, err := getCredentials(ctx, authModel, env, nil, false)
+	credentials, err := GetCredentialsModel(ctx, authModel, env, nil, metadata.Query{}, false, false)
 
 	if err != nil {
 		return nil, err
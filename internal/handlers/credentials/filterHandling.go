@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
+
+	oid4vip "github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
+)
+
+/*
+filterCredentials applies the presentation definition on the decoded claim sets of the credentials, so that
+constraints match SD-JWT and JWT credentials like JSON-LD ones. The filter runs once per format, the results
+carry the detected format and the original serialized credential. Credentials which can not be decoded are skipped.
+*/
+func filterCredentials(env *common.Environment, filter *oid4vip.PresentationDefinition, credentials map[string]interface{}) ([]oid4vip.FilterResult, error) {
+	logger := env.GetLogger()
+
+	if filter == nil {
+		filter = &oid4vip.PresentationDefinition{}
+	}
+
+	groups := make(map[string]map[string]interface{})
+
+	for id, credential := range credentials {
+		serialized, _ := credential.(string)
+		format, claims, err := metadata.Claims([]byte(serialized))
+
+		if err != nil {
+			logger.Info("Credential skipped in filter", "id", id, "error", err.Error())
+			continue
+		}
+
+		decoded, err := json.Marshal(claims)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if groups[format] == nil {
+			groups[format] = make(map[string]interface{})
+		}
+
+		groups[format][id] = string(decoded)
+	}
+
+	formats := make([]string, 0, len(groups))
+	for format := range groups {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	results := make([]oid4vip.FilterResult, 0)
+
+	for _, format := range formats {
+		res, err := filter.Filter(groups[format])
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range res {
+			r.Description.FormatType = format
+			for id := range r.Credentials {
+				r.Credentials[id] = oid4vip.CredentialResult{
+					Type: format,
+					Data: credentials[id],
+				}
+			}
+			results = append(results, r)
+		}
+	}
+
+	return results, nil
+}
@@ -2,43 +2,101 @@ package handlers
 
 import (
 	"context"
-	b64 "encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
-	"github.com/eclipse-xfsc/credential-storage-service/internal/connection"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/dcql"
 
 	oid4vip "github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
 	"github.com/gin-gonic/gin"
-	"github.com/gocql/gocql"
+	"github.com/lestrrat-go/jwx/v2/jwe"
 )
 
 const getError = "Error during record get."
 const badContentTypeError = "Bad content type"
 const badBodyError = "Body error"
+const invalidPagingError = "Invalid paging parameters."
+const itemNotFoundError = "Item not found."
+const metadataDisabledError = "Metadata filter not enabled."
+const invalidIncludeExpiredError = "Invalid includeExpired parameter."
 
 func Get(c *gin.Context, env *common.Environment, presentation bool) any {
 	ctx := c.Request.Context()
 	authModel := c.Request.Context().Value(model.AuthModelKey).(model.AuthModel)
 
-	if c.ContentType() != common.EncryptedContentType {
+	if c.ContentType() != authModel.ContentType {
 		handlers.ErrorResponse(c, badContentTypeError, errors.New(badContentTypeError))
 		return nil
 	}
 
-	model, err := getCredentials(ctx, authModel, env, nil, presentation)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+
+	if err != nil || limit < 0 {
+		handlers.ErrorResponse(c, invalidPagingError, err)
+		return nil
+	}
+
+	query, ok := metadataQuery(c, env)
+
+	if !ok {
+		return nil
+	}
+
+	includeExpired, ok := includeExpiredQuery(c)
+
+	if !ok {
+		return nil
+	}
+
+	model, err := GetPageModel(ctx, authModel, env, presentation, limit, c.Query("cursor"), query, includeExpired)
+
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		handlers.ErrorResponse(c, invalidPagingError, err)
+		return nil
+	}
+
+	if err != nil {
+		handlers.ErrorResponse(c, getError, err)
+		return nil
+	}
+
+	respond(c, env, authModel, model)
+
+	return nil
+}
+
+func GetItem(c *gin.Context, env *common.Environment, presentation bool) any {
+	ctx := c.Request.Context()
+	authModel := c.Request.Context().Value(model.AuthModelKey).(model.AuthModel)
+
+	if c.ContentType() != authModel.ContentType {
+		handlers.ErrorResponse(c, badContentTypeError, errors.New(badContentTypeError))
+		return nil
+	}
+
+	model, err := GetItemModel(ctx, authModel, env, c.Param("id"), presentation)
+
+	if errors.Is(err, repository.ErrNotFound) {
+		handlers.NotFoundResponse(c, itemNotFoundError, err)
+		return nil
+	}
 
 	if err != nil {
 		handlers.ErrorResponse(c, getError, err)
 		return nil
 	}
 
-	c.JSON(200, model)
+	c.Header("ETag", etag(model.Version))
+	respond(c, env, authModel, model)
 
 	return nil
 }
@@ -47,11 +105,23 @@ func post(c *gin.Context, env *common.Environment, presentation bool) any {
 	ctx := c.Request.Context()
 	authModel := c.Request.Context().Value(model.AuthModelKey).(model.AuthModel)
 
-	if c.ContentType() != common.NormalContentType {
+	if c.ContentType() != common.NormalContentType && c.ContentType() != common.DcqlContentType {
 		handlers.ErrorResponse(c, badContentTypeError, errors.New(badContentTypeError))
 		return nil
 	}
 
+	query, ok := metadataQuery(c, env)
+
+	if !ok {
+		return nil
+	}
+
+	includeExpired, ok := includeExpiredQuery(c)
+
+	if !ok {
+		return nil
+	}
+
 	body, err := handlers.ExtractBody(c.Request)
 
 	if err != nil {
@@ -59,6 +129,30 @@ func post(c *gin.Context, env *common.Environment, presentation bool) any {
 		return nil
 	}
 
+	dcqlQuery, err := dcqlBody(c.ContentType(), body)
+
+	if err != nil {
+		handlers.ErrorResponse(c, badBodyError, err)
+		return nil
+	}
+
+	if dcqlQuery != nil {
+		model, err := services.QueryCredentials(ctx, authModel, env, dcqlQuery, query, includeExpired, presentation)
+
+		if errors.Is(err, dcql.ErrInvalidQuery) {
+			handlers.ErrorResponse(c, err.Error(), err)
+			return nil
+		}
+
+		if err != nil {
+			handlers.ErrorResponse(c, getError, err)
+			return nil
+		}
+
+		respond(c, env, authModel, model)
+		return nil
+	}
+
 	var payload oid4vip.PresentationDefinition
 
 	if len(body) > 0 {
@@ -70,97 +164,142 @@ func post(c *gin.Context, env *common.Environment, presentation bool) any {
 		}
 	}
 
-	model, err := getCredentials(ctx, authModel, env, &payload, presentation)
+	model, err := GetCredentialsModel(ctx, authModel, env, &payload, query, includeExpired, presentation)
 
 	if err != nil {
 		handlers.ErrorResponse(c, getError, err)
 		return nil
 	}
 
-	c.JSON(200, model)
+	respond(c, env, authModel, model)
 
 	return nil
 }
 
-func getCredentials(ctx context.Context, authModel model.AuthModel, env *common.Environment, filter *oid4vip.PresentationDefinition, presentation bool) (*model.GetCredentialModel, error) {
+/*
+respond answers with the model as JSON. When the items are stored end-to-end the model is encrypted for the device
+key, so that neither the items nor their metadata leave the service readable for anyone but the device.
+*/
+func respond(c *gin.Context, env *common.Environment, authModel model.AuthModel, body any) {
+	if !services.EndToEnd(authModel, env) {
+		c.JSON(200, body)
+		return
+	}
+
+	if authModel.Device_Key == nil {
+		_ = handlers.ErrorResponse(c, deviceKeyMissingError, errors.New(deviceKeyMissingError))
+		return
+	}
+
+	msg, err := crypto.CreateJweMessage(body, *authModel.Device_Key)
+
+	var compact []byte
+	if err == nil && msg != nil {
+		compact, err = jwe.Compact(msg)
+	}
+
+	if err != nil || compact == nil {
+		_ = handlers.InternalErrorResponse(c, getError, err)
+		return
+	}
+
+	c.Data(200, common.EncryptedContentType, compact)
+}
+
+/*
+dcqlBody reads a DCQL query, which is either the whole body of the DCQL content type or the dcql_query member of a
+JSON body. Returns nil when the body is a presentation definition.
+*/
+func dcqlBody(contentType string, body []byte) (*dcql.Query, error) {
+	if contentType == common.DcqlContentType {
+		var query dcql.Query
+		return &query, json.Unmarshal(body, &query)
+	}
+
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	var request struct {
+		DcqlQuery *dcql.Query `json:"dcql_query"`
+	}
+
+	return request.DcqlQuery, json.Unmarshal(body, &request)
+}
+
+// metadataQuery reads the metadata filter from the query parameters and rejects it when no index is maintained.
+func metadataQuery(c *gin.Context, env *common.Environment) (metadata.Query, bool) {
+	query := metadata.Query{
+		Type:   c.Query("type"),
+		Issuer: c.Query("issuer"),
+		Format: c.Query("format"),
+		Vct:    c.Query("vct"),
+	}
+
+	if !query.Empty() && !env.GetIndexer().Enabled() {
+		handlers.ErrorResponse(c, metadataDisabledError, errors.New(metadataDisabledError))
+		return query, false
+	}
+
+	return query, true
+}
+
+// includeExpiredQuery reads whether expired items are returned, which they are not by default.
+func includeExpiredQuery(c *gin.Context) (bool, bool) {
+	includeExpired, err := strconv.ParseBool(c.DefaultQuery("includeExpired", "false"))
+
+	if err != nil {
+		handlers.ErrorResponse(c, invalidIncludeExpiredError, err)
+		return false, false
+	}
+
+	return includeExpired, true
+}
+
+// GetCredentialsModel filters the items by the presentation definition, it serves the REST and the NATS requests.
+func GetCredentialsModel(ctx context.Context, authModel model.AuthModel, env *common.Environment, filter *oid4vip.PresentationDefinition, query metadata.Query, includeExpired bool, presentation bool) (*model.GetCredentialModel, error) {
 	logger := env.GetLogger()
-	session := env.GetSession()
 
-	if env.GetContentType() == common.EncryptedContentType {
+	if authModel.ContentType == common.EncryptedContentType {
 		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
 
 		if receipt != nil {
-			credentials, err := loadCredentials(authModel, *env, session, presentation)
+			credentials, index, err := services.LoadCredentials(ctx, authModel, env, presentation, query, includeExpired)
 
 			if err != nil {
 				return nil, err
 			}
 
-			model := model.GetCredentialModel{
-				Credentials: make(map[string]interface{}),
+			return &model.GetCredentialModel{
+				Credentials: services.DecryptItems(ctx, authModel, env, credentials),
 				Receipt:     receipt.Receipt,
-			}
-
-			if credentials == nil {
-				return &model, nil
-			}
-
-			for k, v := range credentials {
-				cipher, err := b64.RawStdEncoding.DecodeString(v)
-				if err == nil {
-					msg, err := crypto.DecryptMessage(authModel.Account, cipher, env.GetCryptoNamespace(), common.StorageCryptoContext, ctx, env.GetCryptoProvider())
-
-					if err != nil {
-						logger.Error(err, "")
-						continue
-					}
-
-					if err == nil {
-						model.Credentials[k] = string(msg)
-					} else {
-						logger.Error(err, "")
-					}
-				}
-
-			}
-			return &model, nil
+				Expired:     services.ExpiredIds(credentials, index),
+			}, nil
 		}
 
 		return nil, errors.New("Receipt Failure")
 	}
 
-	if env.GetContentType() == common.NormalContentType {
-		credentials, err := loadCredentials(authModel, *env, session, presentation)
+	if authModel.ContentType == common.NormalContentType {
+		credentials, index, err := services.LoadCredentials(ctx, authModel, env, presentation, query, includeExpired)
 
 		if err != nil {
 			return nil, err
 		}
 		model := model.GetCredentialModel{
 			Credentials: make(map[string]interface{}),
+			Expired:     services.ExpiredIds(credentials, index),
 		}
 
 		if credentials == nil {
 			return &model, nil
 		}
 
-		foundCredentials := make(map[string]interface{}, 0)
-		for k, v := range credentials {
-			cipher, err := b64.RawStdEncoding.DecodeString(v)
-			if err == nil {
-				msg, err := crypto.DecryptMessage(authModel.Account, cipher, env.GetCryptoNamespace(), common.StorageCryptoContext, ctx, env.GetCryptoProvider())
-
-				if err != nil {
-					logger.Error(err, "")
-					continue
-				}
-
-				foundCredentials[k] = string(msg)
-			}
-		}
+		foundCredentials := services.DecryptItems(ctx, authModel, env, credentials)
 
 		logger.Info("Found credentials before filter", "amount", len(foundCredentials))
 
-		res, err := filter.Filter(foundCredentials)
+		res, err := filterCredentials(env, filter, foundCredentials)
 
 		if err != nil {
 			return nil, err
@@ -168,48 +307,152 @@ func getCredentials(ctx context.Context, authModel model.AuthModel, env *common.
 
 		model.Groups = res
 
+		matched := make(map[string]interface{})
+		for _, group := range res {
+			for id := range group.Credentials {
+				matched[id] = foundCredentials[id]
+			}
+		}
+
+		model.Status = services.CredentialStatus(ctx, authModel, env, matched)
+
 		return &model, nil
 	}
 
 	return nil, errors.New("Error Getting Credentials.")
 }
 
-func loadCredentials(authModel model.AuthModel, env common.Environment, session connection.SessionInterface, presentation bool) (map[string]string, error) {
+// GetPageModel loads a page of items ordered by id, a limit of 0 returns all.
+func GetPageModel(ctx context.Context, authModel model.AuthModel, env *common.Environment, presentation bool, limit int, cursor string, query metadata.Query, includeExpired bool) (*model.GetCredentialModel, error) {
+	var items map[string]string
+	var index map[string]repository.ItemMetadata
+	var next string
+	var err error
 
-	object := "credentials"
+	if query.Empty() {
+		items, next, err = env.GetRepository().LoadPage(ctx, env.GetAccountKey(authModel), presentation, limit, cursor)
 
-	if presentation {
-		object = "presentations"
+		if err == nil && len(items) > 0 {
+			index, err = env.GetRepository().LoadMetadata(ctx, env.GetAccountKey(authModel), presentation, itemIds(items)...)
+		}
+
+		if err == nil {
+			// expired items are dropped after paging, so a page can contain less items than the limit
+			services.FilterItems(env, items, index, query, includeExpired)
+		}
+	} else {
+		items, index, err = services.LoadCredentials(ctx, authModel, env, presentation, query, includeExpired)
+
+		if err == nil {
+			items, next, err = repository.Page(items, limit, cursor)
+		}
 	}
 
-	var objects map[string]string
-	queryString := fmt.Sprintf(`SELECT %s FROM %s.credentials WHERE accountPartition=? AND 
-																					region=? AND 
-																					country=? AND 
-																					account=? AND 
-																					locked=False;`, object, authModel.TenantId)
-	err := session.Query(queryString,
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account).Consistency(gocql.LocalQuorum).Scan(&objects)
+	if err != nil {
+		return nil, err
+	}
 
-	if err != nil && errors.Is(gocql.ErrNotFound, err) {
-		return make(map[string]string), nil
-	} else if err != nil {
-		return nil, errors.Join(errors.New("db query error"), err)
-	} else {
-		return objects, err
+	model := model.GetCredentialModel{
+		Credentials: services.DecryptItems(ctx, authModel, env, items),
+		Next:        next,
+		Formats:     formats(items, index),
+		Expired:     services.ExpiredIds(items, index),
+	}
+
+	model.Status = services.CredentialStatus(ctx, authModel, env, model.Credentials)
+
+	if authModel.ContentType == common.EncryptedContentType {
+		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+		if receipt == nil {
+			return nil, errors.New("Receipt Failure")
+		}
+
+		model.Receipt = receipt.Receipt
+	}
+
+	return &model, nil
+}
+
+// GetItemModel loads a single item, repository.ErrNotFound is returned for unknown ids.
+func GetItemModel(ctx context.Context, authModel model.AuthModel, env *common.Environment, id string, presentation bool) (*model.GetCredentialItemModel, error) {
+	item, err := env.GetRepository().LoadItem(ctx, env.GetAccountKey(authModel), id, presentation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := services.DecryptItem(ctx, authModel, env, item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := env.GetRepository().LoadMetadata(ctx, env.GetAccountKey(authModel), presentation, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	model := model.GetCredentialItemModel{
+		Id:         id,
+		Credential: string(msg),
+		Format:     index[id].Format,
+		Expired:    index[id].Expired(time.Now()),
+		Version:    index[id].Version,
+	}
+
+	if status := services.CredentialStatus(ctx, authModel, env, map[string]interface{}{id: string(msg)}); status != nil {
+		model.Status = status[id]
+	}
+
+	if authModel.ContentType == common.EncryptedContentType {
+		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+		if receipt == nil {
+			return nil, errors.New("Receipt Failure")
+		}
+
+		model.Receipt = receipt.Receipt
+	}
+
+	return &model, nil
+}
+
+func itemIds(items map[string]string) []string {
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// formats returns the recorded formats of the items. Items without a recorded format are left out.
+func formats(items map[string]string, index map[string]repository.ItemMetadata) map[string]string {
+	formats := make(map[string]string)
+
+	for id := range items {
+		if format := index[id].Format; format != "" {
+			formats[id] = format
+		}
 	}
+
+	return formats
 }
 
 // GetPresentations godoc
 // @Summary Add a presentation to the storage
-// @Description Add a presentation to the storage
+// @Description Add a presentation to the storage. A DCQL query is accepted as application/dcql+json body or as dcql_query member, its matches are grouped by credential query id. Other content types are rejected, presentations are created by POST on /presentations/create.
 // @Tags presentations
 // @Produce json
 // @Accept  json
+// @Accept  application/dcql+json
 // @Param request body oid4vip.PresentationDefinition false "Presentation definition details"
+// @Param type query string false "Only items of this credential type, requires the metadata index"
+// @Param issuer query string false "Only items of this issuer, requires the metadata index"
+// @Param format query string false "Only items of this format, requires the metadata index"
+// @Param vct query string false "Only items of this verifiable credential type, requires the metadata index"
+// @Param includeExpired query bool false "Return expired items too, flagged in expired"
 // @Param account path string true "Account ID"
 // @Param tenantId path string true "Tenant ID"
 // @Success 200 {object} model.GetCredentialModel "presentations"
@@ -224,11 +467,17 @@ func GetPresentations(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
 
 // GetCredentials godoc
 // @Summary Get credentials from the storage
-// @Description Get credentials from the storage
+// @Description Get credentials from the storage. A DCQL query is accepted as application/dcql+json body or as dcql_query member, its matches are grouped by credential query id. Other content types are rejected, credentials are created by POST on /credentials/create.
 // @Tags credentials
 // @Produce json
 // @Accept  json
+// @Accept  application/dcql+json
 // @Param request body  oid4vip.PresentationDefinition false "Presentation definition details"
+// @Param type query string false "Only items of this credential type, requires the metadata index"
+// @Param issuer query string false "Only items of this issuer, requires the metadata index"
+// @Param format query string false "Only items of this format, requires the metadata index"
+// @Param vct query string false "Only items of this verifiable credential type, requires the metadata index"
+// @Param includeExpired query bool false "Return expired items too, flagged in expired"
 // @Param account path string true "Account ID"
 // @Param tenantId path string true "Tenant ID"
 // @Success 200 {object} model.GetCredentialModel "credentials"
@@ -240,3 +489,89 @@ func GetCredentials(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
 		post(c, env, false)
 	})
 }
+
+// ListCredentials godoc
+// @Summary List credentials page by page
+// @Description List the credentials of the account ordered by id. In remote mode the response contains a receipt.
+// @Tags credentials
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param limit query int false "Maximum number of credentials, 0 returns all"
+// @Param cursor query string false "Cursor of the next page"
+// @Param type query string false "Only items of this credential type, requires the metadata index"
+// @Param issuer query string false "Only items of this issuer, requires the metadata index"
+// @Param format query string false "Only items of this format, requires the metadata index"
+// @Param vct query string false "Only items of this verifiable credential type, requires the metadata index"
+// @Param includeExpired query bool false "Return expired items too, flagged in expired"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Success 200 {object} model.GetCredentialModel "credentials"
+// @Failure 400 {string} string "Bad Request"
+// @Router /credentials [get]
+func ListCredentials(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
+	return g.GET("", func(c *gin.Context) {
+		Get(c, env, false)
+	})
+}
+
+// ListPresentations godoc
+// @Summary List presentations page by page
+// @Description List the presentations of the account ordered by id. In remote mode the response contains a receipt.
+// @Tags presentations
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param limit query int false "Maximum number of presentations, 0 returns all"
+// @Param cursor query string false "Cursor of the next page"
+// @Param type query string false "Only items of this credential type, requires the metadata index"
+// @Param issuer query string false "Only items of this issuer, requires the metadata index"
+// @Param format query string false "Only items of this format, requires the metadata index"
+// @Param vct query string false "Only items of this verifiable credential type, requires the metadata index"
+// @Param includeExpired query bool false "Return expired items too, flagged in expired"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Success 200 {object} model.GetCredentialModel "presentations"
+// @Failure 400 {string} string "Bad Request"
+// @Router /presentations [get]
+func ListPresentations(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
+	return g.GET("", func(c *gin.Context) {
+		Get(c, env, true)
+	})
+}
+
+// GetCredential godoc
+// @Summary Get a single credential from the storage
+// @Description Get a single credential from the storage. In remote mode the response contains a receipt.
+// @Tags credentials
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Param id path string true "ID of the credential"
+// @Success 200 {object} model.GetCredentialItemModel "credential"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Router /credentials/{id} [get]
+func GetCredential(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
+	return g.GET("/:id", func(c *gin.Context) {
+		GetItem(c, env, false)
+	})
+}
+
+// GetPresentation godoc
+// @Summary Get a single presentation from the storage
+// @Description Get a single presentation from the storage. In remote mode the response contains a receipt.
+// @Tags presentations
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param account path string true "Account ID"
+// @Param tenantId path string true "Tenant ID"
+// @Param id path string true "ID of the presentation"
+// @Success 200 {object} model.GetCredentialItemModel "presentation"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Router /presentations/{id} [get]
+func GetPresentation(g *gin.RouterGroup, env *common.Environment) gin.IRoutes {
+	return g.GET("/:id", func(c *gin.Context) {
+		GetItem(c, env, true)
+	})
+}
@@ -3,14 +3,13 @@ package handlers
 import (
 	"context"
 	"errors"
-	"fmt"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gocql/gocql"
 )
 
 const deleteCredentialError = "Credential couldnt be deleted."
@@ -20,10 +19,10 @@ func Remove(c *gin.Context, env *common.Environment, presentation bool) any {
 	ctx := c.Request.Context()
 	authModel := c.Request.Context().Value(model.AuthModelKey).(model.AuthModel)
 
-	if env.GetContentType() == common.EncryptedContentType {
+	if authModel.ContentType == common.EncryptedContentType {
 		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
 		if receipt != nil {
-			err := removeCredential(ctx, id, authModel, env, presentation)
+			err := RemoveCredential(ctx, id, authModel, env, presentation)
 
 			if err == nil {
 				c.Header("Content-Type", common.EncryptedContentType)
@@ -36,8 +35,8 @@ func Remove(c *gin.Context, env *common.Environment, presentation bool) any {
 		return handlers.ErrorResponse(c, "Receipt Error", errors.New("receipt error"))
 	}
 
-	if env.GetContentType() == common.NormalContentType {
-		err := removeCredential(ctx, id, authModel, env, presentation)
+	if authModel.ContentType == common.NormalContentType {
+		err := RemoveCredential(ctx, id, authModel, env, presentation)
 
 		if err == nil {
 			return nil
@@ -52,30 +51,15 @@ func Remove(c *gin.Context, env *common.Environment, presentation bool) any {
 	return errors.ErrUnsupported
 }
 
-func removeCredential(ctx context.Context, id string, authModel model.AuthModel, env *common.Environment, presentation bool) error {
+func RemoveCredential(ctx context.Context, id string, authModel model.AuthModel, env *common.Environment, presentation bool) error {
 
-	object := "credentials"
-
-	if presentation {
-		object = "presentations"
-	}
-
-	session := env.GetSession()
-
-	queryString := fmt.Sprintf(`DELETE %s[?] FROM %s.credentials  WHERE accountPartition=? AND
-																						   region=? AND 
-																						   country=? AND 
-																						   account=?;`, object, authModel.TenantId)
-	err := session.Query(queryString,
-		id,
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+	err := env.GetRepository().DeleteItem(ctx, env.GetAccountKey(authModel), id, presentation)
 
 	if err != nil {
 		return errors.New(deleteCredentialError)
 	}
 
+	services.PublishItemEvent(ctx, env, authModel, id, presentation, true)
+
 	return nil
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func AddHealth(c *gin.Context, env *common.Environment) {
-	if env.GetSession() == nil || env.GetSession().Closed() {
+	if env.GetRepository() == nil || env.GetRepository().Closed() {
 		c.JSON(400, gin.H{
 			"status": "unhealthy",
 		})
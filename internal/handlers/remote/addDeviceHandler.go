@@ -6,16 +6,18 @@ import (
 	b64 "encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	crypt "github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
 	"github.com/eclipse-xfsc/crypto-provider-core/types"
 	"github.com/gin-gonic/gin"
-	"github.com/gocql/gocql"
 	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
@@ -42,10 +44,10 @@ func AddDevice(c *gin.Context, env *common.Environment) {
 		return
 	}
 
-	exist, err := checkExist(authModel, env)
+	exist, err := checkExist(c.Request.Context(), authModel, env)
 	if !exist {
 		if err == nil {
-			receipt, err := storeRecord(c.Request.Context(), authModel, env)
+			receipt, err := storeRecord(c.Request.Context(), authModel, c.Query("label"), env)
 			if err == nil && receipt != nil {
 				c.Header("Content-Type", "application/jose")
 				c.String(200, receipt.Receipt)
@@ -66,35 +68,14 @@ func AddDevice(c *gin.Context, env *common.Environment) {
 
 }
 
-func checkExist(authModel model.AuthModel, env *common.Environment) (bool, error) {
-	var account = ""
-	session := env.GetSession()
-
-	queryString := fmt.Sprintf(`SELECT account FROM %s.credentials WHERE accountPartition=? AND 
-																					region=? AND 
-																					country=? AND 
-																					account=? LIMIT 1;`, authModel.TenantId)
-
-	query := session.Query(queryString,
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account)
-
-	err := query.Consistency(gocql.LocalQuorum).Scan(&account)
-
-	if err == gocql.ErrNotFound {
-		err = nil
-		account = ""
-	}
-
-	return account != "", err
+func checkExist(ctx context.Context, authModel model.AuthModel, env *common.Environment) (bool, error) {
+	return env.GetRepository().AccountExists(ctx, env.GetAccountKey(authModel))
 }
 
-func createBasicStructure(ctx context.Context, key *jwk.Key, env *common.Environment) ([]byte, []byte, []byte, error) {
+func createBasicStructure(ctx context.Context, tenantId string, key *jwk.Key, env *common.Environment) ([]byte, []byte, []byte, error) {
 	logger := env.GetLogger()
 
-	nonce, err := env.GetCryptoProvider().GenerateRandom(types.CryptoContext{Namespace: env.GetCryptoNamespace(), Context: ctx, Group: common.StorageCryptoContext}, 64)
+	nonce, err := env.GetCryptoProvider().GenerateRandom(types.CryptoContext{Namespace: env.GetCryptoNamespace(tenantId), Context: ctx, Group: common.StorageCryptoContext}, 64)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -103,9 +84,9 @@ func createBasicStructure(ctx context.Context, key *jwk.Key, env *common.Environ
 	json.NewEncoder(&dk).Encode(key)
 
 	sign, err := env.GetCryptoProvider().Sign(types.CryptoIdentifier{
-		KeyId: env.GetCryptoSignKey(),
+		KeyId: env.GetCryptoSignKey(tenantId),
 		CryptoContext: types.CryptoContext{
-			Namespace: env.GetCryptoNamespace(),
+			Namespace: env.GetCryptoNamespace(tenantId),
 			Context:   ctx,
 			Group:     common.StorageCryptoContext,
 		},
@@ -119,53 +100,62 @@ func createBasicStructure(ctx context.Context, key *jwk.Key, env *common.Environ
 	return sign, nonce, dk.Bytes(), nil
 }
 
-func storeRecord(ctx context.Context, authModel model.AuthModel, env *common.Environment) (*model.Receipt, error) {
-	session := env.GetSession()
+func storeRecord(ctx context.Context, authModel model.AuthModel, label string, env *common.Environment) (*model.Receipt, error) {
 	logger := env.GetLogger()
 
-	sig, nonce, key, err := createBasicStructure(ctx, authModel.Device_Key, env)
+	record, err := createDeviceRecord(ctx, authModel.TenantId, authModel.Device_Key, label, env)
 
 	if err != nil {
 		logger.Error(err, "")
 		return nil, err
 	}
 
-	queryString := fmt.Sprintf(`INSERT INTO %s.credentials 
-									( accountPartition, 
-									  region, 
-									  country,
-									  account,
-									  last_update_timestamp,
-									  recovery_nonce,
-									  device_key,
-									  signature,
-									  locked) VALUES (?, ?, ?, ?, toTimestamp(now()), ?, ? , ? ,False);`, authModel.TenantId)
-
-	err = session.Query(queryString,
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account,
-		b64.StdEncoding.EncodeToString(nonce),
-		b64.StdEncoding.EncodeToString(key),
-		b64.StdEncoding.EncodeToString(sig),
-	).WithContext(ctx).Exec()
+	err = env.GetRepository().CreateDevice(ctx, env.GetAccountKey(authModel), *record)
 
 	if err != nil {
 		logger.Error(err, "")
 		return nil, err
 	}
 
-	receipt := model.RegistrationModel{
-		Recovery_Nonce: b64.StdEncoding.EncodeToString(nonce),
-	}
-
-	msg, err := crypt.CreateJweMessage(receipt, *authModel.Device_Key)
+	msg, err := registrationMessage(*record, *authModel.Device_Key)
 
 	if err != nil {
 		logger.Error(err, "")
 		return nil, err
 	}
 
+	services.PublishEvent(ctx, env, messaging.DeviceRegisteredType, authModel, record.Id, "")
+
 	return new(model.Receipt).CreateReceipt(msg), nil
 }
+
+// createDeviceRecord signs the key of a new device and creates its recovery nonce, the id is derived from the key.
+func createDeviceRecord(ctx context.Context, tenantId string, key *jwk.Key, label string, env *common.Environment) (*repository.DeviceRecord, error) {
+	id, err := repository.DeviceId(*key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sig, nonce, dk, err := createBasicStructure(ctx, tenantId, key, env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &repository.DeviceRecord{
+		Id:            id,
+		Label:         label,
+		RecoveryNonce: b64.StdEncoding.EncodeToString(nonce),
+		DeviceKey:     b64.StdEncoding.EncodeToString(dk),
+		Signature:     b64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// registrationMessage tells a device its id and recovery nonce, encrypted for its key.
+func registrationMessage(record repository.DeviceRecord, key jwk.Key) (*jwe.Message, error) {
+	return crypt.CreateJweMessage(model.RegistrationModel{
+		Recovery_Nonce: record.RecoveryNonce,
+		DeviceId:       record.Id,
+	}, key)
+}
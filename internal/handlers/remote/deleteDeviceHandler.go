@@ -1,11 +1,166 @@
 package handlers
 
 import (
+	"errors"
+	"time"
+
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	crypt "github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
 
 	"github.com/gin-gonic/gin"
 )
 
+/*
+DeleteDevice removes the calling device from its account. The last device of an account deletes the account
+together with its items and message key, an account without devices can not be reached anymore.
+*/
 func DeleteDevice(c *gin.Context, env *common.Environment) {
+	ctx := c.Request.Context()
+
+	authModel, ok := deletionAuth(c)
+
+	if !ok {
+		return
+	}
+
+	key := env.GetAccountKey(authModel)
+	devices, err := env.GetRepository().ListDevices(ctx, key)
+
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceDeletionFailed, err)
+		return
+	}
+
+	if len(devices) <= 1 {
+		deleteAccount(c, authModel, env)
+		return
+	}
+
+	receipt := deletionReceipt(c, authModel, authModel.DeviceId)
+
+	if receipt == nil {
+		return
+	}
+
+	err = env.GetRepository().DeleteDevice(ctx, key, authModel.DeviceId)
+
+	if err != nil {
+		env.GetLogger().Debug("", "Error", err)
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceDeletionFailed, err)
+		return
+	}
+
+	services.PublishEvent(ctx, env, messaging.DeviceRevokedType, authModel, authModel.DeviceId, "")
+
+	c.Header("Content-Type", common.EncryptedContentType)
+	c.String(200, receipt.Receipt)
+}
+
+// DeleteAccount deletes the account of the calling device with all its devices, items and its message key.
+func DeleteAccount(c *gin.Context, env *common.Environment) {
+	authModel, ok := deletionAuth(c)
+
+	if !ok {
+		return
+	}
+
+	deleteAccount(c, authModel, env)
+}
+
+// deletionAuth returns the auth model of a deletion, which requires the device key and the current nonce.
+func deletionAuth(c *gin.Context) (model.AuthModel, bool) {
+	authObject := c.Request.Context().Value(model.AuthModelKey)
+
+	if authObject == nil {
+		_ = handlers.ErrorResponse(c, handlers.InvalidRequest, errors.New(""))
+		return model.AuthModel{}, false
+	}
+
+	authModel := authObject.(model.AuthModel)
+
+	if authModel.Device_Key == nil {
+		_ = handlers.ErrorResponse(c, handlers.InvalidRequest, errors.New("device key not present"))
+		return authModel, false
+	}
+
+	if !checkNonce(authModel) {
+		_ = handlers.ErrorResponse(c, handlers.NonceNotValid, errors.New(""))
+		return authModel, false
+	}
+
+	return authModel, true
+}
+
+// deletionReceipt encrypts the deletion for the calling device, the receipt is created before anything is deleted.
+func deletionReceipt(c *gin.Context, authModel model.AuthModel, device string) *model.Receipt {
+	deletion := model.DeletionModel{
+		Account: authModel.Account,
+		Device:  device,
+		Deleted: time.Now().Unix(),
+	}
+
+	msg, err := crypt.CreateJweMessage(deletion, *authModel.Device_Key)
+
+	if err != nil || msg == nil {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceDeletionFailed, err)
+		return nil
+	}
+
+	receipt := new(model.Receipt).CreateReceipt(msg)
+
+	if receipt == nil {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceDeletionFailed, errors.New("receipt error"))
+		return nil
+	}
+
+	return receipt
+}
+
+func deleteAccount(c *gin.Context, authModel model.AuthModel, env *common.Environment) {
+	ctx := c.Request.Context()
+
+	receipt := deletionReceipt(c, authModel, "")
+
+	if receipt == nil {
+		return
+	}
+
+	err := env.GetRepository().DeleteAccount(ctx, env.GetAccountKey(authModel))
+
+	if err != nil {
+		env.GetLogger().Debug("", "Error", err)
+		_ = handlers.InternalErrorResponse(c, handlers.AccountDeletionFailed, err)
+		return
+	}
+
+	err = crypt.DeleteMessageKey(authModel.Account, env.GetCryptoNamespace(authModel.TenantId), common.StorageCryptoContext, ctx, env.GetCryptoProvider())
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, handlers.CryptoProviderError, err)
+		return
+	}
+
+	c.Header("Content-Type", common.EncryptedContentType)
+	c.String(200, receipt.Receipt)
+}
+
+func checkNonce(authModel model.AuthModel) bool {
+	if authModel.Token == nil || authModel.Nonce == "" {
+		return false
+	}
+
+	field, exist := (*authModel.Token).Get("nonce")
+
+	if !exist {
+		return false
+	}
+
+	nonce, ok := field.(string)
 
+	return ok && nonce == authModel.Nonce
 }
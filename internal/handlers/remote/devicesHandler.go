@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// ListDevices returns the devices of the account together with a receipt for the calling device.
+func ListDevices(c *gin.Context, env *common.Environment) {
+	ctx := c.Request.Context()
+
+	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
+
+	records, err := env.GetRepository().ListDevices(ctx, env.GetAccountKey(authModel))
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, handlers.InvalidRequest, err)
+		return
+	}
+
+	result := model.DevicesModel{Devices: make([]model.DeviceModel, 0, len(records))}
+	for _, record := range records {
+		result.Devices = append(result.Devices, deviceModel(record, authModel))
+	}
+
+	receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+	if receipt == nil {
+		_ = handlers.InternalErrorResponse(c, handlers.InvalidRequest, errors.New("receipt error"))
+		return
+	}
+
+	result.Receipt = receipt.Receipt
+	c.JSON(200, result)
+}
+
+/*
+AddAccountDevice binds a further device to the account, authorized by a bound device. The body is a JWT with the
+account as subject and an optional label claim, signed by the new device with its key in the jwk header. The new
+device receives its id and recovery nonce encrypted for its key, the calling device a receipt.
+*/
+func AddAccountDevice(c *gin.Context, env *common.Environment) {
+	logger := env.GetLogger()
+
+	if c.GetHeader("Content-Type") != "application/jwt" {
+		_ = handlers.ErrorResponse(c, handlers.WrongContentType, errors.New(""))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
+
+	body, err := handlers.ExtractBody(c.Request)
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, handlers.NoBodyError, err)
+		return
+	}
+
+	key, label, err := parseDeviceToken(body, authModel.Account)
+
+	if err != nil {
+		_ = handlers.ErrorResponse(c, handlers.InvalidRequest, err)
+		return
+	}
+
+	if key.KeyType() != jwa.EC && key.KeyType() != jwa.RSA {
+		_ = handlers.ErrorResponse(c, handlers.InvalidKeySigningAlgorithm, errors.New(""))
+		return
+	}
+
+	record, err := createDeviceRecord(ctx, authModel.TenantId, &key, label, env)
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceRegistrationFailed, err)
+		return
+	}
+
+	err = env.GetRepository().AddDevice(ctx, env.GetAccountKey(authModel), *record)
+
+	if errors.Is(err, repository.ErrExists) {
+		_ = handlers.ConflictResponse(c, handlers.DeviceAlreadyExist, err)
+		return
+	}
+
+	if err != nil {
+		logger.Error(err, "")
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceRegistrationFailed, err)
+		return
+	}
+
+	// created is maintained by the repository
+	if stored, err := env.GetRepository().LoadDevice(ctx, env.GetAccountKey(authModel), record.Id); err == nil {
+		record = stored
+	}
+
+	services.PublishEvent(ctx, env, messaging.DeviceRegisteredType, authModel, record.Id, "")
+
+	msg, err := registrationMessage(*record, key)
+
+	var registration []byte
+	if err == nil {
+		registration, err = jwe.Compact(msg)
+	}
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceRegistrationFailed, err)
+		return
+	}
+
+	result := model.AddedDeviceModel{
+		Device:       deviceModel(*record, authModel),
+		Registration: string(registration),
+	}
+
+	if receipt := handlers.CreateTransactionReciept(ctx, authModel, env); receipt != nil {
+		result.Receipt = receipt.Receipt
+	}
+
+	c.JSON(201, result)
+}
+
+/*
+RevokeDevice removes a device from the account, the last device can not be revoked. A device which revokes itself
+gets no receipt, its nonce is gone with it.
+*/
+func RevokeDevice(c *gin.Context, env *common.Environment) {
+	ctx := c.Request.Context()
+
+	authModel := ctx.Value(model.AuthModelKey).(model.AuthModel)
+	id := c.Param("deviceId")
+	key := env.GetAccountKey(authModel)
+
+	devices, err := env.GetRepository().ListDevices(ctx, key)
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceDeletionFailed, err)
+		return
+	}
+
+	if len(devices) == 1 && devices[0].Id == id {
+		_ = handlers.ConflictResponse(c, handlers.LastDeviceRevocation, errors.New(""))
+		return
+	}
+
+	err = env.GetRepository().DeleteDevice(ctx, key, id)
+
+	if errors.Is(err, repository.ErrNotFound) {
+		_ = handlers.NotFoundResponse(c, handlers.DeviceNotFound, err)
+		return
+	}
+
+	if err != nil {
+		_ = handlers.InternalErrorResponse(c, handlers.DeviceDeletionFailed, err)
+		return
+	}
+
+	services.PublishEvent(ctx, env, messaging.DeviceRevokedType, authModel, id, "")
+
+	if id == authModel.DeviceId {
+		c.Status(204)
+		return
+	}
+
+	receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+	if receipt == nil {
+		_ = handlers.InternalErrorResponse(c, handlers.InvalidRequest, errors.New("receipt error"))
+		return
+	}
+
+	c.Header("Content-Type", common.EncryptedContentType)
+	c.String(200, receipt.Receipt)
+}
+
+// parseDeviceToken verifies the JWT of a new device against the key in its header and returns key and label.
+func parseDeviceToken(body []byte, account string) (jwk.Key, string, error) {
+	var key jwk.Key
+
+	token, err := jwt.Parse(body,
+		jwt.WithSubject(account),
+		jwt.WithKeyProvider(jws.KeyProviderFunc(
+			func(context context.Context, sink jws.KeySink, sig *jws.Signature, message *jws.Message) error {
+				key = sig.ProtectedHeaders().JWK()
+
+				if key == nil {
+					return jwt.ErrInvalidJWT()
+				}
+
+				sink.Key(sig.ProtectedHeaders().Algorithm(), key)
+				return nil
+			})))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var label string
+	if field, ok := token.Get("label"); ok {
+		label, _ = field.(string)
+	}
+
+	return key, label, nil
+}
+
+func deviceModel(record repository.DeviceRecord, authModel model.AuthModel) model.DeviceModel {
+	device := model.DeviceModel{
+		Id:      record.Id,
+		Label:   record.Label,
+		Created: record.Created,
+		Current: record.Id == authModel.DeviceId,
+	}
+
+	if !record.LastSeen.IsZero() {
+		device.LastSeen = &record.LastSeen
+	}
+
+	return device
+}
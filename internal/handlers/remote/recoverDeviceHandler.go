@@ -5,11 +5,13 @@ import (
 	b64 "encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
 	ljwt "github.com/eclipse-xfsc/ssi-jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/lestrrat-go/jwx/v2/jwa"
@@ -69,32 +71,21 @@ func RecoverDevice(c *gin.Context, env *common.Environment) {
 
 func updateRecord(ctx context.Context, authModel model.AuthModel, key *jwk.Key, env *common.Environment) (*model.Receipt, error) {
 	logger := env.GetLogger()
-	session := env.GetSession()
 
-	sig, nonce, newKey, err := createBasicStructure(ctx, key, env)
+	sig, nonce, newKey, err := createBasicStructure(ctx, authModel.TenantId, key, env)
 
 	if err != nil {
 		logger.Error(err, "")
 		return nil, err
 	}
 
-	queryString := fmt.Sprintf(`UPDATE %s.credentials SET device_key=?,
-															  signature=?, 
-															  recovery_nonce=?,
-															  last_update_timestamp=toTimestamp(now()) WHERE 
-																  		  accountPartition=? AND 
-																					region=? AND 
-																					country=? AND
-																					account=?;`, authModel.TenantId)
-
-	err2 := session.Query(queryString,
-		b64.StdEncoding.EncodeToString(newKey),
-		b64.StdEncoding.EncodeToString(sig),
-		b64.StdEncoding.EncodeToString(nonce),
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account).WithContext(ctx).Exec()
+	// the device keeps its id, so that the other devices still know it
+	err2 := env.GetRepository().UpdateDevice(ctx, env.GetAccountKey(authModel), repository.DeviceRecord{
+		Id:            authModel.DeviceId,
+		DeviceKey:     b64.StdEncoding.EncodeToString(newKey),
+		Signature:     b64.StdEncoding.EncodeToString(sig),
+		RecoveryNonce: b64.StdEncoding.EncodeToString(nonce),
+	})
 
 	if err2 != nil {
 		logger.Error(err2, "")
@@ -103,6 +94,7 @@ func updateRecord(ctx context.Context, authModel model.AuthModel, key *jwk.Key,
 
 	receipt := model.RegistrationModel{
 		Recovery_Nonce: b64.StdEncoding.EncodeToString(nonce),
+		DeviceId:       authModel.DeviceId,
 	}
 
 	payload, err := json.Marshal(receipt)
@@ -112,5 +104,7 @@ func updateRecord(ctx context.Context, authModel model.AuthModel, key *jwk.Key,
 		return nil, err
 	}
 
+	services.PublishEvent(ctx, env, messaging.DeviceRecoveredType, authModel, authModel.DeviceId, "")
+
 	return new(model.Receipt).CreateReceipt(ljwt.EncryptJweMessage(payload, jwa.ECDH_ES_A256KW, *key)), nil
 }
@@ -0,0 +1,106 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/eclipse-xfsc/cloud-event-provider"
+)
+
+// Sender publishes a CloudEvent, it is implemented by the publishing cloudeventprovider client.
+type Sender interface {
+	PubCtx(ctx context.Context, event event.Event) error
+}
+
+// Publisher sends the lifecycle events of the wallets of the configured tenants.
+type Publisher struct {
+	sender  Sender
+	source  string
+	tenants map[string]bool
+	mutex   sync.Mutex
+	// locked holds the accounts whose lock was announced already
+	locked map[string]bool
+}
+
+// NewPublisher publishes the events of the tenants, without tenants the events of all tenants.
+func NewPublisher(sender Sender, source string, tenants []string) *Publisher {
+	publisher := &Publisher{sender: sender, source: source, tenants: make(map[string]bool, len(tenants)), locked: make(map[string]bool)}
+
+	for _, tenant := range tenants {
+		publisher.tenants[tenant] = true
+	}
+
+	return publisher
+}
+
+// Enabled reports whether events of the tenant are published. A nil publisher publishes nothing.
+func (p *Publisher) Enabled(tenant string) bool {
+	return p != nil && (len(p.tenants) == 0 || p.tenants[tenant])
+}
+
+func (p *Publisher) Publish(ctx context.Context, eventType string, lifecycleEvent messaging.StorageServiceLifecycleEvent) error {
+	if !p.Enabled(lifecycleEvent.TenantId) {
+		return nil
+	}
+
+	data, err := json.Marshal(lifecycleEvent)
+
+	if err != nil {
+		return err
+	}
+
+	e, err := cloudeventprovider.NewEvent(p.source, eventType, data)
+
+	if err != nil {
+		return err
+	}
+
+	return p.sender.PubCtx(ctx, e)
+}
+
+/*
+PublishLocked announces a locked account once. Accounts are locked outside of the service, so the lock is seen by the
+refused requests of its devices, which are not announced again until Unlocked reports the account usable.
+*/
+func (p *Publisher) PublishLocked(ctx context.Context, lifecycleEvent messaging.StorageServiceLifecycleEvent) error {
+	if !p.Enabled(lifecycleEvent.TenantId) {
+		return nil
+	}
+
+	account := lifecycleEvent.TenantId + "/" + lifecycleEvent.AccountId
+
+	p.mutex.Lock()
+	announced := p.locked[account]
+	p.locked[account] = true
+	p.mutex.Unlock()
+
+	if announced {
+		return nil
+	}
+
+	err := p.Publish(ctx, messaging.AccountLockedType, lifecycleEvent)
+
+	if err != nil {
+		// announced with the next refused request
+		p.mutex.Lock()
+		delete(p.locked, account)
+		p.mutex.Unlock()
+	}
+
+	return err
+}
+
+// Unlocked forgets the announced lock of an account, so that a further lock is announced again.
+func (p *Publisher) Unlocked(tenant string, account string) {
+	if !p.Enabled(tenant) {
+		return
+	}
+
+	p.mutex.Lock()
+	delete(p.locked, tenant+"/"+account)
+	p.mutex.Unlock()
+}
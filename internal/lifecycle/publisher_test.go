@@ -0,0 +1,154 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/eclipse-xfsc/cloud-event-provider"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+type recorder struct {
+	events []event.Event
+}
+
+func (r *recorder) PubCtx(ctx context.Context, e event.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestPublishTenants(t *testing.T) {
+	sender := new(recorder)
+	publisher := NewPublisher(sender, "test", []string{"tenant_space"})
+
+	for _, tenant := range []string{"tenant_space", "other"} {
+		err := publisher.Publish(context.Background(), messaging.CredentialStoredType, messaging.StorageServiceLifecycleEvent{
+			TenantId:  tenant,
+			AccountId: "ABCD123",
+			Id:        "1",
+			Type:      messaging.StoreCredentialType,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sender.events) != 1 || sender.events[0].Type() != messaging.CredentialStoredType || sender.events[0].Source() != "test" {
+		t.Fatal("only events of the configured tenant should be published", sender.events)
+	}
+
+	var published messaging.StorageServiceLifecycleEvent
+	if err := json.Unmarshal(sender.events[0].Data(), &published); err != nil {
+		t.Fatal(err)
+	}
+
+	if published.TenantId != "tenant_space" || published.AccountId != "ABCD123" || published.Id != "1" || published.Type != messaging.StoreCredentialType {
+		t.Error("event is wrong", published)
+	}
+}
+
+func TestPublishDisabled(t *testing.T) {
+	var publisher *Publisher
+
+	if publisher.Enabled("tenant_space") {
+		t.Error("nil publisher should be disabled")
+	}
+
+	if err := publisher.Publish(context.Background(), messaging.AccountLockedType, messaging.StorageServiceLifecycleEvent{TenantId: "tenant_space"}); err != nil {
+		t.Error(err)
+	}
+
+	sender := new(recorder)
+	NewPublisher(sender, "test", nil).Publish(context.Background(), messaging.AccountLockedType, messaging.StorageServiceLifecycleEvent{TenantId: "any"})
+
+	if len(sender.events) != 1 {
+		t.Error("without tenants all events should be published", sender.events)
+	}
+}
+
+// runNats starts an embedded NATS server on a free port.
+func runNats(t *testing.T) string {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+
+	return s.ClientURL()
+}
+
+func TestPublishOverNats(t *testing.T) {
+	url := runNats(t)
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	subscription, err := conn.SubscribeSync("storage.lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := cloudeventprovider.New(cloudeventprovider.Config{
+		Protocol: cloudeventprovider.ProtocolTypeNats,
+		Settings: cloudeventprovider.NatsConfig{Url: url},
+	}, cloudeventprovider.ConnectionTypePub, "storage.lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	publisher := NewPublisher(client, "test", nil)
+	locked := messaging.StorageServiceLifecycleEvent{TenantId: "tenant_space", AccountId: "ABCD123"}
+
+	for i := 0; i < 3; i++ {
+		if err := publisher.PublishLocked(context.Background(), locked); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publisher.Unlocked("tenant_space", "ABCD123")
+
+	if err := publisher.PublishLocked(context.Background(), locked); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		msg, err := subscription.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatal("locked event should arrive", i, err)
+		}
+
+		received := event.New()
+		if err := json.Unmarshal(msg.Data, &received); err != nil {
+			t.Fatal(err, string(msg.Data))
+		}
+
+		var published messaging.StorageServiceLifecycleEvent
+		if err := json.Unmarshal(received.Data(), &published); err != nil {
+			t.Fatal(err)
+		}
+
+		if received.Type() != messaging.AccountLockedType || received.Source() != "test" || published != locked {
+			t.Error("event is wrong", received, published)
+		}
+	}
+
+	if msg, err := subscription.NextMsg(200 * time.Millisecond); err == nil {
+		t.Error("retries of a locked account should not be announced", string(msg.Data))
+	}
+}
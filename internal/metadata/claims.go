@@ -0,0 +1,162 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	b64 "encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	"sha-256": crypto.SHA256,
+	"sha-384": crypto.SHA384,
+	"sha-512": crypto.SHA512,
+}
+
+/*
+Usage: Decodes a credential into its claim set for evaluating JSONPath constraints. SD-JWT disclosures are
+resolved into the claims, the members of the vc or vp claim of a JWT are additionally lifted to the top level,
+so that $.credentialSubject matches JSON-LD and JWT credentials alike. Signatures are not verified.
+*/
+
+func Claims(msg []byte) (string, map[string]interface{}, error) {
+	msg = bytes.TrimSpace(msg)
+
+	if len(msg) > 0 && msg[0] == '{' {
+		var claims map[string]interface{}
+		if err := json.Unmarshal(msg, &claims); err != nil {
+			return "", nil, formatError("malformed JSON: %s", err.Error())
+		}
+
+		format := FormatLdpVc
+		for _, t := range stringList(claims["type"]) {
+			if t == "VerifiablePresentation" {
+				format = FormatLdpVp
+			}
+		}
+		return format, claims, nil
+	}
+
+	compact := string(msg)
+
+	if strings.Contains(compact, "~") {
+		claims, err := sdJwtClaims(compact)
+		return FormatSdJwtVc, claims, err
+	}
+
+	claims, err := jwtClaims(compact)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	format := FormatJwtVc
+	envelope, ok := claims["vc"].(map[string]interface{})
+
+	if vp, isVp := claims["vp"].(map[string]interface{}); isVp {
+		format = FormatJwtVp
+		envelope, ok = vp, true
+	}
+
+	if ok {
+		for k, v := range envelope {
+			if _, exists := claims[k]; !exists {
+				claims[k] = v
+			}
+		}
+	}
+
+	return format, claims, nil
+}
+
+func sdJwtClaims(compact string) (map[string]interface{}, error) {
+	parts := strings.Split(compact, "~")
+
+	claims, err := jwtClaims(parts[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := "sha-256"
+	if alg, ok := claims["_sd_alg"].(string); ok {
+		algorithm = alg
+	}
+
+	hash, ok := digestAlgorithms[algorithm]
+
+	if !ok {
+		return nil, formatError("unsupported _sd_alg %s", algorithm)
+	}
+
+	disclosures := make(map[string][]interface{})
+	encoded := parts[1 : len(parts)-1]
+
+	// the last part is a key binding JWT or, if the trailing ~ is missing, a disclosure
+	if last := parts[len(parts)-1]; last != "" && !strings.Contains(last, ".") {
+		encoded = append(encoded, last)
+	}
+
+	for _, disclosure := range encoded {
+		values, err := decodeDisclosure(disclosure)
+
+		if err != nil {
+			return nil, formatError("disclosure: %s", err.Error())
+		}
+
+		digest := hash.New()
+		digest.Write([]byte(disclosure))
+		disclosures[b64.RawURLEncoding.EncodeToString(digest.Sum(nil))] = values
+	}
+
+	delete(claims, "_sd_alg")
+
+	return resolveDisclosures(claims, disclosures).(map[string]interface{}), nil
+}
+
+// resolveDisclosures replaces the digests of disclosed claims by their values. Undisclosed digests are removed.
+func resolveDisclosures(value interface{}, disclosures map[string][]interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+
+		for k, e := range v {
+			if k != "_sd" {
+				result[k] = resolveDisclosures(e, disclosures)
+			}
+		}
+
+		digests, _ := v["_sd"].([]interface{})
+		for _, d := range digests {
+			digest, _ := d.(string)
+			if disclosure, ok := disclosures[digest]; ok && len(disclosure) == 3 {
+				if name, ok := disclosure[1].(string); ok {
+					result[name] = resolveDisclosures(disclosure[2], disclosures)
+				}
+			}
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+
+		for _, e := range v {
+			if element, ok := e.(map[string]interface{}); ok && len(element) == 1 {
+				if digest, ok := element["..."].(string); ok {
+					if disclosure, ok := disclosures[digest]; ok && len(disclosure) == 2 {
+						result = append(result, resolveDisclosures(disclosure[1], disclosures))
+					}
+					continue
+				}
+			}
+			result = append(result, resolveDisclosures(e, disclosures))
+		}
+
+		return result
+	}
+
+	return value
+}
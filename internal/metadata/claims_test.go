@@ -0,0 +1,35 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"testing"
+)
+
+func TestClaimsOfJwt(t *testing.T) {
+	format, claims, err := Claims([]byte(jwt(`{"iss":"did:example:issuer","vc":{"credentialSubject":{"dob":"2000-01-01"}}}`)))
+	if err != nil || format != FormatJwtVc {
+		t.Fatal("format is wrong", format, err)
+	}
+
+	subject, ok := claims["credentialSubject"].(map[string]interface{})
+	if !ok || subject["dob"] != "2000-01-01" || claims["vc"] == nil {
+		t.Error("vc claims were not lifted", claims)
+	}
+}
+
+func TestClaimsOfSdJwtArray(t *testing.T) {
+	disclosure := b64.RawURLEncoding.EncodeToString([]byte(`["salt","DE"]`))
+	digest := sha256.Sum256([]byte(disclosure))
+	payload := `{"vct":"https://example.com/pid","nationalities":[{"...":"` + b64.RawURLEncoding.EncodeToString(digest[:]) + `"},{"...":"undisclosed"}]}`
+
+	format, claims, err := Claims([]byte(jwt(payload) + "~" + disclosure))
+	if err != nil || format != FormatSdJwtVc {
+		t.Fatal("format is wrong", format, err)
+	}
+
+	nationalities, ok := claims["nationalities"].([]interface{})
+	if !ok || len(nationalities) != 1 || nationalities[0] != "DE" {
+		t.Error("array disclosures were not resolved", claims)
+	}
+}
@@ -0,0 +1,304 @@
+package metadata
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const FormatMsoMdoc = "mso_mdoc"
+
+var ErrInvalidFormat = errors.New("invalid credential format")
+
+func formatError(reason string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidFormat, fmt.Sprintf(reason, args...))
+}
+
+/*
+Usage: Detects the format of a plaintext credential or presentation. Supported are W3C JSON-LD credentials and
+presentations, VC-JWT, JWT VP, SD-JWT VC and mdoc as CBOR, either raw or base64url encoded. Returns an error
+wrapping ErrInvalidFormat, which describes what is malformed.
+*/
+
+func Detect(msg []byte) (string, error) {
+	msg = bytes.TrimSpace(msg)
+
+	if len(msg) == 0 {
+		return "", formatError("empty payload")
+	}
+
+	if msg[0] == '{' {
+		return detectJsonLd(msg)
+	}
+
+	if isText(msg) {
+		compact := string(msg)
+
+		if strings.Contains(compact, "~") {
+			return detectSdJwt(compact)
+		}
+
+		if strings.Count(compact, ".") == 2 {
+			return detectJwt(compact)
+		}
+
+		if cbor, err := b64.RawURLEncoding.DecodeString(strings.TrimRight(compact, "=")); err == nil && isCborMap(cbor) {
+			return FormatMsoMdoc, validateCbor(cbor)
+		}
+	}
+
+	if isCborMap(msg) {
+		return FormatMsoMdoc, validateCbor(msg)
+	}
+
+	return "", formatError("unknown format, expected JSON-LD, JWT, SD-JWT or mdoc")
+}
+
+func detectJsonLd(msg []byte) (string, error) {
+	var claims map[string]interface{}
+
+	if err := json.Unmarshal(msg, &claims); err != nil {
+		return "", formatError("malformed JSON: %s", err.Error())
+	}
+
+	if _, ok := claims["@context"]; !ok {
+		return "", formatError("JSON-LD @context missing")
+	}
+
+	for _, t := range stringList(claims["type"]) {
+		switch t {
+		case "VerifiableCredential":
+			return FormatLdpVc, nil
+		case "VerifiablePresentation":
+			return FormatLdpVp, nil
+		}
+	}
+
+	return "", formatError("type contains neither VerifiableCredential nor VerifiablePresentation")
+}
+
+func detectJwt(compact string) (string, error) {
+	claims, err := jwtClaims(compact)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := claims["vp"].(map[string]interface{}); ok {
+		return FormatJwtVp, nil
+	}
+
+	if _, ok := claims["vc"].(map[string]interface{}); ok {
+		return FormatJwtVc, nil
+	}
+
+	return "", formatError("JWT contains neither a vc nor a vp claim")
+}
+
+func detectSdJwt(compact string) (string, error) {
+	parts := strings.Split(compact, "~")
+
+	claims, err := jwtClaims(parts[0])
+
+	if err != nil {
+		return "", err
+	}
+
+	if vct, _ := claims["vct"].(string); vct == "" {
+		return "", formatError("SD-JWT VC without vct claim")
+	}
+
+	for n, disclosure := range parts[1 : len(parts)-1] {
+		if _, err := decodeDisclosure(disclosure); err != nil {
+			return "", formatError("disclosure %d: %s", n+1, err.Error())
+		}
+	}
+
+	// the last part is empty or a key binding JWT
+	if last := parts[len(parts)-1]; last != "" {
+		if _, err := jwtClaims(last); err != nil {
+			return "", formatError("key binding JWT: %s", err.Error())
+		}
+	}
+
+	return FormatSdJwtVc, nil
+}
+
+// jwtClaims decodes the payload of a compact JWT without verifying the signature.
+func jwtClaims(compact string) (map[string]interface{}, error) {
+	parts := strings.Split(compact, ".")
+
+	if len(parts) != 3 {
+		return nil, formatError("JWT must consist of three parts")
+	}
+
+	var header map[string]interface{}
+	if err := decodeJson(parts[0], &header); err != nil {
+		return nil, formatError("JWT header: %s", err.Error())
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJson(parts[1], &claims); err != nil {
+		return nil, formatError("JWT payload: %s", err.Error())
+	}
+
+	if _, err := b64.RawURLEncoding.DecodeString(parts[2]); err != nil || parts[2] == "" {
+		return nil, formatError("JWT signature is not base64url encoded")
+	}
+
+	return claims, nil
+}
+
+// decodeDisclosure decodes an SD-JWT disclosure, an array of salt, optional claim name and value.
+func decodeDisclosure(disclosure string) ([]interface{}, error) {
+	var values []interface{}
+
+	if err := decodeJson(disclosure, &values); err != nil {
+		return nil, err
+	}
+
+	if len(values) != 2 && len(values) != 3 {
+		return nil, errors.New("disclosure must be an array of two or three elements")
+	}
+
+	return values, nil
+}
+
+func decodeJson(part string, target any) error {
+	data, err := b64.RawURLEncoding.DecodeString(part)
+
+	if err != nil {
+		return errors.New("not base64url encoded")
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return errors.New("not valid JSON")
+	}
+
+	return nil
+}
+
+func isText(msg []byte) bool {
+	for _, c := range msg {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// isCborMap reports whether the data starts with a CBOR map, which mdoc documents and IssuerSigned structures are.
+func isCborMap(data []byte) bool {
+	return len(data) > 0 && data[0]>>5 == 5
+}
+
+// validateCbor checks that the data is exactly one well formed CBOR data item.
+func validateCbor(data []byte) error {
+	rest, err := skipCbor(data, 0)
+
+	if err != nil {
+		return formatError("mdoc is not valid CBOR: %s", err.Error())
+	}
+
+	if len(rest) != 0 {
+		return formatError("mdoc contains trailing bytes")
+	}
+
+	return nil
+}
+
+const maxCborDepth = 64
+
+func skipCbor(data []byte, depth int) ([]byte, error) {
+	if depth > maxCborDepth {
+		return nil, errors.New("nesting too deep")
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("unexpected end")
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if info == 31 {
+		return skipIndefinite(data, major, depth)
+	}
+
+	value, data, err := cborArgument(data, info)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0, 1, 7:
+		return data, nil
+	case 2, 3:
+		if uint64(len(data)) < value {
+			return nil, errors.New("unexpected end")
+		}
+		return data[value:], nil
+	case 4, 5:
+		items := value
+		if major == 5 {
+			items *= 2
+		}
+		for i := uint64(0); i < items; i++ {
+			if data, err = skipCbor(data, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	default:
+		// tag, followed by one data item
+		return skipCbor(data, depth+1)
+	}
+}
+
+func skipIndefinite(data []byte, major byte, depth int) ([]byte, error) {
+	if major < 2 || major > 5 {
+		return nil, errors.New("invalid indefinite length")
+	}
+
+	var err error
+	for {
+		if len(data) == 0 {
+			return nil, errors.New("unexpected end")
+		}
+		if data[0] == 0xff {
+			return data[1:], nil
+		}
+		if data, err = skipCbor(data, depth+1); err != nil {
+			return nil, err
+		}
+		if major == 5 {
+			if data, err = skipCbor(data, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func cborArgument(data []byte, info byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	case info > 27:
+		return 0, nil, errors.New("reserved additional information")
+	}
+	return 0, nil, errors.New("unexpected end")
+}
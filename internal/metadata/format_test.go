@@ -0,0 +1,59 @@
+package metadata
+
+import (
+	b64 "encoding/base64"
+	"errors"
+	"testing"
+)
+
+func jwt(payload string) string {
+	return b64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." +
+		b64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestDetect(t *testing.T) {
+	// {"docType": "org.iso.18013.5.1.mDL", "nameSpaces": {}} in CBOR
+	mdoc := []byte{0xa2, 0x67, 'd', 'o', 'c', 'T', 'y', 'p', 'e', 0x75,
+		'o', 'r', 'g', '.', 'i', 's', 'o', '.', '1', '8', '0', '1', '3', '.', '5', '.', '1', '.', 'm', 'D', 'L',
+		0x6a, 'n', 'a', 'm', 'e', 'S', 'p', 'a', 'c', 'e', 's', 0xa0}
+
+	formats := map[string]string{
+		jsonLdCredential: FormatLdpVc,
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"VerifiablePresentation"}`: FormatLdpVp,
+		jwt(`{"iss":"did:example:issuer","vc":{"type":["VerifiableCredential"]}}`):                FormatJwtVc,
+		jwt(`{"iss":"did:example:holder","vp":{"type":["VerifiablePresentation"]}}`):              FormatJwtVp,
+		sdJwt(`{"iss":"did:example:issuer","vct":"https://example.com/pid"}`):                     FormatSdJwtVc,
+		string(mdoc):                            FormatMsoMdoc,
+		b64.RawURLEncoding.EncodeToString(mdoc): FormatMsoMdoc,
+	}
+
+	for msg, expected := range formats {
+		format, err := Detect([]byte(msg))
+		if err != nil || format != expected {
+			t.Error("format is wrong", expected, format, err)
+		}
+	}
+}
+
+func TestDetectMalformed(t *testing.T) {
+	malformed := []string{
+		"",
+		"just a string",
+		`{"type": ["VerifiableCredential"]`,
+		`{"type": ["VerifiableCredential"]}`,
+		`{"@context": [], "type": ["Other"]}`,
+		jwt(`{"iss":"did:example:issuer"}`),
+		"eyJhbGciOiJFUzI1NiJ9.bm8ganNvbg.c2ln",
+		sdJwt(`{"iss":"did:example:issuer"}`),
+		jwt(`{"vct":"https://example.com/pid"}`) + "~not-a-disclosure~",
+		string([]byte{0xa1, 0x61, 'a'}),
+		string([]byte{0xa0, 0x00}),
+	}
+
+	for _, msg := range malformed {
+		_, err := Detect([]byte(msg))
+		if !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%q should be rejected, but was %v", msg, err)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+const (
+	ModeNone   = "NONE"
+	ModePlain  = "PLAIN"
+	ModeHashed = "HASHED"
+)
+
+// Keys of the metadata index.
+const (
+	TypeField   = "type"
+	IssuerField = "issuer"
+	ExpiryField = "expiry"
+	FormatField = "format"
+	VctField    = "vct"
+)
+
+// Formats as named in the OpenID4VP specification.
+const (
+	FormatLdpVc   = "ldp_vc"
+	FormatLdpVp   = "ldp_vp"
+	FormatJwtVc   = "jwt_vc_json"
+	FormatJwtVp   = "jwt_vp_json"
+	FormatSdJwtVc = "vc+sd-jwt"
+)
+
+// Fields are the values extracted from a credential. Empty fields were not found.
+type Fields struct {
+	// Id is the id of a JSON-LD credential or the jti of a JWT.
+	Id     string
+	Types  []string
+	Issuer string
+	Expiry time.Time
+	Format string
+	Vct    string
+}
+
+// Query narrows the items by their metadata. Empty fields match everything.
+type Query struct {
+	Type   string
+	Issuer string
+	Format string
+	Vct    string
+}
+
+func (q Query) Empty() bool {
+	return q.Type == "" && q.Issuer == "" && q.Format == "" && q.Vct == ""
+}
+
+/*
+Indexer builds the metadata index of items at store time and matches queries against it. In hashed mode the
+values are stored as HMAC-SHA256 with the configured salt, so the database never sees them in plaintext.
+*/
+type Indexer struct {
+	mode string
+	salt []byte
+}
+
+func NewIndexer(mode string, salt string) (*Indexer, error) {
+	mode = strings.ToUpper(mode)
+
+	if mode == "" {
+		mode = ModeNone
+	}
+
+	if mode != ModeNone && mode != ModePlain && mode != ModeHashed {
+		return nil, errors.New("unsupported metadata mode: " + mode)
+	}
+
+	// without salt the hashes of low entropy values like issuers and types can be brute-forced
+	if mode == ModeHashed && salt == "" {
+		return nil, errors.New("metadata mode HASHED requires a salt")
+	}
+
+	return &Indexer{mode: mode, salt: []byte(salt)}, nil
+}
+
+func (i *Indexer) Enabled() bool {
+	return i != nil && i.mode != ModeNone
+}
+
+func (i *Indexer) value(v string) string {
+	if i.mode != ModeHashed {
+		return v
+	}
+
+	mac := hmac.New(sha256.New, i.salt)
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+Usage: Extracts the metadata of a plaintext credential. Returns empty metadata when indexing is disabled.
+The expiry is always stored as plain unix time, because it is compared by range and not by equality.
+*/
+
+func (i *Indexer) Metadata(msg []byte) repository.ItemMetadata {
+	return i.Index(Extract(msg))
+}
+
+// Index builds the metadata index of extracted fields. Returns empty metadata when indexing is disabled.
+func (i *Indexer) Index(fields Fields) repository.ItemMetadata {
+	var metadata repository.ItemMetadata
+
+	if !i.Enabled() {
+		return metadata
+	}
+
+	metadata.Format = fields.Format
+	metadata.Index = make(map[string]string)
+
+	if i.mode == ModePlain {
+		metadata.Type = strings.Join(fields.Types, ",")
+		metadata.Issuer = fields.Issuer
+	}
+
+	if len(fields.Types) > 0 {
+		types := make([]string, len(fields.Types))
+		for n, t := range fields.Types {
+			types[n] = i.value(t)
+		}
+		metadata.Index[TypeField] = strings.Join(types, ",")
+	}
+
+	if fields.Issuer != "" {
+		metadata.Index[IssuerField] = i.value(fields.Issuer)
+	}
+
+	if fields.Format != "" {
+		metadata.Index[FormatField] = i.value(fields.Format)
+	}
+
+	if fields.Vct != "" {
+		metadata.Index[VctField] = i.value(fields.Vct)
+	}
+
+	if !fields.Expiry.IsZero() {
+		metadata.Index[ExpiryField] = strconv.FormatInt(fields.Expiry.Unix(), 10)
+	}
+
+	return metadata
+}
+
+// Matches reports whether an item index fulfills all fields of the query. A type matches any of the item types.
+func (i *Indexer) Matches(index map[string]string, query Query) bool {
+	if query.Type != "" {
+		found := false
+		for _, t := range strings.Split(index[TypeField], ",") {
+			if t == i.value(query.Type) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return (query.Issuer == "" || index[IssuerField] == i.value(query.Issuer)) &&
+		(query.Format == "" || index[FormatField] == i.value(query.Format)) &&
+		(query.Vct == "" || index[VctField] == i.value(query.Vct))
+}
+
+// Extract reads the metadata out of JSON-LD, JWT and SD-JWT credentials. Of mdoc documents just the format is known.
+func Extract(msg []byte) Fields {
+	format, err := Detect(msg)
+
+	if err != nil {
+		return Fields{}
+	}
+
+	msg = bytes.TrimSpace(msg)
+
+	switch format {
+	case FormatLdpVc, FormatLdpVp:
+		var claims map[string]interface{}
+		if json.Unmarshal(msg, &claims) != nil {
+			return Fields{}
+		}
+		return extractJsonLd(claims, format)
+	case FormatJwtVc, FormatJwtVp, FormatSdJwtVc:
+		compact, _, _ := strings.Cut(string(msg), "~")
+		claims, err := jwtClaims(compact)
+		if err != nil {
+			return Fields{}
+		}
+		return extractJwt(claims, format)
+	}
+
+	return Fields{Format: format}
+}
+
+/*
+Protected reads the metadata of an item which the device encrypted out of the protected header of the JWE, which the
+content encryption authenticates. The device replicates the claims it wants to be searchable there as iss, exp,
+type, vct and format, the content itself is never read.
+*/
+func Protected(msg []byte) Fields {
+	encrypted, err := jwe.Parse(msg)
+
+	if err != nil {
+		return Fields{}
+	}
+
+	headers := encrypted.ProtectedHeaders()
+	header := func(name string) interface{} {
+		value, _ := headers.Get(name)
+		return value
+	}
+
+	fields := Fields{
+		Types:  stringList(header("type")),
+		Issuer: issuer(header("iss")),
+		Format: stringValue(header("format")),
+		Vct:    stringValue(header("vct")),
+	}
+
+	if exp, ok := header("exp").(float64); ok {
+		fields.Expiry = time.Unix(int64(exp), 0)
+	}
+
+	return fields
+}
+
+func extractJsonLd(claims map[string]interface{}, format string) Fields {
+	fields := Fields{
+		Types:  stringList(claims["type"]),
+		Id:     stringValue(claims["id"]),
+		Issuer: issuer(claims["issuer"]),
+		Format: format,
+	}
+
+	for _, name := range []string{"expirationDate", "validUntil"} {
+		if s, ok := claims[name].(string); ok {
+			if expiry, err := time.Parse(time.RFC3339, s); err == nil {
+				fields.Expiry = expiry
+			}
+		}
+	}
+
+	return fields
+}
+
+func extractJwt(claims map[string]interface{}, format string) Fields {
+	fields := Fields{Format: format, Id: stringValue(claims["jti"])}
+
+	switch format {
+	case FormatSdJwtVc:
+		fields.Vct, _ = claims["vct"].(string)
+		fields.Types = []string{fields.Vct}
+	case FormatJwtVp:
+		if vp, ok := claims["vp"].(map[string]interface{}); ok {
+			fields.Types = stringList(vp["type"])
+		}
+	default:
+		if vc, ok := claims["vc"].(map[string]interface{}); ok {
+			fields.Types = stringList(vc["type"])
+			fields.Issuer = issuer(vc["issuer"])
+			if fields.Id == "" {
+				fields.Id = stringValue(vc["id"])
+			}
+		}
+	}
+
+	if iss, ok := claims["iss"].(string); ok {
+		fields.Issuer = iss
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		fields.Expiry = time.Unix(int64(exp), 0)
+	}
+
+	return fields
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// issuer reads the issuer which is either a DID string or an object with an id.
+func issuer(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		id, _ := v["id"].(string)
+		return id
+	}
+	return ""
+}
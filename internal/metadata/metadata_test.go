@@ -0,0 +1,131 @@
+package metadata
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	b64 "encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+const jsonLdCredential = `{
+	"@context": ["https://www.w3.org/2018/credentials/v1"],
+	"id": "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5",
+	"type": ["VerifiableCredential", "UniversityDegreeCredential"],
+	"issuer": {"id": "did:example:university"},
+	"expirationDate": "2030-01-01T00:00:00Z",
+	"credentialSubject": {"id": "did:example:holder"}
+}`
+
+func sdJwt(payload string) string {
+	return b64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." +
+		b64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl~WyJzYWx0IiwiZG9iIiwiMjAwMCJd~"
+}
+
+func TestExtractJsonLd(t *testing.T) {
+	fields := Extract([]byte(jsonLdCredential))
+
+	if fields.Format != FormatLdpVc || fields.Issuer != "did:example:university" || len(fields.Types) != 2 || fields.Id != "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5" {
+		t.Error("fields are wrong", fields)
+	}
+
+	if !fields.Expiry.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expiry is wrong", fields.Expiry)
+	}
+}
+
+func TestExtractSdJwt(t *testing.T) {
+	fields := Extract([]byte(sdJwt(`{"iss":"did:example:issuer","vct":"https://example.com/pid","exp":1893456000,"jti":"pid-1"}`)))
+
+	if fields.Format != FormatSdJwtVc || fields.Issuer != "did:example:issuer" || fields.Vct != "https://example.com/pid" || fields.Expiry.Unix() != 1893456000 || fields.Id != "pid-1" {
+		t.Error("fields are wrong", fields)
+	}
+}
+
+func TestExtractOpaque(t *testing.T) {
+	fields := Extract([]byte("not a credential"))
+
+	if fields.Format != "" || len(fields.Types) != 0 {
+		t.Error("opaque content should not have fields", fields)
+	}
+}
+
+func TestExtractProtected(t *testing.T) {
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	headers := jwe.NewHeaders()
+	headers.Set("type", []string{"VerifiableCredential", "PID"})
+	headers.Set("iss", "did:example:issuer")
+	headers.Set("exp", 1893456000)
+
+	encrypted, err := jwe.Encrypt([]byte(jsonLdCredential), jwe.WithKey(jwa.ECDH_ES_A256KW, &private.PublicKey), jwe.WithProtectedHeaders(headers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := Protected(encrypted)
+
+	if len(fields.Types) != 2 || fields.Issuer != "did:example:issuer" || fields.Expiry.Unix() != 1893456000 || fields.Id != "" || fields.Format != "" {
+		t.Error("fields are wrong", fields)
+	}
+
+	if fields := Protected([]byte(jsonLdCredential)); fields.Issuer != "" || len(fields.Types) != 0 {
+		t.Error("plain content should not be read", fields)
+	}
+}
+
+func TestHashedIndex(t *testing.T) {
+	indexer, err := NewIndexer(ModeHashed, "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := indexer.Metadata([]byte(jsonLdCredential))
+
+	if metadata.Type != "" || metadata.Issuer != "" || metadata.Index[IssuerField] == "did:example:university" {
+		t.Error("hashed metadata contains plaintext", metadata)
+	}
+
+	if !indexer.Matches(metadata.Index, Query{Type: "UniversityDegreeCredential", Issuer: "did:example:university"}) {
+		t.Error("query should match")
+	}
+
+	if indexer.Matches(metadata.Index, Query{Type: "DriversLicense"}) {
+		t.Error("query should not match")
+	}
+
+	other, _ := NewIndexer(ModeHashed, "other")
+	if other.Matches(metadata.Index, Query{Issuer: "did:example:university"}) {
+		t.Error("query with other salt should not match")
+	}
+}
+
+func TestDisabledIndex(t *testing.T) {
+	indexer, err := NewIndexer("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if indexer.Enabled() || indexer.Metadata([]byte(jsonLdCredential)).Index != nil {
+		t.Error("index should be disabled")
+	}
+
+	var missing *Indexer
+	if missing.Enabled() {
+		t.Error("missing indexer should be disabled")
+	}
+
+	_, err = NewIndexer("SOMETIMES", "")
+	if err == nil {
+		t.Error("unknown mode should fail")
+	}
+
+	_, err = NewIndexer(ModeHashed, "")
+	if err == nil {
+		t.Error("hashed mode without salt should fail")
+	}
+}
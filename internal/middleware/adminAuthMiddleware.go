@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const AdminTokenInvalid = "Admin token invalid."
+
+// AdminAuth protects the administration routes by a static bearer token, which is independent of the account tokens.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": AdminTokenInvalid})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
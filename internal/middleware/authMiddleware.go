@@ -4,16 +4,15 @@ import (
 	"context"
 	b64 "encoding/base64"
 	"errors"
-	"fmt"
 	"net/http"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
 
 	"github.com/eclipse-xfsc/crypto-provider-core/types"
 	"github.com/gin-gonic/gin"
-	"github.com/gocql/gocql"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jws"
@@ -51,11 +50,12 @@ func authFunc(env *common.Environment, c *gin.Context, recovery bool, nonceRequi
 	}
 
 	authModel := authObject.(model.AuthModel)
+	locked := false
 	token, err := jwt.ParseRequest(c.Request,
 		jwt.WithSubject(authModel.Account),
 		jwt.WithKeyProvider(jws.KeyProviderFunc(jws.KeyProviderFunc(
 			func(context context.Context, sink jws.KeySink, sig *jws.Signature, message *jws.Message) error {
-				return dbCheckUp(env, &authModel, context, sink, sig, message)
+				return dbCheckUp(env, &authModel, &locked, context, sink, sig, message)
 			}))))
 
 	if err != nil {
@@ -65,6 +65,16 @@ func authFunc(env *common.Environment, c *gin.Context, recovery bool, nonceRequi
 		return
 	}
 
+	// the lock is announced for verified tokens only, forged tokens naming a locked account cause no events
+	if locked {
+		services.PublishLocked(c.Request.Context(), env, authModel)
+		c.JSON(http.StatusForbidden, gin.H{"message": AccountLockedError})
+		c.Abort()
+		return
+	}
+
+	env.GetPublisher().Unlocked(authModel.TenantId, authModel.Account)
+
 	if nonceRequired {
 		field, exist := token.Get("nonce")
 
@@ -89,66 +99,48 @@ func authFunc(env *common.Environment, c *gin.Context, recovery bool, nonceRequi
 		}
 	}
 
-	if err != nil && err.Error() == AccountLockedError {
-		c.JSON(http.StatusForbidden, gin.H{"message": AccountLockedError})
-		c.Abort()
-		return
-	}
-
 	if token == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": BearerMissing})
 		c.Abort()
 		return
 	}
 
+	authModel.Token = &token
 	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), model.AuthModelKey, authModel))
 	c.Next()
 }
 
-func dbCheckUp(env *common.Environment, authModel *model.AuthModel, context context.Context, sink jws.KeySink, sig *jws.Signature, message *jws.Message) error {
+/*
+dbCheckUp provides the key of the device to the verification of the token. It runs before the signature is verified,
+so a locked account is only marked and refused once the token was verified.
+*/
+func dbCheckUp(env *common.Environment, authModel *model.AuthModel, locked *bool, context context.Context, sink jws.KeySink, sig *jws.Signature, message *jws.Message) error {
 
-	var device_key = ""
-	var locked bool
-	var nonce = ""
-	var signature = ""
-	var recovery_nonce = ""
-	session := env.GetSession()
 	logger := env.GetLogger()
 
-	queryString := fmt.Sprintf(`SELECT device_key,locked, nonce, signature, recovery_nonce FROM %s.credentials WHERE accountPartition=? AND 
-																						     region=? AND 
-																						     country=? AND 
-																						     account=? LIMIT 1;`, authModel.TenantId)
-
-	query := session.Query(queryString,
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account)
-
-	err := query.Consistency(gocql.LocalQuorum).Scan(&device_key, &locked, &nonce, &signature, &recovery_nonce)
+	// the kid of the token names the device, accounts with a single device may omit it
+	record, err := env.GetRepository().LoadDevice(context, env.GetAccountKey(*authModel), sig.ProtectedHeaders().KeyID())
 
 	if err == nil {
-		if locked {
-			return errors.New(AccountLockedError)
-		}
+		// accounts are locked outside of the service, a refused request is the first moment the service sees it
+		*locked = record.Locked
 
-		sig, err := b64.StdEncoding.DecodeString(signature)
+		sig, err := b64.StdEncoding.DecodeString(record.Signature)
 
 		if err != nil {
 			return errors.New(NoValidSignatureFormat)
 		}
 
-		jwkJson, err := b64.StdEncoding.DecodeString(device_key)
+		jwkJson, err := b64.StdEncoding.DecodeString(record.DeviceKey)
 
 		if err != nil {
 			return errors.New(NoValidSignatureFormat)
 		}
 
 		b, err := env.GetCryptoProvider().Verify(types.CryptoIdentifier{
-			KeyId: env.GetCryptoSignKey(),
+			KeyId: env.GetCryptoSignKey(authModel.TenantId),
 			CryptoContext: types.CryptoContext{
-				Namespace: env.GetCryptoNamespace(),
+				Namespace: env.GetCryptoNamespace(authModel.TenantId),
 				Context:   context,
 				Group:     common.StorageCryptoContext,
 			},
@@ -175,8 +167,9 @@ func dbCheckUp(env *common.Environment, authModel *model.AuthModel, context cont
 			}
 
 			authModel.Device_Key = &key
-			authModel.Nonce = nonce
-			authModel.Recovery_Nonce = recovery_nonce
+			authModel.DeviceId = record.Id
+			authModel.Nonce = record.Nonce
+			authModel.Recovery_Nonce = record.RecoveryNonce
 
 			if err == nil {
 				return nil
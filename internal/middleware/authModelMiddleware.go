@@ -5,35 +5,38 @@ import (
 	"net/http"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
 	"github.com/gin-gonic/gin"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
-func AuthModel() gin.HandlerFunc {
+// AuthModel creates the auth model of the request, the content type is the one of the route group.
+func AuthModel(contentType string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		authModelFunc(ctx, nil)
+		authModelFunc(ctx, contentType, nil)
 	}
 }
 
-func AuthTestModel(deviceKey *jwk.Key) gin.HandlerFunc {
+func AuthTestModel(contentType string, deviceKey *jwk.Key) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		authModelFunc(ctx, deviceKey)
+		authModelFunc(ctx, contentType, deviceKey)
 	}
 }
 
-func createAuthModel(account string, tenantId string, deviceKey *jwk.Key) model.AuthModel {
+func createAuthModel(account string, tenantId string, contentType string, deviceKey *jwk.Key) model.AuthModel {
 	authModel := model.AuthModel{
-		TenantId:   tenantId,
-		Account:    account,
-		Device_Key: deviceKey,
+		TenantId:    tenantId,
+		Account:     account,
+		ContentType: contentType,
+		Device_Key:  deviceKey,
 	}
 	return authModel
 }
 
-func authModelFunc(c *gin.Context, deviceKey *jwk.Key) {
+func authModelFunc(c *gin.Context, contentType string, deviceKey *jwk.Key) {
 	account := c.Param("account")
 	tenantId := c.Param("tenantId")
-	authModel := createAuthModel(account, tenantId, deviceKey)
+	authModel := createAuthModel(account, tenantId, contentType, deviceKey)
 
 	if tenantId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"message": TenantIdMissing})
@@ -47,6 +50,10 @@ func authModelFunc(c *gin.Context, deviceKey *jwk.Key) {
 		return
 	}
 
+	if tenant, ok := c.Get(tenantKey); ok {
+		authModel.Keyspace = tenant.(tenancy.Tenant).Keyspace
+	}
+
 	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), model.AuthModelKey, authModel))
 	c.Next()
 }
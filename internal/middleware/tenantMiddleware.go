@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
+	"github.com/gin-gonic/gin"
+)
+
+const TenantUnknown = "Tenant unknown."
+const ModeNotEnabled = "Mode not enabled for tenant."
+
+// tenantKey holds the resolved tenant in the gin context, the auth model picks its keyspace up.
+const tenantKey = "tenant"
+
+// Tenant rejects tenants which are not on the allow-list, before any query with their id is made.
+func Tenant(env *common.Environment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantFunc(env, c)
+	}
+}
+
+func tenantFunc(env *common.Environment, c *gin.Context) {
+	tenantId := c.Param("tenantId")
+
+	if tenantId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": TenantIdMissing})
+		c.Abort()
+		return
+	}
+
+	tenant, err := env.GetTenantResolver().Resolve(c.Request.Context(), env.GetRepository(), tenantId)
+
+	if errors.Is(err, tenancy.ErrUnknownTenant) {
+		c.JSON(http.StatusForbidden, gin.H{"message": TenantUnknown})
+		c.Abort()
+		return
+	}
+
+	if err != nil {
+		env.GetLogger().Error(err, "Tenant could not be resolved", "tenant", tenantId)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": TenantUnknown})
+		c.Abort()
+		return
+	}
+
+	c.Set(tenantKey, tenant)
+	c.Next()
+}
+
+// TenantMode rejects tenants whose settings do not enable the mode of the route group.
+func TenantMode(env *common.Environment, mode string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !env.IsModeEnabled(c.Param("tenantId"), mode) {
+			c.JSON(http.StatusForbidden, gin.H{"message": ModeNotEnabled})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
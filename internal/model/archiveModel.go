@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Kinds of archived items.
+const (
+	CredentialKind   = "credential"
+	PresentationKind = "presentation"
+)
+
+// Outcomes of imported items.
+const (
+	ImportStored      = "stored"
+	ImportSkipped     = "skipped"
+	ImportOverwritten = "overwritten"
+	ImportRenamed     = "renamed"
+	ImportFailed      = "failed"
+)
+
+// ArchiveModel contains all credentials and presentations of an account, a remote export carries the receipt of the renewed nonce.
+type ArchiveModel struct {
+	Exported time.Time     `json:"exported"`
+	Items    []ArchiveItem `json:"items"`
+	Receipt  string        `json:"receipt,omitempty"`
+}
+
+// ArchiveItem is a stored item with its metadata. Only kind, id and content are read by an import.
+type ArchiveItem struct {
+	Kind    string     `json:"kind"`
+	Id      string     `json:"id"`
+	Content string     `json:"content"`
+	Format  string     `json:"format,omitempty"`
+	Type    string     `json:"type,omitempty"`
+	Issuer  string     `json:"issuer,omitempty"`
+	Created time.Time  `json:"created,omitempty"`
+	Updated time.Time  `json:"updated,omitempty"`
+	Expiry  *time.Time `json:"expiry,omitempty"`
+	Version int64      `json:"version,omitempty"`
+}
+
+type ImportResultModel struct {
+	Items   []ImportItemResult `json:"items"`
+	Receipt string             `json:"receipt,omitempty"`
+}
+
+// ImportItemResult reports the outcome of an item, StoredId differs from Id when the item was renamed.
+type ImportItemResult struct {
+	Kind     string `json:"kind"`
+	Id       string `json:"id"`
+	StoredId string `json:"storedId,omitempty"`
+	Status   string `json:"status"`
+	Version  int64  `json:"version,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
@@ -12,9 +12,15 @@ const (
 )
 
 type AuthModel struct {
-	Account        string
-	TenantId       string
-	Device_Key     *jwk.Key
+	Account  string
+	TenantId string
+	// Keyspace is the storage of the tenant, resolved from the tenant id by the allow-list.
+	Keyspace string
+	// ContentType is the content type of the route group or messages, JSON for DIRECT and JOSE for REMOTE.
+	ContentType string
+	Device_Key  *jwk.Key
+	// DeviceId is the id of the device the request was signed by.
+	DeviceId       string
 	Nonce          string
 	Recovery_Nonce string
 	Token          *jwt.Token
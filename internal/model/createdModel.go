@@ -0,0 +1,6 @@
+package model
+
+// CreatedModel returns the id which the service chose for a stored item.
+type CreatedModel struct {
+	Id string `json:"id"`
+}
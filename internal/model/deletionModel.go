@@ -0,0 +1,8 @@
+package model
+
+type DeletionModel struct {
+	Account string `json:"account"`
+	// Device is the id of the deleted device, it is empty when the whole account was deleted.
+	Device  string `json:"device,omitempty"`
+	Deleted int64  `json:"deleted"`
+}
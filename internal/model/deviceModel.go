@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// DeviceModel describes a device bound to an account, Current marks the device of the request.
+type DeviceModel struct {
+	Id       string     `json:"id"`
+	Label    string     `json:"label,omitempty"`
+	Created  time.Time  `json:"created"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	Current  bool       `json:"current,omitempty"`
+}
+
+type DevicesModel struct {
+	Devices []DeviceModel `json:"devices"`
+	Receipt string        `json:"receipt,omitempty"`
+}
+
+// AddedDeviceModel answers an added device. Registration is the RegistrationModel of the new device, encrypted for its key.
+type AddedDeviceModel struct {
+	Device       DeviceModel `json:"device"`
+	Registration string      `json:"registration"`
+	Receipt      string      `json:"receipt,omitempty"`
+}
@@ -1,9 +1,28 @@
 package model
 
-import "github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
+import (
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/dcql"
+
+	"github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
+)
 
 type GetCredentialModel struct {
 	Credentials map[string]interface{}      `json:"credentials,omitempty"`
 	Receipt     string                      `json:"receipt,omitempty"`
 	Groups      []presentation.FilterResult `json:"groups,omitempty"`
+	Matches     []dcql.Result               `json:"matches,omitempty"`
+	Next        string                      `json:"next,omitempty"`
+	Formats     map[string]string           `json:"formats,omitempty"`
+	Expired     []string                    `json:"expired,omitempty"`
+	Status      map[string]string           `json:"status,omitempty"`
+}
+
+type GetCredentialItemModel struct {
+	Id         string      `json:"id"`
+	Credential interface{} `json:"credential"`
+	Format     string      `json:"format,omitempty"`
+	Expired    bool        `json:"expired,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Version    int64       `json:"version,omitempty"`
+	Receipt    string      `json:"receipt,omitempty"`
 }
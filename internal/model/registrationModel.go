@@ -2,4 +2,6 @@ package model
 
 type RegistrationModel struct {
 	Recovery_Nonce string `json:"recovery_nonce"`
+	// DeviceId is the kid under which the device signs its tokens.
+	DeviceId string `json:"device_id"`
 }
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+)
+
+// TenantModel describes a tenant, without replication the configured default is used on creation.
+type TenantModel struct {
+	Name        string                  `json:"name"`
+	Replication *repository.Replication `json:"replication,omitempty"`
+	Created     *time.Time              `json:"created,omitempty"`
+	Metadata    map[string]string       `json:"metadata,omitempty"`
+}
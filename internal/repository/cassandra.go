@@ -0,0 +1,912 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/connection"
+	"github.com/gocql/gocql"
+)
+
+type CassandraRepository struct {
+	session connection.SessionInterface
+}
+
+func NewCassandraRepository(session connection.SessionInterface) Repository {
+	return &CassandraRepository{session: session}
+}
+
+func (r *CassandraRepository) Closed() bool {
+	return r.session.Closed()
+}
+
+func (r *CassandraRepository) Close() {
+	r.session.Close()
+}
+
+func (r *CassandraRepository) StoreItem(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool) error {
+	_, err := r.StoreItemIf(ctx, key, id, content, metadata, presentation, Condition{})
+	return err
+}
+
+// maxStoreAttempts limits the retries of an unconditional store which lost against concurrent stores of the item.
+const maxStoreAttempts = 5
+
+/*
+StoreItemIf writes every store as lightweight transaction on the version it read, so that concurrent writers can not
+store the same version with different content. An unconditional store which lost is retried on the new version, a
+conditional one fails.
+*/
+func (r *CassandraRepository) StoreItemIf(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool, condition Condition) (int64, error) {
+	conditional := condition.Absent || condition.Exists || condition.Version > 0
+	var version int64
+
+	for attempt := 1; ; attempt++ {
+		state, err := r.loadState(ctx, key, id, presentation)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if err := condition.check(state.version, state.idempotencyKey); err != nil {
+			return state.version, err
+		}
+
+		applied, err := r.writeItem(ctx, key, id, content, metadata, presentation, condition, state)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if applied {
+			version = state.version + 1
+			break
+		}
+
+		switch {
+		case conditional && state.version == 0:
+			return 0, ErrExists
+		case conditional:
+			return 0, ErrVersionMismatch
+		case attempt == maxStoreAttempts:
+			return 0, errors.New("item stored concurrently, store not applied")
+		}
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.credentials SET locked=False, last_update_timestamp=toTimestamp(now()) WHERE 
+																  		  accountPartition=? AND 
+																					region=? AND 
+																					country=? AND
+																					account=?;`, key.Tenant)
+
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).WithContext(ctx).Exec()
+
+	return version, err
+}
+
+// writeItem inserts a new item or updates the item in the read version, it reports whether the write was applied.
+func (r *CassandraRepository) writeItem(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool, condition Condition, state itemState) (bool, error) {
+	version := state.version + 1
+
+	if state.version == 0 {
+		queryString := fmt.Sprintf(`INSERT INTO %s.credential_items (accountPartition, region, country, account, kind, id, content, type, issuer, format, metadata, created, updated, expiry, version, idempotency_key)
+																					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, toTimestamp(now()), ?, ?, ?) IF NOT EXISTS;`, key.Tenant)
+		return r.session.Query(queryString,
+			key.Partition,
+			key.Region,
+			key.Country,
+			key.Account,
+			objectName(presentation),
+			id,
+			content,
+			metadata.Type,
+			metadata.Issuer,
+			metadata.Format,
+			metadata.Index,
+			state.created,
+			nullTime(metadata.Expiry),
+			version,
+			condition.IdempotencyKey).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.credential_items SET content=?, type=?, issuer=?, format=?, metadata=?, created=?, expiry=?, version=?, idempotency_key=?, updated=toTimestamp(now()) WHERE 
+																  		  accountPartition=? AND 
+																					region=? AND 
+																					country=? AND
+																					account=? AND
+																					kind=? AND
+																					id=? IF version=?;`, key.Tenant)
+	return r.session.Query(queryString,
+		content,
+		metadata.Type,
+		metadata.Issuer,
+		metadata.Format,
+		metadata.Index,
+		state.created,
+		nullTime(metadata.Expiry),
+		version,
+		condition.IdempotencyKey,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		id,
+		state.storedVersion()).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+}
+
+// itemState is the stored state of an item which a store depends on.
+type itemState struct {
+	created        time.Time
+	version        int64
+	idempotencyKey string
+	// legacy items were stored before versions were introduced, their version column is null
+	legacy bool
+}
+
+// storedVersion returns the value of the version column, which a lightweight transaction compares.
+func (s itemState) storedVersion() interface{} {
+	if s.legacy {
+		return nil
+	}
+	return s.version
+}
+
+// loadState returns the state of an existing item, or a zero version and the current time for a new one.
+func (r *CassandraRepository) loadState(ctx context.Context, key AccountKey, id string, presentation bool) (itemState, error) {
+	var state itemState
+	var version *int64
+	queryString := fmt.Sprintf(`SELECT created, version, idempotency_key FROM %s.credential_items WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=? AND
+																					kind=? AND
+																					id=?;`, key.Tenant)
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		id).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&state.created, &version, &state.idempotencyKey)
+
+	if err != nil && !errors.Is(err, gocql.ErrNotFound) {
+		return state, errors.Join(errors.New("db query error"), err)
+	}
+
+	if err == nil {
+		if version != nil {
+			state.version = *version
+		} else {
+			state.version, state.legacy = 1, true
+		}
+	}
+
+	if state.created.IsZero() {
+		state.created = time.Now()
+	}
+
+	return state, nil
+}
+
+// locked reports whether the account is locked. Items of locked accounts are not returned.
+func (r *CassandraRepository) locked(ctx context.Context, key AccountKey) (bool, error) {
+	var locked bool
+	queryString := fmt.Sprintf(`SELECT locked FROM %s.credentials WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=?;`, key.Tenant)
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&locked)
+
+	if err != nil && !errors.Is(err, gocql.ErrNotFound) {
+		return false, errors.Join(errors.New("db query error"), err)
+	}
+
+	return locked, nil
+}
+
+func (r *CassandraRepository) LoadItems(ctx context.Context, key AccountKey, presentation bool) (map[string]string, error) {
+	objects, _, err := r.LoadPage(ctx, key, presentation, 0, "")
+	return objects, err
+}
+
+func (r *CassandraRepository) LoadMetadata(ctx context.Context, key AccountKey, presentation bool, ids ...string) (map[string]ItemMetadata, error) {
+	metadata := make(map[string]ItemMetadata)
+
+	locked, err := r.locked(ctx, key)
+
+	if err != nil || locked {
+		return metadata, err
+	}
+
+	queryString := fmt.Sprintf(`SELECT id, type, issuer, format, metadata, created, updated, expiry, version FROM %s.credential_items WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=? AND
+																					kind=?`, key.Tenant)
+	args := []interface{}{key.Partition, key.Region, key.Country, key.Account, objectName(presentation)}
+
+	if len(ids) > 0 {
+		queryString += " AND id IN ?"
+		args = append(args, ids)
+	}
+
+	iter := r.session.Query(queryString+";", args...).Consistency(gocql.LocalQuorum).WithContext(ctx).Iter()
+
+	var id string
+	var item ItemMetadata
+	for iter.Scan(&id, &item.Type, &item.Issuer, &item.Format, &item.Index, &item.Created, &item.Updated, &item.Expiry, &item.Version) {
+		if item.Version == 0 {
+			// stored before versions were introduced
+			item.Version = 1
+		}
+		metadata[id] = item
+		item.Index = nil
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	return metadata, nil
+}
+
+func (r *CassandraRepository) LoadItem(ctx context.Context, key AccountKey, id string, presentation bool) (string, error) {
+	locked, err := r.locked(ctx, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if locked {
+		return "", ErrNotFound
+	}
+
+	var content string
+	queryString := fmt.Sprintf(`SELECT content FROM %s.credential_items WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=? AND
+																					kind=? AND
+																					id=?;`, key.Tenant)
+	err = r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		id).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&content)
+
+	if errors.Is(err, gocql.ErrNotFound) || (err == nil && content == "") {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", errors.Join(errors.New("db query error"), err)
+	}
+
+	return content, nil
+}
+
+// LoadPage pages over the clustering order of the item ids, so only the requested rows are read.
+func (r *CassandraRepository) LoadPage(ctx context.Context, key AccountKey, presentation bool, limit int, cursor string) (map[string]string, string, error) {
+	after, err := decodeCursor(cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	objects := make(map[string]string)
+
+	locked, err := r.locked(ctx, key)
+
+	if err != nil || locked {
+		return objects, "", err
+	}
+
+	queryString := fmt.Sprintf(`SELECT id, content FROM %s.credential_items WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=? AND
+																					kind=? AND
+																					id>?`, key.Tenant)
+
+	if limit > 0 {
+		// one more row than requested tells whether a next page exists
+		queryString += fmt.Sprintf(" LIMIT %d", limit+1)
+	}
+
+	iter := r.session.Query(queryString+";",
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		after).Consistency(gocql.LocalQuorum).WithContext(ctx).Iter()
+
+	ids := make([]string, 0)
+	var id, content string
+	for iter.Scan(&id, &content) {
+		objects[id] = content
+		ids = append(ids, id)
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, "", errors.Join(errors.New("db query error"), err)
+	}
+
+	next := ""
+	if limit > 0 && len(ids) > limit {
+		delete(objects, ids[limit])
+		next = encodeCursor(ids[limit-1])
+	}
+
+	return objects, next, nil
+}
+
+func (r *CassandraRepository) DeleteItem(ctx context.Context, key AccountKey, id string, presentation bool) error {
+	queryString := fmt.Sprintf(`DELETE FROM %s.credential_items WHERE accountPartition=? AND
+																						   region=? AND 
+																						   country=? AND 
+																						   account=? AND
+																						   kind=? AND
+																						   id=?;`, key.Tenant)
+	return r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		id).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+}
+
+// ExpiredItems scans the items table of the tenant. It is meant for the background sweep, not for requests.
+func (r *CassandraRepository) ExpiredItems(ctx context.Context, tenant string, before time.Time) ([]ExpiredItem, error) {
+	queryString := fmt.Sprintf(`SELECT accountPartition, region, country, account, kind, id, expiry FROM %s.credential_items WHERE expiry<? ALLOW FILTERING;`, tenant)
+	iter := r.session.Query(queryString, before).Consistency(gocql.LocalQuorum).WithContext(ctx).Iter()
+
+	items := make([]ExpiredItem, 0)
+	item := ExpiredItem{Key: AccountKey{Tenant: tenant}}
+	var kind string
+	for iter.Scan(&item.Key.Partition, &item.Key.Region, &item.Key.Country, &item.Key.Account, &kind, &item.Id, &item.Expiry) {
+		// archived items have a kind of their own and are left alone
+		if kind == objectName(false) || kind == objectName(true) {
+			item.Presentation = kind == objectName(true)
+			items = append(items, item)
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	return items, nil
+}
+
+// ArchiveItem copies the item under the archive kind and deletes it afterwards, a repeated call finishes an interrupted move.
+func (r *CassandraRepository) ArchiveItem(ctx context.Context, key AccountKey, id string, presentation bool) error {
+	var content string
+	var metadata ItemMetadata
+	queryString := fmt.Sprintf(`SELECT content, type, issuer, format, metadata, created, updated, expiry, version FROM %s.credential_items WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=? AND
+																					kind=? AND
+																					id=?;`, key.Tenant)
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		id).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&content, &metadata.Type, &metadata.Issuer, &metadata.Format, &metadata.Index, &metadata.Created, &metadata.Updated, &metadata.Expiry, &metadata.Version)
+
+	if errors.Is(err, gocql.ErrNotFound) {
+		return ErrNotFound
+	} else if err != nil {
+		return errors.Join(errors.New("db query error"), err)
+	}
+
+	queryString = fmt.Sprintf(`INSERT INTO %s.credential_items (accountPartition, region, country, account, kind, id, content, type, issuer, format, metadata, created, updated, expiry, version)
+																					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`, key.Tenant)
+	err = r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		archiveName(presentation),
+		id,
+		content,
+		metadata.Type,
+		metadata.Issuer,
+		metadata.Format,
+		metadata.Index,
+		metadata.Created,
+		metadata.Updated,
+		nullTime(metadata.Expiry),
+		metadata.Version).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+
+	if err != nil {
+		return err
+	}
+
+	return r.DeleteItem(ctx, key, id, presentation)
+}
+
+func (r *CassandraRepository) AccountExists(ctx context.Context, key AccountKey) (bool, error) {
+	var account = ""
+
+	queryString := fmt.Sprintf(`SELECT account FROM %s.credentials WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND 
+																					account=? LIMIT 1;`, key.Tenant)
+
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&account)
+
+	if errors.Is(err, gocql.ErrNotFound) {
+		return false, nil
+	}
+
+	return account != "", err
+}
+
+func (r *CassandraRepository) CreateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	queryString := fmt.Sprintf(`INSERT INTO %s.credentials 
+									( accountPartition, 
+									  region, 
+									  country,
+									  account,
+									  last_update_timestamp,
+									  locked) VALUES (?, ?, ?, ?, toTimestamp(now()), False);`, key.Tenant)
+
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+	).WithContext(ctx).Exec()
+
+	if err != nil {
+		return err
+	}
+
+	queryString = fmt.Sprintf(`DELETE FROM %s.account_devices WHERE accountPartition=? AND
+																	region=? AND
+																	country=? AND
+																	account=?;`, key.Tenant)
+
+	err = r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+
+	if err != nil {
+		return err
+	}
+
+	return insertDevice(ctx, r.session, key, record, time.Now())
+}
+
+func (r *CassandraRepository) AddDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	exists, err := r.AccountExists(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return insertDevice(ctx, r.session, key, record, time.Now())
+}
+
+// insertDevice adds the device to account_devices, ErrExists is returned when the id is bound already.
+func insertDevice(ctx context.Context, session connection.SessionInterface, key AccountKey, record DeviceRecord, created time.Time) error {
+	queryString := fmt.Sprintf(`INSERT INTO %s.account_devices
+									( accountPartition,
+									  region,
+									  country,
+									  account,
+									  id,
+									  label,
+									  device_key,
+									  signature,
+									  recovery_nonce,
+									  created) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS;`, key.Tenant)
+
+	applied, err := session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		record.Id,
+		record.Label,
+		record.DeviceKey,
+		record.Signature,
+		record.RecoveryNonce,
+		created).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return ErrExists
+	}
+
+	return nil
+}
+
+func (r *CassandraRepository) UpdateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	queryString := fmt.Sprintf(`UPDATE %s.account_devices SET device_key=?,
+															  signature=?, 
+															  recovery_nonce=? WHERE 
+																  		  accountPartition=? AND 
+																					region=? AND 
+																					country=? AND
+																					account=? AND
+																					id=? IF EXISTS;`, key.Tenant)
+
+	applied, err := r.session.Query(queryString,
+		record.DeviceKey,
+		record.Signature,
+		record.RecoveryNonce,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		record.Id).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *CassandraRepository) LoadDevice(ctx context.Context, key AccountKey, id string) (*DeviceRecord, error) {
+	devices, err := r.ListDevices(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return selectDevice(devices, id)
+}
+
+/*
+ListDevices reads the lock of the account from the credentials table and its devices from account_devices. The
+device of an account which was registered before several devices were supported is only listed after the migrate
+command moved it.
+*/
+func (r *CassandraRepository) ListDevices(ctx context.Context, key AccountKey) ([]DeviceRecord, error) {
+	var locked bool
+
+	queryString := fmt.Sprintf(`SELECT locked FROM %s.credentials WHERE accountPartition=? AND 
+																						     region=? AND 
+																						     country=? AND 
+																						     account=? LIMIT 1;`, key.Tenant)
+
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&locked)
+
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryString = fmt.Sprintf(`SELECT id, label, device_key, signature, recovery_nonce, nonce, created, last_seen FROM %s.account_devices WHERE accountPartition=? AND 
+																						     region=? AND 
+																						     country=? AND 
+																						     account=?;`, key.Tenant)
+
+	iter := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Iter()
+
+	devices := make([]DeviceRecord, 0)
+	var record DeviceRecord
+	for iter.Scan(&record.Id, &record.Label, &record.DeviceKey, &record.Signature, &record.RecoveryNonce, &record.Nonce, &record.Created, &record.LastSeen) {
+		// a nonce set after a concurrent revoke leaves a row without key
+		if record.DeviceKey != "" {
+			record.Locked = locked
+			devices = append(devices, record)
+		}
+		record = DeviceRecord{}
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	sortDevices(devices)
+	return devices, nil
+}
+
+func (r *CassandraRepository) DeleteDevice(ctx context.Context, key AccountKey, id string) error {
+	queryString := fmt.Sprintf(`DELETE FROM %s.account_devices WHERE accountPartition=? AND
+																	region=? AND
+																	country=? AND
+																	account=? AND
+																	id=? IF EXISTS;`, key.Tenant)
+
+	applied, err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		id).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *CassandraRepository) SetNonce(ctx context.Context, key AccountKey, id string, nonce string, ttl time.Duration) error {
+	queryString := fmt.Sprintf(`UPDATE %s.account_devices USING TTL %s SET nonce=? WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND
+																					account=? AND
+																					id=?;`,
+		key.Tenant,
+		strconv.Itoa(int(ttl.Seconds())))
+
+	err := r.session.Query(queryString,
+		nonce,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		id).WithContext(ctx).Exec()
+
+	if err != nil {
+		return err
+	}
+
+	queryString = fmt.Sprintf(`UPDATE %s.account_devices SET last_seen=toTimestamp(now()) WHERE accountPartition=? AND 
+																					region=? AND 
+																					country=? AND
+																					account=? AND
+																					id=?;`, key.Tenant)
+
+	return r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		id).WithContext(ctx).Exec()
+}
+
+func (r *CassandraRepository) DeleteAccount(ctx context.Context, key AccountKey) error {
+	queryString := fmt.Sprintf(`DELETE FROM %s.credential_items WHERE accountPartition=? AND
+																	region=? AND
+																	country=? AND
+																	account=?;`, key.Tenant)
+
+	err := r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+
+	if err != nil {
+		return err
+	}
+
+	queryString = fmt.Sprintf(`DELETE FROM %s.account_devices WHERE accountPartition=? AND
+																	region=? AND
+																	country=? AND
+																	account=?;`, key.Tenant)
+
+	err = r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+
+	if err != nil {
+		return err
+	}
+
+	queryString = fmt.Sprintf(`DELETE FROM %s.credentials WHERE accountPartition=? AND
+																	region=? AND
+																	country=? AND
+																	account=?;`, key.Tenant)
+
+	return r.session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).Consistency(gocql.LocalQuorum).WithContext(ctx).Exec()
+}
+
+/*
+CreateTenant creates the keyspace with its tables and indexes and records the tenant in it. Existing keyspaces, like
+ones created by initialize.cql or by other applications, are not taken over and answered with ErrExists, so that
+DeleteTenant only drops keyspaces created here.
+*/
+func (r *CassandraRepository) CreateTenant(ctx context.Context, tenant Tenant) error {
+	if err := tenant.Validate(); err != nil {
+		return err
+	}
+
+	exists, err := r.keyspaceExists(ctx, tenant.Name)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrExists
+	}
+
+	replication, _ := tenant.Replication.cql()
+	statements := append([]string{`CREATE KEYSPACE IF NOT EXISTS %s WITH REPLICATION = ` + replication + `;`}, tenantSchema...)
+
+	for _, statement := range statements {
+		if err := r.session.Query(fmt.Sprintf(statement, tenant.Name)).WithContext(ctx).Exec(); err != nil {
+			return errors.Join(errors.New("tenant schema could not be created"), err)
+		}
+	}
+
+	replicationJson, err := json.Marshal(tenant.Replication)
+
+	if err != nil {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`INSERT INTO %s.tenant (name, replication, created, metadata) VALUES (?, ?, ?, ?) IF NOT EXISTS;`, tenant.Name)
+
+	applied, err := r.session.Query(queryString,
+		tenant.Name,
+		string(replicationJson),
+		time.Now(),
+		tenant.Metadata).Consistency(gocql.Quorum).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return ErrExists
+	}
+
+	return nil
+}
+
+// keyspaceExists looks the keyspace up in the schema of the cluster.
+func (r *CassandraRepository) keyspaceExists(ctx context.Context, name string) (bool, error) {
+	var keyspace string
+
+	err := r.session.Query(`SELECT keyspace_name FROM system_schema.keyspaces WHERE keyspace_name = ?;`,
+		name).WithContext(ctx).Scan(&keyspace)
+
+	if errors.Is(err, gocql.ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.Join(errors.New("db query error"), err)
+	}
+
+	return true, nil
+}
+
+// ListTenants finds the recorded tenants by the tenant table in their keyspace.
+func (r *CassandraRepository) ListTenants(ctx context.Context) ([]Tenant, error) {
+	iter := r.session.Query(`SELECT keyspace_name FROM system_schema.tables WHERE table_name = 'tenant' ALLOW FILTERING;`).WithContext(ctx).Iter()
+
+	names := make([]string, 0)
+	var name string
+
+	for iter.Scan(&name) {
+		names = append(names, name)
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	sort.Strings(names)
+	tenants := make([]Tenant, 0, len(names))
+
+	for _, name := range names {
+		tenant, err := r.LoadTenant(ctx, name)
+
+		if errors.Is(err, ErrNotFound) {
+			// deleted meanwhile or not completely created
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		tenants = append(tenants, *tenant)
+	}
+
+	return tenants, nil
+}
+
+func (r *CassandraRepository) LoadTenant(ctx context.Context, name string) (*Tenant, error) {
+	if !tenantName.MatchString(name) {
+		return nil, ErrNotFound
+	}
+
+	var keyspace string
+
+	err := r.session.Query(`SELECT keyspace_name FROM system_schema.tables WHERE keyspace_name = ? AND table_name = 'tenant';`,
+		name).WithContext(ctx).Scan(&keyspace)
+
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := Tenant{Name: name}
+	var replication string
+
+	err = r.session.Query(fmt.Sprintf(`SELECT replication, created, metadata FROM %s.tenant WHERE name = ?;`, name),
+		name).Consistency(gocql.LocalQuorum).WithContext(ctx).Scan(&replication, &tenant.Created, &tenant.Metadata)
+
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(replication), &tenant.Replication); err != nil {
+		return nil, err
+	}
+
+	return &tenant, nil
+}
+
+// DeleteTenant drops the keyspace of the tenant. Keyspaces which are not recorded as tenant are left untouched.
+func (r *CassandraRepository) DeleteTenant(ctx context.Context, name string) error {
+	if _, err := r.LoadTenant(ctx, name); err != nil {
+		return err
+	}
+
+	return r.session.Query(fmt.Sprintf(`DROP KEYSPACE IF EXISTS %s;`, name)).WithContext(ctx).Exec()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"crypto"
+	b64 "encoding/base64"
+	"errors"
+	"sort"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// ErrAmbiguousDevice is returned when a device is loaded without id from an account with several devices.
+var ErrAmbiguousDevice = errors.New("account has several devices, device id missing")
+
+// DeviceId is the base64url encoded SHA-256 JWK thumbprint of the key a device is added with.
+func DeviceId(key jwk.Key) (string, error) {
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+
+	if err != nil {
+		return "", err
+	}
+
+	return b64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// storedDeviceId derives the id of a device key stored as base64 encoded JSON, like the one of a single device account.
+func storedDeviceId(deviceKey string) (string, error) {
+	raw, err := b64.StdEncoding.DecodeString(deviceKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	key, err := jwk.ParseKey(raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	return DeviceId(key)
+}
+
+// selectDevice picks the device with the id out of the devices of an account, an empty id picks the only one.
+func selectDevice(devices []DeviceRecord, id string) (*DeviceRecord, error) {
+	if id == "" {
+		switch len(devices) {
+		case 0:
+			return nil, ErrNotFound
+		case 1:
+			return &devices[0], nil
+		default:
+			return nil, ErrAmbiguousDevice
+		}
+	}
+
+	for i := range devices {
+		if devices[i].Id == id {
+			return &devices[i], nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func sortDevices(devices []DeviceRecord) {
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Created.Equal(devices[j].Created) {
+			return devices[i].Id < devices[j].Id
+		}
+		return devices[i].Created.Before(devices[j].Created)
+	})
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryItem struct {
+	content        string
+	metadata       ItemMetadata
+	idempotencyKey string
+}
+
+type memoryDevice struct {
+	record      DeviceRecord
+	nonceExpiry time.Time
+}
+
+type memoryAccount struct {
+	credentials   map[string]memoryItem
+	presentations map[string]memoryItem
+	archived      map[string]memoryItem
+	devices       map[string]*memoryDevice
+	locked        bool
+}
+
+func (a *memoryAccount) items(presentation bool) map[string]memoryItem {
+	if presentation {
+		return a.presentations
+	}
+	return a.credentials
+}
+
+/*
+MemoryRepository keeps all accounts in process memory. It is intended for tests and the DEBUG:MEMORY profile,
+all data is lost after a restart.
+*/
+type MemoryRepository struct {
+	mutex    sync.RWMutex
+	accounts map[AccountKey]*memoryAccount
+	tenants  map[string]Tenant
+	closed   bool
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{accounts: make(map[AccountKey]*memoryAccount), tenants: make(map[string]Tenant)}
+}
+
+func (r *MemoryRepository) Closed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.closed
+}
+
+func (r *MemoryRepository) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+}
+
+// account returns the account of the key and creates it when not existing, like an upsert in cassandra does.
+func (r *MemoryRepository) account(key AccountKey) *memoryAccount {
+	account, ok := r.accounts[key]
+	if !ok {
+		account = &memoryAccount{
+			credentials:   make(map[string]memoryItem),
+			presentations: make(map[string]memoryItem),
+			archived:      make(map[string]memoryItem),
+			devices:       make(map[string]*memoryDevice),
+		}
+		r.accounts[key] = account
+	}
+	return account
+}
+
+// SetLocked locks or unlocks an account. Locked accounts return no items and are rejected by the auth middleware.
+func (r *MemoryRepository) SetLocked(key AccountKey, locked bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.account(key).locked = locked
+}
+
+func (r *MemoryRepository) StoreItem(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool) error {
+	_, err := r.StoreItemIf(ctx, key, id, content, metadata, presentation, Condition{})
+	return err
+}
+
+func (r *MemoryRepository) StoreItemIf(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool, condition Condition) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account := r.account(key)
+	items := account.items(presentation)
+	existing := items[id]
+
+	if err := condition.check(existing.metadata.Version, existing.idempotencyKey); err != nil {
+		return existing.metadata.Version, err
+	}
+
+	metadata.Updated = time.Now()
+	metadata.Created = metadata.Updated
+	if existing.metadata.Version > 0 {
+		metadata.Created = existing.metadata.Created
+	}
+	metadata.Version = existing.metadata.Version + 1
+
+	items[id] = memoryItem{content: content, metadata: metadata, idempotencyKey: condition.IdempotencyKey}
+	account.locked = false
+	return metadata.Version, nil
+}
+
+func (r *MemoryRepository) LoadItems(ctx context.Context, key AccountKey, presentation bool) (map[string]string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	objects := make(map[string]string)
+
+	account, ok := r.accounts[key]
+	if !ok || account.locked {
+		return objects, nil
+	}
+
+	for k, v := range account.items(presentation) {
+		objects[k] = v.content
+	}
+
+	return objects, nil
+}
+
+func (r *MemoryRepository) LoadMetadata(ctx context.Context, key AccountKey, presentation bool, ids ...string) (map[string]ItemMetadata, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	metadata := make(map[string]ItemMetadata)
+
+	account, ok := r.accounts[key]
+	if !ok || account.locked {
+		return metadata, nil
+	}
+
+	items := account.items(presentation)
+
+	if len(ids) > 0 {
+		for _, id := range ids {
+			if v, ok := items[id]; ok {
+				metadata[id] = v.metadata
+			}
+		}
+		return metadata, nil
+	}
+
+	for k, v := range items {
+		metadata[k] = v.metadata
+	}
+
+	return metadata, nil
+}
+
+func (r *MemoryRepository) LoadItem(ctx context.Context, key AccountKey, id string, presentation bool) (string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	account, ok := r.accounts[key]
+	if !ok || account.locked {
+		return "", ErrNotFound
+	}
+
+	item, ok := account.items(presentation)[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return item.content, nil
+}
+
+func (r *MemoryRepository) LoadPage(ctx context.Context, key AccountKey, presentation bool, limit int, cursor string) (map[string]string, string, error) {
+	items, err := r.LoadItems(ctx, key, presentation)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Page(items, limit, cursor)
+}
+
+func (r *MemoryRepository) DeleteItem(ctx context.Context, key AccountKey, id string, presentation bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if account, ok := r.accounts[key]; ok {
+		delete(account.items(presentation), id)
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ExpiredItems(ctx context.Context, tenant string, before time.Time) ([]ExpiredItem, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	items := make([]ExpiredItem, 0)
+
+	for key, account := range r.accounts {
+		if key.Tenant != tenant {
+			continue
+		}
+
+		for _, presentation := range []bool{false, true} {
+			for id, item := range account.items(presentation) {
+				if item.metadata.Expired(before) {
+					items = append(items, ExpiredItem{Key: key, Id: id, Presentation: presentation, Expiry: item.metadata.Expiry})
+				}
+			}
+		}
+	}
+
+	return items, nil
+}
+
+func (r *MemoryRepository) ArchiveItem(ctx context.Context, key AccountKey, id string, presentation bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account, ok := r.accounts[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	item, ok := account.items(presentation)[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	account.archived[archiveName(presentation)+"/"+id] = item
+	delete(account.items(presentation), id)
+	return nil
+}
+
+func (r *MemoryRepository) AccountExists(ctx context.Context, key AccountKey) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, ok := r.accounts[key]
+	return ok, nil
+}
+
+func (r *MemoryRepository) CreateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account := r.account(key)
+	account.locked = false
+	account.devices = map[string]*memoryDevice{record.Id: newMemoryDevice(record)}
+	return nil
+}
+
+func (r *MemoryRepository) AddDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account, ok := r.accounts[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := account.devices[record.Id]; ok {
+		return ErrExists
+	}
+
+	account.devices[record.Id] = newMemoryDevice(record)
+	return nil
+}
+
+func newMemoryDevice(record DeviceRecord) *memoryDevice {
+	return &memoryDevice{record: DeviceRecord{
+		Id:            record.Id,
+		Label:         record.Label,
+		DeviceKey:     record.DeviceKey,
+		Signature:     record.Signature,
+		RecoveryNonce: record.RecoveryNonce,
+		Created:       time.Now(),
+	}}
+}
+
+func (r *MemoryRepository) UpdateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account, ok := r.accounts[key]
+	if !ok || account.devices[record.Id] == nil {
+		return ErrNotFound
+	}
+
+	device := account.devices[record.Id]
+	device.record.DeviceKey = record.DeviceKey
+	device.record.Signature = record.Signature
+	device.record.RecoveryNonce = record.RecoveryNonce
+	return nil
+}
+
+func (r *MemoryRepository) LoadDevice(ctx context.Context, key AccountKey, id string) (*DeviceRecord, error) {
+	devices, err := r.ListDevices(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return selectDevice(devices, id)
+}
+
+func (r *MemoryRepository) ListDevices(ctx context.Context, key AccountKey) ([]DeviceRecord, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	account, ok := r.accounts[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	devices := make([]DeviceRecord, 0, len(account.devices))
+	for _, device := range account.devices {
+		record := device.record
+		record.Locked = account.locked
+		if time.Now().After(device.nonceExpiry) {
+			record.Nonce = ""
+		}
+		devices = append(devices, record)
+	}
+
+	sortDevices(devices)
+	return devices, nil
+}
+
+func (r *MemoryRepository) DeleteDevice(ctx context.Context, key AccountKey, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account, ok := r.accounts[key]
+	if !ok || account.devices[id] == nil {
+		return ErrNotFound
+	}
+
+	delete(account.devices, id)
+	return nil
+}
+
+func (r *MemoryRepository) SetNonce(ctx context.Context, key AccountKey, id string, nonce string, ttl time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	account, ok := r.accounts[key]
+	if !ok || account.devices[id] == nil {
+		return nil
+	}
+
+	device := account.devices[id]
+	device.record.Nonce = nonce
+	device.record.LastSeen = time.Now()
+	device.nonceExpiry = device.record.LastSeen.Add(ttl)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteAccount(ctx context.Context, key AccountKey) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.accounts, key)
+	return nil
+}
+
+func (r *MemoryRepository) CreateTenant(ctx context.Context, tenant Tenant) error {
+	if err := tenant.Validate(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.tenants[tenant.Name]; ok {
+		return ErrExists
+	}
+
+	tenant.Created = time.Now()
+	r.tenants[tenant.Name] = tenant
+	return nil
+}
+
+func (r *MemoryRepository) ListTenants(ctx context.Context) ([]Tenant, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+func (r *MemoryRepository) LoadTenant(ctx context.Context, name string) (*Tenant, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	tenant, ok := r.tenants[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &tenant, nil
+}
+
+func (r *MemoryRepository) DeleteTenant(ctx context.Context, name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.tenants[name]; !ok {
+		return ErrNotFound
+	}
+
+	for key := range r.accounts {
+		if key.Tenant == name {
+			delete(r.accounts, key)
+		}
+	}
+
+	delete(r.tenants, name)
+	return nil
+}
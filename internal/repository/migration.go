@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/connection"
+	"github.com/gocql/gocql"
+)
+
+const credentialItemsTable = `CREATE TABLE IF NOT EXISTS %s.credential_items (
+accountPartition text,
+region text,
+country text,
+account text,
+kind text,
+id text,
+content text,
+type text,
+issuer text,
+format text,
+metadata map<text,text>,
+created timestamp,
+updated timestamp,
+expiry timestamp,
+version bigint,
+idempotency_key text,
+PRIMARY KEY ((accountPartition,region,country,account),kind,id)
+);`
+
+const credentialsTable = `CREATE TABLE IF NOT EXISTS %s.credentials (
+accountPartition text,
+region text,
+country text,
+account text,
+last_update_timestamp timestamp,
+metadata map<text,text>,
+credentials map<text,text>,
+presentations map<text,text>,
+id text,
+recovery_nonce text,
+device_key text,
+nonce text,
+locked boolean,
+signature text,
+PRIMARY KEY ((accountPartition,region,country),account)
+);`
+
+// accountDevicesTable holds the devices bound to an account, the device columns of credentials are legacy.
+const accountDevicesTable = `CREATE TABLE IF NOT EXISTS %s.account_devices (
+accountPartition text,
+region text,
+country text,
+account text,
+id text,
+label text,
+device_key text,
+signature text,
+recovery_nonce text,
+nonce text,
+created timestamp,
+last_seen timestamp,
+PRIMARY KEY ((accountPartition,region,country,account),id)
+);`
+
+// tenantTable records a keyspace provisioned by the tenant administration, it holds the row of the tenant only.
+const tenantTable = `CREATE TABLE IF NOT EXISTS %s.tenant (
+name text PRIMARY KEY,
+replication text,
+created timestamp,
+metadata map<text,text>
+);`
+
+var tenantSchema = []string{
+	credentialsTable,
+	credentialItemsTable,
+	accountDevicesTable,
+	`CREATE INDEX IF NOT EXISTS ON %s.credentials (locked);`,
+	`CREATE INDEX IF NOT EXISTS ON %s.credentials (id);`,
+	tenantTable,
+}
+
+/*
+Usage: Moves the credentials and presentations of all accounts in the tenant keyspace out of the map columns of
+the credentials table into the credential_items table. Items which exist already in credential_items are not
+overwritten, so the migration can be repeated after an interruption. Returns the number of moved items.
+*/
+
+func MigrateCassandraItems(ctx context.Context, session connection.SessionInterface, tenant string) (int, error) {
+	err := session.Query(fmt.Sprintf(credentialItemsTable, tenant)).WithContext(ctx).Exec()
+
+	if err != nil {
+		return 0, errors.Join(errors.New("credential_items could not be created"), err)
+	}
+
+	queryString := fmt.Sprintf(`SELECT accountPartition, region, country, account, last_update_timestamp, credentials, presentations FROM %s.credentials;`, tenant)
+	iter := session.Query(queryString).Consistency(gocql.LocalQuorum).WithContext(ctx).Iter()
+
+	moved := 0
+	key := AccountKey{Tenant: tenant}
+	var lastUpdate time.Time
+	var credentials, presentations map[string]string
+
+	for iter.Scan(&key.Partition, &key.Region, &key.Country, &key.Account, &lastUpdate, &credentials, &presentations) {
+		if len(credentials) == 0 && len(presentations) == 0 {
+			continue
+		}
+
+		if lastUpdate.IsZero() {
+			lastUpdate = time.Now()
+		}
+
+		for id, content := range credentials {
+			if err := migrateItem(ctx, session, key, id, content, lastUpdate, false); err != nil {
+				iter.Close()
+				return moved, err
+			}
+			moved++
+		}
+
+		for id, content := range presentations {
+			if err := migrateItem(ctx, session, key, id, content, lastUpdate, true); err != nil {
+				iter.Close()
+				return moved, err
+			}
+			moved++
+		}
+
+		queryString = fmt.Sprintf(`UPDATE %s.credentials SET credentials=null, presentations=null WHERE accountPartition=? AND
+																					region=? AND
+																					country=? AND
+																					account=?;`, tenant)
+		err = session.Query(queryString,
+			key.Partition,
+			key.Region,
+			key.Country,
+			key.Account).WithContext(ctx).Exec()
+
+		if err != nil {
+			iter.Close()
+			return moved, err
+		}
+
+		credentials, presentations = nil, nil
+	}
+
+	if err := iter.Close(); err != nil {
+		return moved, errors.Join(errors.New("db query error"), err)
+	}
+
+	return moved, nil
+}
+
+func migrateItem(ctx context.Context, session connection.SessionInterface, key AccountKey, id string, content string, created time.Time, presentation bool) error {
+	queryString := fmt.Sprintf(`INSERT INTO %s.credential_items
+									( accountPartition,
+									  region,
+									  country,
+									  account,
+									  kind,
+									  id,
+									  content,
+									  created,
+									  updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS;`, key.Tenant)
+
+	return session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account,
+		objectName(presentation),
+		id,
+		content,
+		created,
+		created).WithContext(ctx).Exec()
+}
+
+/*
+Usage: Creates the account_devices table in the tenant keyspace and moves the device of every account registered
+before several devices were supported out of the credentials table. Devices which are not moved here are not
+listed for their account. Returns the number of moved devices.
+*/
+
+func MigrateCassandraDevices(ctx context.Context, session connection.SessionInterface, tenant string) (int, error) {
+	err := session.Query(fmt.Sprintf(accountDevicesTable, tenant)).WithContext(ctx).Exec()
+
+	if err != nil {
+		return 0, errors.Join(errors.New("account_devices could not be created"), err)
+	}
+
+	queryString := fmt.Sprintf(`SELECT accountPartition, region, country, account, last_update_timestamp, device_key, signature, recovery_nonce FROM %s.credentials;`, tenant)
+	iter := session.Query(queryString).Consistency(gocql.LocalQuorum).WithContext(ctx).Iter()
+
+	moved := 0
+	key := AccountKey{Tenant: tenant}
+	var lastUpdate time.Time
+	var record DeviceRecord
+
+	for iter.Scan(&key.Partition, &key.Region, &key.Country, &key.Account, &lastUpdate, &record.DeviceKey, &record.Signature, &record.RecoveryNonce) {
+		if record.DeviceKey == "" {
+			continue
+		}
+
+		if err := migrateDevice(ctx, session, key, record, lastUpdate); err != nil {
+			iter.Close()
+			return moved, err
+		}
+		moved++
+		record = DeviceRecord{}
+	}
+
+	if err := iter.Close(); err != nil {
+		return moved, errors.Join(errors.New("db query error"), err)
+	}
+
+	return moved, nil
+}
+
+/*
+migrateDevice moves the device stored in the credentials row of the account into account_devices, under the id of
+its key. A device moved already is not overwritten.
+*/
+func migrateDevice(ctx context.Context, session connection.SessionInterface, key AccountKey, record DeviceRecord, created time.Time) error {
+	id, err := storedDeviceId(record.DeviceKey)
+
+	if err != nil {
+		return errors.Join(errors.New("stored device key invalid"), err)
+	}
+
+	record.Id = id
+
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	err = insertDevice(ctx, session, key, record, created)
+
+	if err != nil && !errors.Is(err, ErrExists) {
+		return err
+	}
+
+	queryString := fmt.Sprintf(`UPDATE %s.credentials SET device_key=null, signature=null, recovery_nonce=null, nonce=null WHERE accountPartition=? AND
+																					region=? AND
+																					country=? AND
+																					account=?;`, key.Tenant)
+
+	return session.Query(queryString,
+		key.Partition,
+		key.Region,
+		key.Country,
+		key.Account).WithContext(ctx).Exec()
+}
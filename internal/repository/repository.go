@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrNotFound = errors.New("record not found")
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Errors of conditional stores.
+var (
+	ErrExists          = errors.New("item already exists")
+	ErrVersionMismatch = errors.New("item version does not match")
+	// ErrUnchanged is returned with the current version when the idempotency key was stored already.
+	ErrUnchanged = errors.New("item unchanged")
+)
+
+// AccountKey addresses the record of an account within a tenant.
+type AccountKey struct {
+	Tenant    string
+	Partition string
+	Region    string
+	Country   string
+	Account   string
+}
+
+/*
+DeviceRecord contains a device bound to an account. The id is the DeviceId of the key the device was added with, it
+is kept when the key is replaced by a recovery. Nonce, recovery nonce and last seen are the state of the device,
+Locked is the state of the account. Created and LastSeen are maintained by the repository.
+*/
+type DeviceRecord struct {
+	Id            string
+	Label         string
+	DeviceKey     string
+	Signature     string
+	RecoveryNonce string
+	Nonce         string
+	Created       time.Time
+	LastSeen      time.Time
+	Locked        bool
+}
+
+// ItemMetadata describes a stored item. Created, Updated and Version are maintained by the repository.
+type ItemMetadata struct {
+	Type    string
+	Issuer  string
+	Format  string
+	Created time.Time
+	Updated time.Time
+	// Version starts at 1 and is incremented by every store of the item.
+	Version int64
+	// Expiry is zero when the item does not expire or the expiry is unknown.
+	Expiry time.Time
+	// Index holds the searchable fields of the item, plain or hashed.
+	Index map[string]string
+}
+
+// Expired reports whether the item expired before the given time.
+func (m ItemMetadata) Expired(now time.Time) bool {
+	return !m.Expiry.IsZero() && m.Expiry.Before(now)
+}
+
+/*
+Condition restricts a store to an expected state of the item, the zero value stores unconditionally. Version and
+Exists fail with ErrVersionMismatch, Absent with ErrExists. An IdempotencyKey equal to the one of the last store of
+the item skips the store with ErrUnchanged, so that a repeated message does not create a new version.
+*/
+type Condition struct {
+	Version        int64
+	Exists         bool
+	Absent         bool
+	IdempotencyKey string
+}
+
+// check validates the condition against the stored version and idempotency key, a version of 0 means not existing.
+func (c Condition) check(version int64, idempotencyKey string) error {
+	switch {
+	case c.IdempotencyKey != "" && version > 0 && c.IdempotencyKey == idempotencyKey:
+		return ErrUnchanged
+	case c.Absent && version > 0:
+		return ErrExists
+	case c.Exists && version == 0, c.Version > 0 && c.Version != version:
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// ExpiredItem addresses an item found by the expiry sweep.
+type ExpiredItem struct {
+	Key          AccountKey
+	Id           string
+	Presentation bool
+	Expiry       time.Time
+}
+
+/*
+Repository abstracts the storage backend. Items are stored encrypted and base64 encoded, the repository
+never interprets them. The presentation flag selects between the credential and the presentation collection.
+*/
+type Repository interface {
+	StoreItem(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool) error
+	// StoreItemIf stores the item when the condition holds and returns its new version.
+	StoreItemIf(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool, condition Condition) (int64, error)
+	LoadItems(ctx context.Context, key AccountKey, presentation bool) (map[string]string, error)
+	// LoadMetadata returns the metadata of the items with the ids, without ids the metadata of all items.
+	LoadMetadata(ctx context.Context, key AccountKey, presentation bool, ids ...string) (map[string]ItemMetadata, error)
+	// LoadItem returns ErrNotFound when the item not exists.
+	LoadItem(ctx context.Context, key AccountKey, id string, presentation bool) (string, error)
+	// LoadPage returns up to limit items ordered by id, starting after the cursor. A limit of 0 returns all items.
+	// The returned cursor is empty when no further items exist.
+	LoadPage(ctx context.Context, key AccountKey, presentation bool, limit int, cursor string) (map[string]string, string, error)
+	DeleteItem(ctx context.Context, key AccountKey, id string, presentation bool) error
+	// ExpiredItems returns the active items of all accounts of the tenant which expired before the given time.
+	ExpiredItems(ctx context.Context, tenant string, before time.Time) ([]ExpiredItem, error)
+	// ArchiveItem moves an item out of the active collection, so that it is not loaded anymore but kept.
+	ArchiveItem(ctx context.Context, key AccountKey, id string, presentation bool) error
+
+	AccountExists(ctx context.Context, key AccountKey) (bool, error)
+	// CreateDevice creates the account with its first device.
+	CreateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error
+	// AddDevice binds a further device to an existing account, ErrExists is returned for a bound device id.
+	AddDevice(ctx context.Context, key AccountKey, record DeviceRecord) error
+	// UpdateDevice replaces key, signature and recovery nonce of the device with the id of the record.
+	UpdateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error
+	// LoadDevice returns ErrNotFound for unknown devices. Without id the only device of the account is returned,
+	// ErrAmbiguousDevice when it has several.
+	LoadDevice(ctx context.Context, key AccountKey, id string) (*DeviceRecord, error)
+	// ListDevices returns the devices of the account in the order they were added.
+	ListDevices(ctx context.Context, key AccountKey) ([]DeviceRecord, error)
+	// DeleteDevice revokes a device, ErrNotFound is returned for unknown devices.
+	DeleteDevice(ctx context.Context, key AccountKey, id string) error
+	// SetNonce sets the nonce of the device for the ttl and records that the device was seen, unknown devices are
+	// ignored.
+	SetNonce(ctx context.Context, key AccountKey, id string, nonce string, ttl time.Duration) error
+	DeleteAccount(ctx context.Context, key AccountKey) error
+
+	// CreateTenant provisions the storage of the tenant and records it, ErrExists is returned for recorded tenants.
+	CreateTenant(ctx context.Context, tenant Tenant) error
+	// ListTenants returns the recorded tenants ordered by name.
+	ListTenants(ctx context.Context) ([]Tenant, error)
+	// LoadTenant returns ErrNotFound when the tenant is not recorded.
+	LoadTenant(ctx context.Context, name string) (*Tenant, error)
+	// DeleteTenant removes a recorded tenant with all accounts and items.
+	DeleteTenant(ctx context.Context, name string) error
+
+	Closed() bool
+	Close()
+}
+
+func objectName(presentation bool) string {
+	if presentation {
+		return "presentations"
+	}
+	return "credentials"
+}
+
+func archiveName(presentation bool) string {
+	return "archived_" + objectName(presentation)
+}
+
+// nullTime maps the zero time to null, so that items without a time are not matched by range queries.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func encodeCursor(id string) string {
+	return b64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+
+	id, err := b64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+
+	return string(id), nil
+}
+
+// Page selects a page out of already loaded items.
+func Page(items map[string]string, limit int, cursor string) (map[string]string, string, error) {
+	after, err := decodeCursor(cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		if cursor == "" || id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	next := ""
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+		next = encodeCursor(ids[limit-1])
+	}
+
+	result := make(map[string]string, len(ids))
+	for _, id := range ids {
+		result[id] = items[id]
+	}
+
+	return result, next, nil
+}
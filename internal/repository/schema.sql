@@ -0,0 +1,61 @@
+CREATE TABLE IF NOT EXISTS accounts (
+    tenant TEXT NOT NULL,
+    account_partition TEXT NOT NULL,
+    region TEXT NOT NULL,
+    country TEXT NOT NULL,
+    account TEXT NOT NULL,
+    last_update_timestamp BIGINT,
+    recovery_nonce TEXT,
+    device_key TEXT,
+    signature TEXT,
+    nonce TEXT,
+    nonce_expiry BIGINT,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (tenant, account_partition, region, country, account)
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    tenant TEXT NOT NULL,
+    account_partition TEXT NOT NULL,
+    region TEXT NOT NULL,
+    country TEXT NOT NULL,
+    account TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    type TEXT,
+    issuer TEXT,
+    format TEXT,
+    metadata TEXT,
+    created BIGINT,
+    updated BIGINT,
+    expiry BIGINT,
+    version BIGINT NOT NULL DEFAULT 1,
+    idempotency_key TEXT,
+    PRIMARY KEY (tenant, account_partition, region, country, account, kind, id)
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+    tenant TEXT NOT NULL,
+    account_partition TEXT NOT NULL,
+    region TEXT NOT NULL,
+    country TEXT NOT NULL,
+    account TEXT NOT NULL,
+    id TEXT NOT NULL,
+    label TEXT,
+    device_key TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    recovery_nonce TEXT NOT NULL,
+    nonce TEXT,
+    nonce_expiry BIGINT,
+    created BIGINT,
+    last_seen BIGINT,
+    PRIMARY KEY (tenant, account_partition, region, country, account, id)
+);
+
+CREATE TABLE IF NOT EXISTS tenants (
+    name TEXT NOT NULL PRIMARY KEY,
+    replication TEXT,
+    created BIGINT,
+    metadata TEXT
+);
@@ -0,0 +1,874 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	PostgresDriver = "postgres"
+	SqliteDriver   = "sqlite3"
+)
+
+//go:embed schema.sql
+var sqlSchema string
+
+// addedColumns are missing in items tables created by older versions, existing items get version 1.
+var addedColumns = [][2]string{
+	{"version", "BIGINT NOT NULL DEFAULT 1"},
+	{"idempotency_key", "TEXT"},
+}
+
+type SqlRepository struct {
+	db     *sql.DB
+	driver string
+	closed atomic.Bool
+}
+
+/*
+Usage: Opens a PostgreSQL or SQLite database and creates the schema if it not exists.
+*/
+
+func NewSqlRepository(driver string, dsn string) (Repository, error) {
+	if driver != PostgresDriver && driver != SqliteDriver {
+		return nil, errors.New("unsupported sql driver: " + driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == SqliteDriver {
+		// sqlite allows just one writer, serializing avoids "database is locked" errors
+		db.SetMaxOpenConns(1)
+	}
+
+	_, err = db.Exec(sqlSchema)
+
+	if err != nil {
+		db.Close()
+		return nil, errors.Join(errors.New("schema creation failed"), err)
+	}
+
+	for _, column := range addedColumns {
+		if _, err := db.Exec("SELECT " + column[0] + " FROM items WHERE 1 = 0;"); err == nil {
+			continue
+		}
+
+		if _, err := db.Exec("ALTER TABLE items ADD COLUMN " + column[0] + " " + column[1] + ";"); err != nil {
+			db.Close()
+			return nil, errors.Join(errors.New("schema migration failed"), err)
+		}
+	}
+
+	return &SqlRepository{db: db, driver: driver}, nil
+}
+
+func (r *SqlRepository) Closed() bool {
+	return r.closed.Load()
+}
+
+func (r *SqlRepository) Close() {
+	if r.closed.CompareAndSwap(false, true) {
+		r.db.Close()
+	}
+}
+
+// rebind converts the ? placeholders into the numbered form which postgres expects.
+func (r *SqlRepository) rebind(query string) string {
+	if r.driver != PostgresDriver {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
+
+func (r *SqlRepository) exec(ctx context.Context, tx *sql.Tx, query string, args ...any) (sql.Result, error) {
+	if tx != nil {
+		return tx.ExecContext(ctx, r.rebind(query), args...)
+	}
+	return r.db.ExecContext(ctx, r.rebind(query), args...)
+}
+
+func (r *SqlRepository) touchAccount(ctx context.Context, tx *sql.Tx, key AccountKey) error {
+	_, err := r.exec(ctx, tx, `INSERT INTO accounts (tenant, account_partition, region, country, account, last_update_timestamp, locked)
+								VALUES (?, ?, ?, ?, ?, ?, ?)
+								ON CONFLICT (tenant, account_partition, region, country, account)
+								DO UPDATE SET locked = excluded.locked, last_update_timestamp = excluded.last_update_timestamp;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, time.Now().Unix(), false)
+	return err
+}
+
+func (r *SqlRepository) StoreItem(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool) error {
+	_, err := r.StoreItemIf(ctx, key, id, content, metadata, presentation, Condition{})
+	return err
+}
+
+func (r *SqlRepository) StoreItemIf(ctx context.Context, key AccountKey, id string, content string, metadata ItemMetadata, presentation bool, condition Condition) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	query := `SELECT version, idempotency_key FROM items WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND kind = ? AND id = ?`
+	if r.driver == PostgresDriver {
+		// sqlite serializes the writers anyway
+		query += " FOR UPDATE"
+	}
+
+	var version int64
+	var idempotencyKey sql.NullString
+
+	err = tx.QueryRowContext(ctx, r.rebind(query+";"), key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), id).Scan(&version, &idempotencyKey)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.Join(errors.New("db query error"), err)
+	}
+
+	if err := condition.check(version, idempotencyKey.String); err != nil {
+		return version, err
+	}
+
+	err = r.touchAccount(ctx, tx, key)
+
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+
+	index, err := json.Marshal(metadata.Index)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var expiry any
+	if !metadata.Expiry.IsZero() {
+		expiry = metadata.Expiry.Unix()
+	}
+
+	var result sql.Result
+
+	if version == 0 {
+		result, err = r.exec(ctx, tx, `INSERT INTO items (tenant, account_partition, region, country, account, kind, id, content, type, issuer, format, metadata, created, updated, expiry, version, idempotency_key)
+								VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+								ON CONFLICT (tenant, account_partition, region, country, account, kind, id) DO NOTHING;`,
+			key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), id, content,
+			metadata.Type, metadata.Issuer, metadata.Format, string(index), now, now, expiry, 1, condition.IdempotencyKey)
+	} else {
+		result, err = r.exec(ctx, tx, `UPDATE items SET content = ?, type = ?, issuer = ?, format = ?, metadata = ?, updated = ?, expiry = ?, version = ?, idempotency_key = ?
+								WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND kind = ? AND id = ? AND version = ?;`,
+			content, metadata.Type, metadata.Issuer, metadata.Format, string(index), now, expiry, version+1, condition.IdempotencyKey,
+			key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), id, version)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// a concurrent insert of the same id wins
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return 0, ErrExists
+	}
+
+	return version + 1, tx.Commit()
+}
+
+func (r *SqlRepository) LoadItems(ctx context.Context, key AccountKey, presentation bool) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, r.rebind(`SELECT i.id, i.content FROM items i JOIN accounts a ON
+									a.tenant = i.tenant AND
+									a.account_partition = i.account_partition AND
+									a.region = i.region AND
+									a.country = i.country AND
+									a.account = i.account
+								WHERE i.tenant = ? AND i.account_partition = ? AND i.region = ? AND i.country = ? AND i.account = ? AND
+									i.kind = ? AND a.locked = ?;`),
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), false)
+
+	if err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	defer rows.Close()
+
+	objects := make(map[string]string)
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, errors.Join(errors.New("db query error"), err)
+		}
+		objects[id] = content
+	}
+
+	return objects, rows.Err()
+}
+
+func (r *SqlRepository) LoadMetadata(ctx context.Context, key AccountKey, presentation bool, ids ...string) (map[string]ItemMetadata, error) {
+	query := `SELECT i.id, i.type, i.issuer, i.format, i.metadata, i.created, i.updated, i.expiry, i.version FROM items i JOIN accounts a ON
+									a.tenant = i.tenant AND
+									a.account_partition = i.account_partition AND
+									a.region = i.region AND
+									a.country = i.country AND
+									a.account = i.account
+								WHERE i.tenant = ? AND i.account_partition = ? AND i.region = ? AND i.country = ? AND i.account = ? AND
+									i.kind = ? AND a.locked = ?`
+	args := []any{key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), false}
+
+	if len(ids) > 0 {
+		query += " AND i.id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, r.rebind(query+";"), args...)
+
+	if err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	defer rows.Close()
+
+	metadata := make(map[string]ItemMetadata)
+
+	for rows.Next() {
+		var id string
+		var itemType, issuer, format, index sql.NullString
+		var created, updated, expiry sql.NullInt64
+		var version int64
+		if err := rows.Scan(&id, &itemType, &issuer, &format, &index, &created, &updated, &expiry, &version); err != nil {
+			return nil, errors.Join(errors.New("db query error"), err)
+		}
+		item := ItemMetadata{
+			Type:    itemType.String,
+			Issuer:  issuer.String,
+			Format:  format.String,
+			Created: time.Unix(created.Int64, 0),
+			Updated: time.Unix(updated.Int64, 0),
+			Version: version,
+		}
+		if expiry.Valid {
+			item.Expiry = time.Unix(expiry.Int64, 0)
+		}
+		if index.Valid && index.String != "" {
+			if err := json.Unmarshal([]byte(index.String), &item.Index); err != nil {
+				return nil, err
+			}
+		}
+		metadata[id] = item
+	}
+
+	return metadata, rows.Err()
+}
+
+func (r *SqlRepository) LoadItem(ctx context.Context, key AccountKey, id string, presentation bool) (string, error) {
+	var content string
+
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT i.content FROM items i JOIN accounts a ON
+									a.tenant = i.tenant AND
+									a.account_partition = i.account_partition AND
+									a.region = i.region AND
+									a.country = i.country AND
+									a.account = i.account
+								WHERE i.tenant = ? AND i.account_partition = ? AND i.region = ? AND i.country = ? AND i.account = ? AND
+									i.kind = ? AND i.id = ? AND a.locked = ?;`),
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), id, false).Scan(&content)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", errors.Join(errors.New("db query error"), err)
+	}
+
+	return content, nil
+}
+
+func (r *SqlRepository) LoadPage(ctx context.Context, key AccountKey, presentation bool, limit int, cursor string) (map[string]string, string, error) {
+	after, err := decodeCursor(cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `SELECT i.id, i.content FROM items i JOIN accounts a ON
+									a.tenant = i.tenant AND
+									a.account_partition = i.account_partition AND
+									a.region = i.region AND
+									a.country = i.country AND
+									a.account = i.account
+								WHERE i.tenant = ? AND i.account_partition = ? AND i.region = ? AND i.country = ? AND i.account = ? AND
+									i.kind = ? AND a.locked = ? AND i.id > ? ORDER BY i.id`
+	args := []any{key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), false, after}
+
+	if limit > 0 {
+		// one more row than requested tells whether a next page exists
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+
+	rows, err := r.db.QueryContext(ctx, r.rebind(query+";"), args...)
+
+	if err != nil {
+		return nil, "", errors.Join(errors.New("db query error"), err)
+	}
+
+	defer rows.Close()
+
+	objects := make(map[string]string)
+	ids := make([]string, 0)
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, "", errors.Join(errors.New("db query error"), err)
+		}
+		objects[id] = content
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if limit > 0 && len(ids) > limit {
+		delete(objects, ids[limit])
+		next = encodeCursor(ids[limit-1])
+	}
+
+	return objects, next, nil
+}
+
+func (r *SqlRepository) DeleteItem(ctx context.Context, key AccountKey, id string, presentation bool) error {
+	_, err := r.exec(ctx, nil, `DELETE FROM items WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND kind = ? AND id = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), id)
+	return err
+}
+
+func (r *SqlRepository) ExpiredItems(ctx context.Context, tenant string, before time.Time) ([]ExpiredItem, error) {
+	rows, err := r.db.QueryContext(ctx, r.rebind(`SELECT account_partition, region, country, account, kind, id, expiry FROM items
+								WHERE tenant = ? AND kind IN (?, ?) AND expiry < ?;`),
+		tenant, objectName(false), objectName(true), before.Unix())
+
+	if err != nil {
+		return nil, errors.Join(errors.New("db query error"), err)
+	}
+
+	defer rows.Close()
+
+	items := make([]ExpiredItem, 0)
+
+	for rows.Next() {
+		item := ExpiredItem{Key: AccountKey{Tenant: tenant}}
+		var kind string
+		var expiry int64
+		if err := rows.Scan(&item.Key.Partition, &item.Key.Region, &item.Key.Country, &item.Key.Account, &kind, &item.Id, &expiry); err != nil {
+			return nil, errors.Join(errors.New("db query error"), err)
+		}
+		item.Presentation = kind == objectName(true)
+		item.Expiry = time.Unix(expiry, 0)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// ArchiveItem changes the kind of the item, an older archived item with the same id is replaced.
+func (r *SqlRepository) ArchiveItem(ctx context.Context, key AccountKey, id string, presentation bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = r.exec(ctx, tx, `DELETE FROM items WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND kind = ? AND id = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, archiveName(presentation), id)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := r.exec(ctx, tx, `UPDATE items SET kind = ? WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND kind = ? AND id = ?;`,
+		archiveName(presentation), key.Tenant, key.Partition, key.Region, key.Country, key.Account, objectName(presentation), id)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (r *SqlRepository) AccountExists(ctx context.Context, key AccountKey) (bool, error) {
+	var account string
+
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT account FROM accounts WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`),
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account).Scan(&account)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return account != "", err
+}
+
+// CreateDevice creates or resets the account, its devices are replaced by the first one.
+func (r *SqlRepository) CreateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = r.exec(ctx, tx, `INSERT INTO accounts (tenant, account_partition, region, country, account, last_update_timestamp, locked)
+								VALUES (?, ?, ?, ?, ?, ?, ?)
+								ON CONFLICT (tenant, account_partition, region, country, account)
+								DO UPDATE SET last_update_timestamp = excluded.last_update_timestamp,
+											  recovery_nonce = NULL,
+											  device_key = NULL,
+											  signature = NULL,
+											  nonce = NULL,
+											  nonce_expiry = NULL,
+											  locked = excluded.locked;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, time.Now().Unix(), false)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx, tx, `DELETE FROM devices WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account)
+
+	if err != nil {
+		return err
+	}
+
+	if err := r.insertDevice(ctx, tx, key, record, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SqlRepository) AddDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	exists, err := r.AccountExists(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return r.insertDevice(ctx, nil, key, record, time.Now())
+}
+
+// insertDevice adds the device to the account, ErrExists is returned when the id is bound already.
+func (r *SqlRepository) insertDevice(ctx context.Context, tx *sql.Tx, key AccountKey, record DeviceRecord, created time.Time) error {
+	result, err := r.exec(ctx, tx, `INSERT INTO devices (tenant, account_partition, region, country, account, id, label, device_key, signature, recovery_nonce, created)
+								VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+								ON CONFLICT (tenant, account_partition, region, country, account, id) DO NOTHING;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, record.Id, record.Label, record.DeviceKey, record.Signature, record.RecoveryNonce, created.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return errors.Join(ErrExists, err)
+	}
+
+	return nil
+}
+
+func (r *SqlRepository) UpdateDevice(ctx context.Context, key AccountKey, record DeviceRecord) error {
+	result, err := r.exec(ctx, nil, `UPDATE devices SET device_key = ?, signature = ?, recovery_nonce = ?
+								WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND id = ?;`,
+		record.DeviceKey, record.Signature, record.RecoveryNonce,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, record.Id)
+
+	return affectedOne(result, err)
+}
+
+// affectedOne maps a statement which changed no row to ErrNotFound.
+func affectedOne(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return errors.Join(ErrNotFound, err)
+	}
+
+	return nil
+}
+
+func (r *SqlRepository) LoadDevice(ctx context.Context, key AccountKey, id string) (*DeviceRecord, error) {
+	devices, err := r.ListDevices(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return selectDevice(devices, id)
+}
+
+/*
+ListDevices reads the lock from the account and the devices from their table. The device of an account which was
+registered before several devices were supported is only listed after the migrate command moved it.
+*/
+func (r *SqlRepository) ListDevices(ctx context.Context, key AccountKey) ([]DeviceRecord, error) {
+	var locked bool
+
+	err := r.db.QueryRowContext(ctx, r.rebind(`SELECT locked FROM accounts
+								WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`),
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account).Scan(&locked)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, r.rebind(`SELECT id, label, device_key, signature, recovery_nonce, nonce, nonce_expiry, created, last_seen FROM devices
+								WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`),
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	devices := make([]DeviceRecord, 0)
+	for rows.Next() {
+		var record DeviceRecord
+		var label, nonce sql.NullString
+		var nonceExpiry, created, lastSeen sql.NullInt64
+
+		if err := rows.Scan(&record.Id, &label, &record.DeviceKey, &record.Signature, &record.RecoveryNonce, &nonce, &nonceExpiry, &created, &lastSeen); err != nil {
+			return nil, err
+		}
+
+		record.Label = label.String
+		record.Created = time.Unix(created.Int64, 0)
+		record.Locked = locked
+
+		if lastSeen.Valid {
+			record.LastSeen = time.Unix(lastSeen.Int64, 0)
+		}
+
+		if nonceExpiry.Valid && nonceExpiry.Int64 > time.Now().Unix() {
+			record.Nonce = nonce.String
+		}
+
+		devices = append(devices, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortDevices(devices)
+	return devices, nil
+}
+
+/*
+MigrateDevices moves the device of every account registered before several devices were supported out of the
+accounts table into the devices table. Returns the number of moved devices.
+*/
+func (r *SqlRepository) MigrateDevices(ctx context.Context) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT tenant, account_partition, region, country, account, last_update_timestamp, device_key, signature, recovery_nonce FROM accounts
+								WHERE device_key IS NOT NULL AND device_key <> '';`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	type legacyDevice struct {
+		key     AccountKey
+		record  DeviceRecord
+		created time.Time
+	}
+
+	// the rows are read first, sqlite holds a single connection for the writes
+	legacy := make([]legacyDevice, 0)
+	for rows.Next() {
+		var device legacyDevice
+		var signature, recoveryNonce sql.NullString
+		var lastUpdate sql.NullInt64
+
+		if err := rows.Scan(&device.key.Tenant, &device.key.Partition, &device.key.Region, &device.key.Country, &device.key.Account,
+			&lastUpdate, &device.record.DeviceKey, &signature, &recoveryNonce); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		device.record.Signature = signature.String
+		device.record.RecoveryNonce = recoveryNonce.String
+		device.created = time.Unix(lastUpdate.Int64, 0)
+		legacy = append(legacy, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+
+	rows.Close()
+
+	moved := 0
+	for _, device := range legacy {
+		if err := r.migrateDevice(ctx, device.key, device.record, device.created); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+// migrateDevice moves the device stored in the account row into the devices table, under the id of its key.
+func (r *SqlRepository) migrateDevice(ctx context.Context, key AccountKey, record DeviceRecord, created time.Time) error {
+	id, err := storedDeviceId(record.DeviceKey)
+
+	if err != nil {
+		return errors.Join(errors.New("stored device key invalid"), err)
+	}
+
+	record.Id = id
+
+	tx, err := r.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := r.insertDevice(ctx, tx, key, record, created); err != nil && !errors.Is(err, ErrExists) {
+		return err
+	}
+
+	_, err = r.exec(ctx, tx, `UPDATE accounts SET device_key = NULL, signature = NULL, recovery_nonce = NULL, nonce = NULL, nonce_expiry = NULL
+								WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SqlRepository) DeleteDevice(ctx context.Context, key AccountKey, id string) error {
+	result, err := r.exec(ctx, nil, `DELETE FROM devices WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND id = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, id)
+
+	return affectedOne(result, err)
+}
+
+func (r *SqlRepository) SetNonce(ctx context.Context, key AccountKey, id string, nonce string, ttl time.Duration) error {
+	now := time.Now()
+
+	_, err := r.exec(ctx, nil, `UPDATE devices SET nonce = ?, nonce_expiry = ?, last_seen = ?
+								WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ? AND id = ?;`,
+		nonce, now.Add(ttl).Unix(), now.Unix(),
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account, id)
+	return err
+}
+
+func (r *SqlRepository) DeleteAccount(ctx context.Context, key AccountKey) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = r.exec(ctx, tx, `DELETE FROM items WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx, tx, `DELETE FROM devices WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx, tx, `DELETE FROM accounts WHERE tenant = ? AND account_partition = ? AND region = ? AND country = ? AND account = ?;`,
+		key.Tenant, key.Partition, key.Region, key.Country, key.Account)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateTenant records the tenant, the tables are shared by all tenants.
+func (r *SqlRepository) CreateTenant(ctx context.Context, tenant Tenant) error {
+	if err := tenant.Validate(); err != nil {
+		return err
+	}
+
+	replication, err := json.Marshal(tenant.Replication)
+
+	if err != nil {
+		return err
+	}
+
+	metadata, err := json.Marshal(tenant.Metadata)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := r.exec(ctx, nil, `INSERT INTO tenants (name, replication, created, metadata) VALUES (?, ?, ?, ?)
+								ON CONFLICT (name) DO NOTHING;`,
+		tenant.Name, string(replication), time.Now().Unix(), string(metadata))
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return errors.Join(ErrExists, err)
+	}
+
+	return nil
+}
+
+func (r *SqlRepository) ListTenants(ctx context.Context) ([]Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name, replication, created, metadata FROM tenants ORDER BY name;`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tenants := make([]Tenant, 0)
+
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tenants = append(tenants, *tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+func (r *SqlRepository) LoadTenant(ctx context.Context, name string) (*Tenant, error) {
+	tenant, err := scanTenant(r.db.QueryRowContext(ctx, r.rebind(`SELECT name, replication, created, metadata FROM tenants WHERE name = ?;`), name))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return tenant, err
+}
+
+func scanTenant(row interface{ Scan(...any) error }) (*Tenant, error) {
+	var tenant Tenant
+	var replication, metadata sql.NullString
+	var created sql.NullInt64
+
+	if err := row.Scan(&tenant.Name, &replication, &created, &metadata); err != nil {
+		return nil, err
+	}
+
+	if replication.Valid {
+		if err := json.Unmarshal([]byte(replication.String), &tenant.Replication); err != nil {
+			return nil, err
+		}
+	}
+
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &tenant.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	if created.Valid {
+		tenant.Created = time.Unix(created.Int64, 0)
+	}
+
+	return &tenant, nil
+}
+
+func (r *SqlRepository) DeleteTenant(ctx context.Context, name string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := r.exec(ctx, tx, `DELETE FROM tenants WHERE name = ?;`, name)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return errors.Join(ErrNotFound, err)
+	}
+
+	for _, table := range []string{"items", "devices", "accounts"} {
+		if _, err := r.exec(ctx, tx, `DELETE FROM `+table+` WHERE tenant = ?;`, name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,482 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	b64 "encoding/base64"
+	"errors"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSqliteRepository(t *testing.T) {
+	repo, err := NewSqlRepository(SqliteDriver, path.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	key := AccountKey{Tenant: "tenant_space", Partition: "ABCD", Region: "EU", Country: "DE", Account: "ABCD123"}
+
+	exists, err := repo.AccountExists(ctx, key)
+	if err != nil || exists {
+		t.Fatal("account should not exist", err)
+	}
+
+	err = repo.CreateDevice(ctx, key, DeviceRecord{Id: "device", DeviceKey: "key", Signature: "sig", RecoveryNonce: "recovery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.SetNonce(ctx, key, "device", "nonce", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := repo.LoadDevice(ctx, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Id != "device" || record.DeviceKey != "key" || record.Signature != "sig" || record.RecoveryNonce != "recovery" ||
+		record.Nonce != "nonce" || record.Locked || record.Created.IsZero() || record.LastSeen.IsZero() {
+		t.Error("device record is wrong", record)
+	}
+
+	err = repo.StoreItem(ctx, key, "1", "credential", ItemMetadata{Type: "VerifiableCredential", Issuer: "did:example:issuer", Format: "ldp_vc", Index: map[string]string{"type": "VerifiableCredential"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.StoreItem(ctx, key, "2", "presentation", ItemMetadata{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := repo.LoadItems(ctx, key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items["1"] != "credential" {
+		t.Error("credentials are wrong", items)
+	}
+
+	metadata, err := repo.LoadMetadata(ctx, key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadata) != 1 || metadata["1"].Type != "VerifiableCredential" || metadata["1"].Issuer != "did:example:issuer" ||
+		metadata["1"].Format != "ldp_vc" || metadata["1"].Index["type"] != "VerifiableCredential" || metadata["1"].Created.IsZero() {
+		t.Error("metadata is wrong", metadata)
+	}
+
+	err = repo.StoreItem(ctx, key, "3", "credential3", ItemMetadata{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := repo.LoadItem(ctx, key, "3", false)
+	if err != nil || content != "credential3" {
+		t.Error("single credential is wrong", err)
+	}
+
+	_, err = repo.LoadItem(ctx, key, "2", false)
+	if err != ErrNotFound {
+		t.Error("presentation should not be found as credential")
+	}
+
+	metadata, err = repo.LoadMetadata(ctx, key, false, "3", "4")
+	if err != nil || len(metadata) != 1 || metadata["3"].Version != 1 {
+		t.Error("metadata of ids is wrong", metadata, err)
+	}
+
+	page, next, err := repo.LoadPage(ctx, key, false, 1, "")
+	if err != nil || len(page) != 1 || page["1"] != "credential" || next == "" {
+		t.Fatal("first page is wrong", page, err)
+	}
+
+	page, next, err = repo.LoadPage(ctx, key, false, 1, next)
+	if err != nil || len(page) != 1 || page["3"] != "credential3" || next != "" {
+		t.Fatal("second page is wrong", page, err)
+	}
+
+	err = repo.DeleteItem(ctx, key, "3", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteItem(ctx, key, "1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _ = repo.LoadItems(ctx, key, false)
+	if len(items) != 0 {
+		t.Error("credential was not deleted")
+	}
+
+	err = repo.DeleteAccount(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.LoadDevice(ctx, key, "")
+	if err != ErrNotFound {
+		t.Error("account was not deleted")
+	}
+
+	items, _ = repo.LoadItems(ctx, key, true)
+	if len(items) != 0 {
+		t.Error("presentations were not deleted")
+	}
+}
+
+func TestSqliteDevices(t *testing.T) {
+	repo, err := NewSqlRepository(SqliteDriver, path.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	key := AccountKey{Tenant: "tenant_space", Partition: "ABCD", Region: "EU", Country: "DE", Account: "ABCD123"}
+
+	if err := repo.AddDevice(ctx, key, DeviceRecord{Id: "phone"}); !errors.Is(err, ErrNotFound) {
+		t.Error("device should not be added without account", err)
+	}
+
+	if err := repo.CreateDevice(ctx, key, DeviceRecord{Id: "phone", Label: "Phone", DeviceKey: "key1", Signature: "sig1", RecoveryNonce: "recovery1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.AddDevice(ctx, key, DeviceRecord{Id: "tablet", Label: "Tablet", DeviceKey: "key2", Signature: "sig2", RecoveryNonce: "recovery2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.AddDevice(ctx, key, DeviceRecord{Id: "tablet", DeviceKey: "key3"}); !errors.Is(err, ErrExists) {
+		t.Error("bound device id should conflict", err)
+	}
+
+	devices, err := repo.ListDevices(ctx, key)
+	if err != nil || len(devices) != 2 {
+		t.Fatal("devices are wrong", devices, err)
+	}
+
+	if _, err := repo.LoadDevice(ctx, key, ""); !errors.Is(err, ErrAmbiguousDevice) {
+		t.Error("device without id should be ambiguous", err)
+	}
+
+	if err := repo.SetNonce(ctx, key, "tablet", "nonce", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if record, err := repo.LoadDevice(ctx, key, "phone"); err != nil || record.DeviceKey != "key1" || record.Nonce != "" {
+		t.Error("nonce of the tablet is set for the phone", record, err)
+	}
+
+	if err := repo.UpdateDevice(ctx, key, DeviceRecord{Id: "tablet", DeviceKey: "key4", Signature: "sig4", RecoveryNonce: "recovery4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := repo.LoadDevice(ctx, key, "tablet")
+	if err != nil || record.Label != "Tablet" || record.DeviceKey != "key4" || record.Nonce != "nonce" {
+		t.Error("tablet is wrong", record, err)
+	}
+
+	if err := repo.DeleteDevice(ctx, key, "phone"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteDevice(ctx, key, "phone"); !errors.Is(err, ErrNotFound) {
+		t.Error("revoked device should not be found", err)
+	}
+
+	if err := repo.SetNonce(ctx, key, "phone", "nonce", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if devices, err := repo.ListDevices(ctx, key); err != nil || len(devices) != 1 {
+		t.Error("nonce should not bring back a revoked device", devices, err)
+	}
+
+	if record, err := repo.LoadDevice(ctx, key, ""); err != nil || record.Id != "tablet" {
+		t.Error("remaining device should be loaded without id", record, err)
+	}
+
+	if err := repo.CreateDevice(ctx, key, DeviceRecord{Id: "laptop", DeviceKey: "key5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if devices, err := repo.ListDevices(ctx, key); err != nil || len(devices) != 1 || devices[0].Id != "laptop" {
+		t.Error("registration should replace the devices", devices, err)
+	}
+}
+
+func TestSqliteDeviceMigration(t *testing.T) {
+	file := path.Join(t.TempDir(), "storage.db")
+
+	repo, err := NewSqlRepository(SqliteDriver, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	jwk := `{"kty":"EC","crv":"P-256","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}`
+	deviceKey := b64.StdEncoding.EncodeToString([]byte(jwk))
+
+	// account of a version with a single device
+	_, err = repo.(*SqlRepository).db.Exec(`INSERT INTO accounts (tenant, account_partition, region, country, account, last_update_timestamp, device_key, signature, recovery_nonce, locked)
+					VALUES ('tenant_space', 'ABCD', 'EU', 'DE', 'ABCD123', 1700000000, ?, 'sig', 'recovery', FALSE);`, deviceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	key := AccountKey{Tenant: "tenant_space", Partition: "ABCD", Region: "EU", Country: "DE", Account: "ABCD123"}
+
+	id, err := storedDeviceId(deviceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if devices, err := repo.ListDevices(ctx, key); err != nil || len(devices) != 0 {
+		t.Fatal("legacy device listed before the migration", devices, err)
+	}
+
+	moved, err := repo.(*SqlRepository).MigrateDevices(ctx)
+	if err != nil || moved != 1 {
+		t.Fatal("legacy device was not migrated", moved, err)
+	}
+
+	if moved, err := repo.(*SqlRepository).MigrateDevices(ctx); err != nil || moved != 0 {
+		t.Fatal("migrated device was moved again", moved, err)
+	}
+
+	record, err := repo.LoadDevice(ctx, key, id)
+	if err != nil || record.DeviceKey != deviceKey || record.Signature != "sig" || record.RecoveryNonce != "recovery" || record.Created.Unix() != 1700000000 {
+		t.Fatal("legacy device was not moved", record, err)
+	}
+
+	if err := repo.DeleteDevice(ctx, key, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if devices, err := repo.ListDevices(ctx, key); err != nil || len(devices) != 0 {
+		t.Error("revoked legacy device came back", devices, err)
+	}
+}
+
+func TestSqliteExpiry(t *testing.T) {
+	repo, err := NewSqlRepository(SqliteDriver, path.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	key := AccountKey{Tenant: "tenant_space", Partition: "ABCD", Region: "EU", Country: "DE", Account: "ABCD123"}
+	expired := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	for id, expiry := range map[string]time.Time{"expired": expired, "valid": time.Now().Add(time.Hour), "unlimited": {}} {
+		if err := repo.StoreItem(ctx, key, id, id, ItemMetadata{Expiry: expiry}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metadata, _ := repo.LoadMetadata(ctx, key, false)
+	if !metadata["expired"].Expiry.Equal(expired) || !metadata["unlimited"].Expiry.IsZero() {
+		t.Error("expiry is wrong", metadata)
+	}
+
+	items, err := repo.ExpiredItems(ctx, "tenant_space", time.Now())
+	if err != nil || len(items) != 1 || items[0].Id != "expired" || items[0].Key != key || items[0].Presentation {
+		t.Fatal("expired items are wrong", items, err)
+	}
+
+	for n := 0; n < 2; n++ {
+		if err := repo.ArchiveItem(ctx, key, "expired", false); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, _ := repo.LoadItems(ctx, key, false)
+		if _, ok := loaded["expired"]; ok || len(loaded) != 2 {
+			t.Error("archived item is still loaded", loaded)
+		}
+
+		// the same id stored again is archived again
+		repo.StoreItem(ctx, key, "expired", "expired", ItemMetadata{Expiry: expired}, false)
+	}
+
+	if err := repo.ArchiveItem(ctx, key, "missing", false); err != ErrNotFound {
+		t.Error("missing item should not be archived", err)
+	}
+}
+
+func TestConditionalStores(t *testing.T) {
+	sqlite, err := NewSqlRepository(SqliteDriver, path.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close()
+
+	ctx := context.Background()
+	key := AccountKey{Tenant: "tenant_space", Partition: "ABCD", Region: "EU", Country: "DE", Account: "ABCD123"}
+
+	for name, repo := range map[string]Repository{"sqlite": sqlite, "memory": NewMemoryRepository()} {
+		store := func(content string, condition Condition) (int64, error) {
+			return repo.StoreItemIf(ctx, key, "1", content, ItemMetadata{}, false, condition)
+		}
+
+		if _, err := store("a", Condition{Version: 1}); err != ErrVersionMismatch {
+			t.Error(name, "missing item should not match a version", err)
+		}
+
+		if _, err := store("a", Condition{Exists: true}); err != ErrVersionMismatch {
+			t.Error(name, "missing item should not exist", err)
+		}
+
+		if version, err := store("a", Condition{Absent: true, IdempotencyKey: "m1"}); err != nil || version != 1 {
+			t.Fatal(name, "item should be created", version, err)
+		}
+
+		if _, err := store("b", Condition{Absent: true}); err != ErrExists {
+			t.Error(name, "existing item should not be created", err)
+		}
+
+		if version, err := store("b", Condition{IdempotencyKey: "m1"}); err != ErrUnchanged || version != 1 {
+			t.Error(name, "repeated key should not store", version, err)
+		}
+
+		if version, err := store("b", Condition{Version: 1, IdempotencyKey: "m2"}); err != nil || version != 2 {
+			t.Error(name, "matching version should store", version, err)
+		}
+
+		if _, err := store("c", Condition{Version: 1}); err != ErrVersionMismatch {
+			t.Error(name, "stale version should not store", err)
+		}
+
+		if version, err := store("c", Condition{}); err != nil || version != 3 {
+			t.Error(name, "unconditional store should store", version, err)
+		}
+
+		content, _ := repo.LoadItem(ctx, key, "1", false)
+		metadata, _ := repo.LoadMetadata(ctx, key, false)
+
+		if content != "c" || metadata["1"].Version != 3 {
+			t.Error(name, "stored item is wrong", content, metadata["1"])
+		}
+	}
+}
+
+func TestSqliteSchemaMigration(t *testing.T) {
+	file := path.Join(t.TempDir(), "storage.db")
+
+	db, err := sql.Open(SqliteDriver, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// items table of a version without item versions
+	_, err = db.Exec(`CREATE TABLE items (tenant TEXT NOT NULL, account_partition TEXT NOT NULL, region TEXT NOT NULL, country TEXT NOT NULL,
+						account TEXT NOT NULL, kind TEXT NOT NULL, id TEXT NOT NULL, content TEXT NOT NULL, type TEXT, issuer TEXT, format TEXT,
+						metadata TEXT, created BIGINT, updated BIGINT, expiry BIGINT, PRIMARY KEY (tenant, account_partition, region, country, account, kind, id));
+					INSERT INTO items (tenant, account_partition, region, country, account, kind, id, content) VALUES ('tenant_space', 'ABCD', 'EU', 'DE', 'ABCD123', 'credentials', '1', 'old');`)
+	db.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewSqlRepository(SqliteDriver, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	key := AccountKey{Tenant: "tenant_space", Partition: "ABCD", Region: "EU", Country: "DE", Account: "ABCD123"}
+
+	if version, err := repo.StoreItemIf(context.Background(), key, "1", "new", ItemMetadata{}, false, Condition{Version: 1}); err != nil || version != 2 {
+		t.Error("existing item should have version 1", version, err)
+	}
+}
+
+func TestSqliteTenants(t *testing.T) {
+	repo, err := NewSqlRepository(SqliteDriver, path.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	tenant := Tenant{Name: "acme", Replication: Replication{Class: SimpleStrategy, Factor: 1}, Metadata: map[string]string{"owner": "ops"}}
+
+	if err := repo.CreateTenant(ctx, tenant); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.CreateTenant(ctx, tenant); !errors.Is(err, ErrExists) {
+		t.Error("existing tenant should not be created", err)
+	}
+
+	key := AccountKey{Tenant: "acme", Partition: "ABCD", Account: "ABCD123"}
+	if err := repo.StoreItem(ctx, key, "one", "content", ItemMetadata{}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tenants, err := repo.ListTenants(ctx)
+	if err != nil || len(tenants) != 1 || tenants[0].Metadata["owner"] != "ops" || tenants[0].Replication.Factor != 1 || tenants[0].Created.IsZero() {
+		t.Fatal("tenants are wrong", tenants, err)
+	}
+
+	if err := repo.DeleteTenant(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := repo.AccountExists(ctx, key); exists {
+		t.Error("accounts of the tenant should be deleted")
+	}
+
+	if _, err := repo.LoadTenant(ctx, "acme"); !errors.Is(err, ErrNotFound) {
+		t.Error("deleted tenant should not be found", err)
+	}
+
+	if err := repo.DeleteTenant(ctx, "acme"); !errors.Is(err, ErrNotFound) {
+		t.Error("unknown tenant should not be deleted", err)
+	}
+
+	// keyspace names are lowercased by Cassandra, so mixed case names would address another keyspace
+	mixed := Tenant{Name: "Acme", Replication: Replication{Class: SimpleStrategy, Factor: 1}}
+
+	if err := repo.CreateTenant(ctx, mixed); !errors.Is(err, ErrInvalidTenant) {
+		t.Error("mixed case tenant should be invalid", err)
+	}
+
+	if _, err := repo.LoadTenant(ctx, "Acme"); !errors.Is(err, ErrNotFound) {
+		t.Error("mixed case tenant should not be found", err)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	cql, err := Replication{Class: NetworkTopologyStrategy, DataCenters: map[string]int{"dc2": 2, "dc1": 3}}.cql()
+
+	if err != nil || cql != "{'class': 'NetworkTopologyStrategy', 'dc1': 3, 'dc2': 2}" {
+		t.Error("replication is wrong", cql, err)
+	}
+
+	invalid := []Tenant{
+		{Name: "1acme", Replication: Replication{Class: SimpleStrategy, Factor: 1}},
+		{Name: "Acme", Replication: Replication{Class: SimpleStrategy, Factor: 1}},
+		{Name: "acme", Replication: Replication{Class: SimpleStrategy}},
+		{Name: "acme", Replication: Replication{Class: NetworkTopologyStrategy, DataCenters: map[string]int{"dc1'}; DROP": 1}}},
+	}
+
+	for _, tenant := range invalid {
+		if err := tenant.Validate(); !errors.Is(err, ErrInvalidTenant) {
+			t.Error("tenant should be invalid", tenant, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Replication classes of Cassandra keyspaces.
+const (
+	SimpleStrategy          = "SimpleStrategy"
+	NetworkTopologyStrategy = "NetworkTopologyStrategy"
+)
+
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+/*
+tenantName is the syntax of unquoted Cassandra keyspace names, tenant names are interpolated into queries. Cassandra
+lowercases unquoted names, so upper case letters are refused, otherwise a tenant Foo would be created in the keyspace
+foo but looked up as Foo in system_schema.
+*/
+var tenantName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,47}$`)
+
+var dataCenterName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+/*
+Tenant describes a provisioned tenant. The name is the Cassandra keyspace of the tenant, the replication applies to
+that keyspace only and is just recorded by the other backends. Created is maintained by the repository.
+*/
+type Tenant struct {
+	Name        string
+	Replication Replication
+	Created     time.Time
+	Metadata    map[string]string
+}
+
+// Replication is either a SimpleStrategy with a factor or a NetworkTopologyStrategy with a factor per data center.
+type Replication struct {
+	Class       string         `json:"class"`
+	Factor      int            `json:"factor,omitempty"`
+	DataCenters map[string]int `json:"dataCenters,omitempty"`
+}
+
+// ValidTenantName reports whether the name can be used as keyspace of a tenant.
+func ValidTenantName(name string) bool {
+	return tenantName.MatchString(name)
+}
+
+// Validate rejects names and replications which can not be used for a keyspace.
+func (t Tenant) Validate() error {
+	if !tenantName.MatchString(t.Name) {
+		return fmt.Errorf("%w: name must be a lower case letter followed by up to 47 lower case letters, digits or underscores", ErrInvalidTenant)
+	}
+
+	_, err := t.Replication.cql()
+	return err
+}
+
+// cql formats the replication as map of a CREATE KEYSPACE statement.
+func (r Replication) cql() (string, error) {
+	switch r.Class {
+	case SimpleStrategy:
+		if r.Factor < 1 {
+			return "", fmt.Errorf("%w: replication factor must be positive", ErrInvalidTenant)
+		}
+		return fmt.Sprintf("{'class': '%s', 'replication_factor': %d}", SimpleStrategy, r.Factor), nil
+	case NetworkTopologyStrategy:
+		if len(r.DataCenters) == 0 {
+			return "", fmt.Errorf("%w: data centers are missing", ErrInvalidTenant)
+		}
+
+		names := make([]string, 0, len(r.DataCenters))
+		for name, factor := range r.DataCenters {
+			if !dataCenterName.MatchString(name) || factor < 1 {
+				return "", fmt.Errorf("%w: invalid data center %q", ErrInvalidTenant, name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		entries := []string{fmt.Sprintf("'class': '%s'", NetworkTopologyStrategy)}
+		for _, name := range names {
+			entries = append(entries, fmt.Sprintf("'%s': %d", name, r.DataCenters[name]))
+		}
+		return "{" + strings.Join(entries, ", ") + "}", nil
+	}
+
+	return "", fmt.Errorf("%w: unsupported replication class %q", ErrInvalidTenant, r.Class)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+)
+
+// Policies for imported items whose id exists already.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+var ErrUnknownKind = errors.New("unknown item kind")
+
+// ParseConflictPolicy validates the conflict policy of an import, the default is to skip existing items.
+func ParseConflictPolicy(policy string) (string, error) {
+	policy = strings.ToLower(policy)
+
+	switch policy {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return policy, nil
+	}
+
+	return "", errors.New("unsupported conflict policy: " + policy)
+}
+
+/*
+Usage: Collects all active credentials and presentations of the account with their metadata, ordered by kind and
+id. Expired items are included, items which can not be decrypted are skipped like in every other read.
+*/
+
+func ExportArchive(ctx context.Context, authModel model.AuthModel, env *common.Environment) (*model.ArchiveModel, error) {
+	archive := model.ArchiveModel{Exported: time.Now().UTC(), Items: make([]model.ArchiveItem, 0)}
+
+	for _, presentation := range []bool{false, true} {
+		items, index, err := LoadCredentials(ctx, authModel, env, presentation, metadata.Query{}, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		decrypted := DecryptItems(ctx, authModel, env, items)
+
+		ids := make([]string, 0, len(decrypted))
+		for id := range decrypted {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			archive.Items = append(archive.Items, archiveItem(id, decrypted[id].(string), index[id], presentation))
+		}
+	}
+
+	return &archive, nil
+}
+
+func archiveItem(id string, content string, itemMetadata repository.ItemMetadata, presentation bool) model.ArchiveItem {
+	item := model.ArchiveItem{
+		Kind:    archiveKind(presentation),
+		Id:      id,
+		Content: content,
+		Format:  itemMetadata.Format,
+		Type:    itemMetadata.Type,
+		Issuer:  itemMetadata.Issuer,
+		Created: itemMetadata.Created,
+		Updated: itemMetadata.Updated,
+		Version: itemMetadata.Version,
+	}
+
+	if !itemMetadata.Expiry.IsZero() {
+		item.Expiry = &itemMetadata.Expiry
+	}
+
+	return item
+}
+
+func archiveKind(presentation bool) string {
+	if presentation {
+		return model.PresentationKind
+	}
+	return model.CredentialKind
+}
+
+/*
+Usage: Stores an archived item like a PUT, so the content is validated and indexed again and the metadata of the
+archive is not taken over. An existing id is skipped, overwritten or the item is stored under a new id, depending on
+the policy. Items without id get one like on POST. Failures are reported in the result, so that one broken item does
+not stop the import. The nonce of a remote device is not renewed per item, the import renews it once.
+*/
+
+func ImportItem(ctx context.Context, authModel model.AuthModel, env *common.Environment, item model.ArchiveItem, policy string) model.ImportItemResult {
+	result := model.ImportItemResult{Kind: item.Kind, Id: item.Id, StoredId: item.Id, Status: model.ImportStored}
+
+	var presentation bool
+
+	switch item.Kind {
+	case model.CredentialKind:
+	case model.PresentationKind:
+		presentation = true
+	default:
+		return failedImport(result, ErrUnknownKind)
+	}
+
+	content := []byte(item.Content)
+
+	if item.Id == "" {
+		id, version, err := CreateItem(ctx, content, authModel, env, presentation, repository.Condition{})
+		result.StoredId, result.Version = id, version
+		return failedImport(result, err)
+	}
+
+	version, err := StoreItem(ctx, item.Id, content, authModel, env, presentation, repository.Condition{Absent: true})
+
+	if errors.Is(err, repository.ErrExists) {
+		switch policy {
+		case ConflictSkip:
+			result.Status = model.ImportSkipped
+			return result
+		case ConflictOverwrite:
+			result.Status = model.ImportOverwritten
+			version, err = StoreItem(ctx, item.Id, content, authModel, env, presentation, repository.Condition{})
+		case ConflictRename:
+			result.Status = model.ImportRenamed
+			result.StoredId, version, err = storeGenerated(ctx, content, authModel, env, presentation, repository.Condition{})
+		}
+	}
+
+	result.Version = version
+	return failedImport(result, err)
+}
+
+// failedImport marks the result as failed when an error occurred.
+func failedImport(result model.ImportItemResult, err error) model.ImportItemResult {
+	if err != nil {
+		result.Status = model.ImportFailed
+		result.StoredId = ""
+		result.Version = 0
+		result.Error = err.Error()
+	}
+	return result
+}
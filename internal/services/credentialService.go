@@ -1,84 +1,240 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	b64 "encoding/base64"
 	"errors"
-	"fmt"
+	"regexp"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
-	"github.com/eclipse-xfsc/credential-storage-service/internal/connection"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
 	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+// maxIdAttempts limits the generation of ids which collide with existing items.
+const maxIdAttempts = 3
+
+var safeId = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~:-]{0,127}$`)
+
+/*
+Usage: Stores the item when the condition holds and returns the new version. A repeated idempotency key returns the
+current version without storing. In remote mode the nonce of the device is renewed before the store, the receipt is
+returned also when the store failed, so that the device can continue with the new nonce.
+*/
+
 func StoreMessage(ctx context.Context,
 	id string,
 	msg []byte,
-	authModel model.AuthModel, env *common.Environment, presentation bool) (*model.Receipt, error) {
+	authModel model.AuthModel, env *common.Environment, presentation bool, condition repository.Condition) (*model.Receipt, int64, error) {
 
-	session := env.GetSession()
+	receipt, err := storeReceipt(ctx, authModel, env)
 
-	if env.GetContentType() == common.EncryptedContentType {
-		cipher, err := crypto.EncryptMessage(authModel.Account, env.GetCryptoNamespace(), common.StorageCryptoContext, msg, ctx, env.GetCryptoProvider())
-		if err == nil && cipher != nil {
+	if err != nil {
+		return nil, 0, err
+	}
 
-			receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+	version, err := StoreItem(ctx, id, msg, authModel, env, presentation, condition)
+	return receipt, version, err
+}
 
-			if receipt != nil {
-				err = executeStoring(id, ctx, cipher, session, authModel, env, presentation)
-				return receipt, err
-			}
-		}
+// storeReceipt renews the nonce of a remote device for a store, plain requests get no receipt.
+func storeReceipt(ctx context.Context, authModel model.AuthModel, env *common.Environment) (*model.Receipt, error) {
+	if authModel.ContentType != common.EncryptedContentType {
+		return nil, nil
+	}
 
-		if err != nil {
-			logrus.Error(err.Error())
-		}
-		return nil, err
+	receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+	if receipt == nil {
+		return nil, errors.New("Receipt Failure")
 	}
 
-	if env.GetContentType() == common.NormalContentType {
-		cipher, err := crypto.EncryptMessage(authModel.Account, env.GetCryptoNamespace(), common.StorageCryptoContext, msg, ctx, env.GetCryptoProvider())
+	return receipt, nil
+}
+
+/*
+Usage: Stores the item like StoreMessage, but without renewing the nonce of a remote device. Requests which store
+several items renew it once.
+*/
+
+func StoreItem(ctx context.Context,
+	id string,
+	msg []byte,
+	authModel model.AuthModel, env *common.Environment, presentation bool, condition repository.Condition) (int64, error) {
+
+	var itemMetadata repository.ItemMetadata
+	var content []byte
+
+	switch {
+	case EndToEnd(authModel, env):
+		// the JWE of the device is the stored item, the storage adds no key which could decrypt it
+		fields := metadata.Protected(msg)
+		itemMetadata = env.GetIndexer().Index(fields)
+		itemMetadata.Expiry = fields.Expiry
+		content = msg
+	case authModel.ContentType == common.EncryptedContentType:
+		cipher, err := crypto.EncryptMessage(authModel.Account, env.GetCryptoNamespace(authModel.TenantId), common.StorageCryptoContext, msg, ctx, env.GetCryptoProvider())
 		if err != nil {
 			logrus.Error(err.Error())
-			return nil, err
+			return 0, err
 		}
-		err = executeStoring(id, ctx, cipher, session, authModel, env, presentation)
+		itemMetadata = env.GetIndexer().Metadata(msg)
+		content = cipher
+	case authModel.ContentType == common.NormalContentType:
+		format, err := metadata.Detect(msg)
+		if err != nil {
+			return 0, err
+		}
+
+		itemMetadata = env.GetIndexer().Metadata(msg)
+		itemMetadata.Format = format
+		itemMetadata.Expiry = metadata.Extract(msg).Expiry
 
+		cipher, err := crypto.EncryptMessage(authModel.Account, env.GetCryptoNamespace(authModel.TenantId), common.StorageCryptoContext, msg, ctx, env.GetCryptoProvider())
 		if err != nil {
 			logrus.Error(err.Error())
-			return nil, err
+			return 0, err
+		}
+		content = cipher
+	default:
+		return 0, errors.New("content types doesnt fit.")
+	}
+
+	version, err := executeStoring(id, ctx, content, itemMetadata, authModel, env, presentation, condition)
+
+	if errors.Is(err, repository.ErrUnchanged) {
+		return version, nil
+	}
+
+	if err != nil {
+		logrus.Error(err.Error())
+		return 0, err
+	}
+
+	PublishItemEvent(ctx, env, authModel, id, presentation, false)
+
+	return version, nil
+}
+
+// EndToEnd reports whether the items of the request are stored as the device encrypted them.
+func EndToEnd(authModel model.AuthModel, env *common.Environment) bool {
+	return authModel.ContentType == common.EncryptedContentType && env.IsEndToEnd(authModel.TenantId)
+}
+
+/*
+Usage: Stores an item for which the client chose no id. Plain items get an id derived from their id or jti, so that
+storing a credential twice keeps a single item. A derived id never replaces another item, which can carry the same
+jti from another issuer or was stored under this id by the client, the item gets a generated id then. Otherwise,
+like in remote mode where the payload is encrypted by the client, the id is derived from the idempotency key or
+generated. Returns the id along with the result of StoreMessage.
+*/
+
+func CreateMessage(ctx context.Context,
+	msg []byte,
+	authModel model.AuthModel, env *common.Environment, presentation bool, condition repository.Condition) (string, *model.Receipt, int64, error) {
+
+	receipt, err := storeReceipt(ctx, authModel, env)
+
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	id, version, err := CreateItem(ctx, msg, authModel, env, presentation, condition)
+	return id, receipt, version, err
+}
+
+// CreateItem stores an item like CreateMessage, but without renewing the nonce of a remote device.
+func CreateItem(ctx context.Context,
+	msg []byte,
+	authModel model.AuthModel, env *common.Environment, presentation bool, condition repository.Condition) (string, int64, error) {
+
+	if authModel.ContentType == common.NormalContentType {
+		if id := derivedId(metadata.Extract(msg).Id); id != "" {
+			version, err := StoreItem(ctx, id, msg, authModel, env, presentation, repository.Condition{Absent: true, IdempotencyKey: condition.IdempotencyKey})
+
+			if !errors.Is(err, repository.ErrExists) {
+				return id, version, err
+			}
+
+			if version, same := storedAs(ctx, id, msg, authModel, env, presentation); same {
+				return id, version, nil
+			}
+
+			return storeGenerated(ctx, msg, authModel, env, presentation, condition)
 		}
+	}
+
+	if condition.IdempotencyKey != "" {
+		// a repeated message finds the item of its first delivery
+		id := hashedId(condition.IdempotencyKey)
+		version, err := StoreItem(ctx, id, msg, authModel, env, presentation, condition)
+		return id, version, err
+	}
 
-		return nil, err
+	return storeGenerated(ctx, msg, authModel, env, presentation, condition)
+}
+
+// storedAs reports whether the item with the id has the content of the message and returns its version.
+func storedAs(ctx context.Context, id string, msg []byte, authModel model.AuthModel, env *common.Environment, presentation bool) (int64, bool) {
+	item, err := env.GetRepository().LoadItem(ctx, env.GetAccountKey(authModel), id, presentation)
+
+	if err != nil {
+		return 0, false
 	}
 
-	return nil, errors.New("content types doesnt fit.")
+	stored, err := DecryptItem(ctx, authModel, env, item)
+
+	if err != nil || !bytes.Equal(stored, msg) {
+		return 0, false
+	}
 
+	index, err := env.GetRepository().LoadMetadata(ctx, env.GetAccountKey(authModel), presentation, id)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return index[id].Version, true
 }
 
-func executeStoring(id string, ctx context.Context, msg []byte, session connection.SessionInterface, authModel model.AuthModel, env *common.Environment, presentation bool) error {
+// storeGenerated stores the item under a new random id, which is retried when it exists already.
+func storeGenerated(ctx context.Context,
+	msg []byte,
+	authModel model.AuthModel, env *common.Environment, presentation bool, condition repository.Condition) (string, int64, error) {
+	condition.Absent = true
 
-	object := "credentials"
+	for attempt := 1; ; attempt++ {
+		id := uuid.NewString()
+		version, err := StoreItem(ctx, id, msg, authModel, env, presentation, condition)
 
-	if presentation {
-		object = "presentations"
+		if !errors.Is(err, repository.ErrExists) || attempt == maxIdAttempts {
+			return id, version, err
+		}
+	}
+}
+
+// derivedId uses the id of a credential as item id. Ids which are no safe path segment, like URLs, are hashed.
+func derivedId(id string) string {
+	if id == "" || safeId.MatchString(id) {
+		return id
 	}
 
-	queryString := fmt.Sprintf(`UPDATE %s.credentials SET %s[?] = ?, locked=False, last_update_timestamp=toTimestamp(now()) WHERE 
-																  		  accountPartition=? AND 
-																					region=? AND 
-																					country=? AND
-																					account=?;`, authModel.TenantId, object)
-
-	return session.Query(queryString,
-		id,
-		b64.RawStdEncoding.EncodeToString(msg),
-		env.GetAccountPartition(authModel.Account),
-		env.GetRegion(),
-		env.GetCountry(),
-		authModel.Account).WithContext(ctx).Exec()
+	return hashedId(id)
+}
+
+func hashedId(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return b64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func executeStoring(id string, ctx context.Context, msg []byte, metadata repository.ItemMetadata, authModel model.AuthModel, env *common.Environment, presentation bool, condition repository.Condition) (int64, error) {
+	return env.GetRepository().StoreItemIf(ctx, env.GetAccountKey(authModel), id, b64.RawStdEncoding.EncodeToString(msg), metadata, presentation, condition)
 }
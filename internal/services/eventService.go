@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+)
+
+/*
+Usage: Announces a change of the account on the lifecycle topic. Failures are logged only, the change itself is
+done already.
+*/
+
+func PublishEvent(ctx context.Context, env *common.Environment, eventType string, authModel model.AuthModel, id string, itemType string) {
+	err := env.GetPublisher().Publish(ctx, eventType, messaging.StorageServiceLifecycleEvent{
+		TenantId:  authModel.TenantId,
+		AccountId: authModel.Account,
+		Id:        id,
+		Type:      itemType,
+	})
+
+	if err != nil {
+		env.GetLogger().Error(err, "Lifecycle event could not be published", "type", eventType, "tenant", authModel.TenantId)
+	}
+}
+
+// PublishItemEvent announces a stored or deleted credential or presentation.
+func PublishItemEvent(ctx context.Context, env *common.Environment, authModel model.AuthModel, id string, presentation bool, deleted bool) {
+	eventType := messaging.CredentialStoredType
+	itemType := messaging.StoreCredentialType
+
+	switch {
+	case presentation && deleted:
+		eventType, itemType = messaging.PresentationDeletedType, messaging.StorePresentationType
+	case presentation:
+		eventType, itemType = messaging.PresentationStoredType, messaging.StorePresentationType
+	case deleted:
+		eventType = messaging.CredentialDeletedType
+	}
+
+	PublishEvent(ctx, env, eventType, authModel, id, itemType)
+}
+
+// PublishLocked announces a locked account once, the refused retries of its devices are not announced again.
+func PublishLocked(ctx context.Context, env *common.Environment, authModel model.AuthModel) {
+	err := env.GetPublisher().PublishLocked(ctx, messaging.StorageServiceLifecycleEvent{
+		TenantId:  authModel.TenantId,
+		AccountId: authModel.Account,
+	})
+
+	if err != nil {
+		env.GetLogger().Error(err, "Lifecycle event could not be published", "type", messaging.AccountLockedType, "tenant", authModel.TenantId)
+	}
+}
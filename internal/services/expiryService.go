@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
+)
+
+const (
+	ExpiryPolicyNone    = "NONE"
+	ExpiryPolicyArchive = "ARCHIVE"
+	ExpiryPolicyDelete  = "DELETE"
+)
+
+/*
+ExpirySweeper archives or deletes the items which are expired for longer than the grace period. Archived items are
+kept in the database, but are not returned anymore.
+*/
+type ExpirySweeper struct {
+	policy  string
+	grace   time.Duration
+	tenants []tenancy.Tenant
+}
+
+// NewExpirySweeper validates the keyspaces of the tenants, which are interpolated into the sweep queries.
+func NewExpirySweeper(policy string, grace time.Duration, tenants []tenancy.Tenant) (*ExpirySweeper, error) {
+	policy = strings.ToUpper(policy)
+
+	if policy == "" {
+		policy = ExpiryPolicyNone
+	}
+
+	if policy != ExpiryPolicyNone && policy != ExpiryPolicyArchive && policy != ExpiryPolicyDelete {
+		return nil, errors.New("unsupported expiry policy: " + policy)
+	}
+
+	if grace < 0 {
+		return nil, errors.New("expiry grace period must not be negative")
+	}
+
+	for _, tenant := range tenants {
+		if !repository.ValidTenantName(tenant.Keyspace) {
+			return nil, fmt.Errorf("invalid keyspace %q of tenant %q", tenant.Keyspace, tenant.Id)
+		}
+	}
+
+	return &ExpirySweeper{policy: policy, grace: grace, tenants: tenants}, nil
+}
+
+func (s *ExpirySweeper) Enabled() bool {
+	return s.policy != ExpiryPolicyNone
+}
+
+/*
+Run sweeps in the given interval until the context is cancelled. Failures are logged and retried in the next run. A
+running sweep stops on cancellation after the current item, so that no item is left half processed.
+*/
+func (s *ExpirySweeper) Run(ctx context.Context, env *common.Environment, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(ctx, env); err != nil && ctx.Err() == nil {
+			env.GetLogger().Error(err, "Expiry sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Sweep processes the expired items of all tenants once and continues with the next tenant on failures. A cancelled
+context stops the sweep between two items.
+*/
+func (s *ExpirySweeper) Sweep(ctx context.Context, env *common.Environment) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	var errs []error
+
+	for _, tenant := range s.tenants {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := s.sweepTenant(ctx, env, tenant); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sweepTenant scans the keyspace of the tenant, events and logs name the tenant id.
+func (s *ExpirySweeper) sweepTenant(ctx context.Context, env *common.Environment, tenant tenancy.Tenant) error {
+	logger := env.GetLogger()
+
+	items, err := env.GetRepository().ExpiredItems(ctx, tenant.Keyspace, time.Now().Add(-s.grace))
+
+	if err != nil {
+		return err
+	}
+
+	processed := 0
+	// a started item is finished, also when the sweep is cancelled meanwhile
+	itemCtx := context.WithoutCancel(ctx)
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			logger.Info("Expiry sweep stopped", "tenant", tenant.Id, "action", s.policy, "items", processed)
+			return ctx.Err()
+		}
+
+		if s.policy == ExpiryPolicyArchive {
+			err = env.GetRepository().ArchiveItem(itemCtx, item.Key, item.Id, item.Presentation)
+		} else {
+			err = env.GetRepository().DeleteItem(itemCtx, item.Key, item.Id, item.Presentation)
+		}
+
+		// an item removed in the meantime is no failure
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logger.Error(err, "Expired item could not be processed", "tenant", tenant.Id, "account", item.Key.Account, "id", item.Id)
+			continue
+		}
+
+		if s.policy == ExpiryPolicyDelete && err == nil {
+			PublishItemEvent(itemCtx, env, model.AuthModel{Account: item.Key.Account, TenantId: tenant.Id, Keyspace: tenant.Keyspace}, item.Id, item.Presentation, true)
+		}
+
+		logger.Info("Expired item processed", "tenant", tenant.Id, "account", item.Key.Account, "id", item.Id,
+			"presentation", item.Presentation, "expiry", item.Expiry, "action", s.policy)
+		processed++
+	}
+
+	logger.Info("Expiry sweep finished", "tenant", tenant.Id, "action", s.policy, "items", processed)
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/dcql"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+/*
+Usage: Evaluates a DCQL query on the credentials or presentations of the account. In remote mode the query can not
+be evaluated by the storage, so all items are returned together with a receipt like for presentation definitions.
+*/
+
+func QueryCredentials(ctx context.Context, authModel model.AuthModel, env *common.Environment, query *dcql.Query, filter metadata.Query, includeExpired bool, presentation bool) (*model.GetCredentialModel, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if authModel.ContentType == common.EncryptedContentType {
+		receipt := handlers.CreateTransactionReciept(ctx, authModel, env)
+
+		if receipt == nil {
+			return nil, errors.New("Receipt Failure")
+		}
+
+		credentials, index, err := LoadCredentials(ctx, authModel, env, presentation, filter, includeExpired)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &model.GetCredentialModel{
+			Credentials: DecryptItems(ctx, authModel, env, credentials),
+			Receipt:     receipt.Receipt,
+			Expired:     ExpiredIds(credentials, index),
+		}, nil
+	}
+
+	credentials, index, err := LoadCredentials(ctx, authModel, env, presentation, filter, includeExpired)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := DecryptItems(ctx, authModel, env, credentials)
+	matches := query.Evaluate(decodeCredentials(env, decrypted))
+
+	matched := make(map[string]interface{})
+	for _, match := range matches {
+		for id := range match.Credentials {
+			matched[id] = decrypted[id]
+		}
+	}
+
+	return &model.GetCredentialModel{
+		Credentials: make(map[string]interface{}),
+		Matches:     matches,
+		Expired:     ExpiredIds(credentials, index),
+		Status:      CredentialStatus(ctx, authModel, env, matched),
+	}, nil
+}
+
+/*
+Usage: Checks the status lists of the decrypted credentials. Returns nil when status checking is disabled or the
+items are encrypted by the client, so that the storage can not read them.
+*/
+
+func CredentialStatus(ctx context.Context, authModel model.AuthModel, env *common.Environment, credentials map[string]interface{}) map[string]string {
+	checker := env.GetStatusChecker()
+
+	if checker == nil || authModel.ContentType != common.NormalContentType || len(credentials) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(credentials))
+
+	for id, credential := range credentials {
+		serialized, _ := credential.(string)
+		result[id] = checker.Check(ctx, []byte(serialized))
+	}
+
+	return result
+}
+
+// decodeCredentials decodes the claims of the credentials. Credentials which can not be decoded, like mdoc, are skipped.
+func decodeCredentials(env *common.Environment, credentials map[string]interface{}) map[string]dcql.Credential {
+	logger := env.GetLogger()
+	decoded := make(map[string]dcql.Credential, len(credentials))
+
+	for id, credential := range credentials {
+		serialized, _ := credential.(string)
+		format, claims, err := metadata.Claims([]byte(serialized))
+
+		if err != nil {
+			logger.Info("Credential skipped in query", "id", id, "error", err.Error())
+			continue
+		}
+
+		decoded[id] = dcql.Credential{Format: format, Claims: claims, Data: credential}
+	}
+
+	return decoded
+}
+
+/*
+Usage: Loads the encrypted items and drops those not matching the metadata query and, unless included, the expired
+ones before anything is decrypted. Returns the metadata of the account items along.
+*/
+
+func LoadCredentials(ctx context.Context, authModel model.AuthModel, env *common.Environment, presentation bool, query metadata.Query, includeExpired bool) (map[string]string, map[string]repository.ItemMetadata, error) {
+	items, err := env.GetRepository().LoadItems(ctx, env.GetAccountKey(authModel), presentation)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index, err := env.GetRepository().LoadMetadata(ctx, env.GetAccountKey(authModel), presentation)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	FilterItems(env, items, index, query, includeExpired)
+
+	return items, index, nil
+}
+
+// FilterItems removes the items not matching the metadata query and, unless included, the expired ones.
+func FilterItems(env *common.Environment, items map[string]string, index map[string]repository.ItemMetadata, query metadata.Query, includeExpired bool) {
+	now := time.Now()
+
+	for id := range items {
+		if (!query.Empty() && !env.GetIndexer().Matches(index[id].Index, query)) || (!includeExpired && index[id].Expired(now)) {
+			delete(items, id)
+		}
+	}
+}
+
+// ExpiredIds returns the sorted ids of the expired items.
+func ExpiredIds(items map[string]string, index map[string]repository.ItemMetadata) []string {
+	now := time.Now()
+	expired := make([]string, 0)
+
+	for id := range items {
+		if index[id].Expired(now) {
+			expired = append(expired, id)
+		}
+	}
+
+	sort.Strings(expired)
+	return expired
+}
+
+/*
+Usage: Removes the encryption of the storage from an item. Items of the device which are stored end-to-end are
+returned as they are, their JWE is recognized by parsing, which the ciphertext of the storage never passes.
+*/
+
+func DecryptItem(ctx context.Context, authModel model.AuthModel, env *common.Environment, item string) ([]byte, error) {
+	cipher, err := b64.RawStdEncoding.DecodeString(item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if authModel.ContentType == common.EncryptedContentType {
+		if _, err := jwe.Parse(cipher); err == nil {
+			return cipher, nil
+		}
+	}
+
+	return crypto.DecryptMessage(authModel.Account, cipher, env.GetCryptoNamespace(authModel.TenantId), common.StorageCryptoContext, ctx, env.GetCryptoProvider())
+}
+
+// DecryptItems skips items which can not be decrypted, so that a single broken record does not block the whole wallet.
+func DecryptItems(ctx context.Context, authModel model.AuthModel, env *common.Environment, items map[string]string) map[string]interface{} {
+	logger := env.GetLogger()
+	result := make(map[string]interface{}, len(items))
+
+	for k, v := range items {
+		msg, err := DecryptItem(ctx, authModel, env, v)
+
+		if err != nil {
+			logger.Error(err, "")
+			continue
+		}
+
+		result[k] = string(msg)
+	}
+
+	return result
+}
@@ -0,0 +1,256 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxListSize limits the size of a fetched status list, lists of millions of entries are far below.
+const maxListSize = 16 << 20
+
+// failureTtl is how long a failed fetch is remembered, so that an unreachable list does not delay every retrieval.
+const failureTtl = 30 * time.Second
+
+// maxCachedLists limits the cached lists, their uris are taken from stored credentials.
+const maxCachedLists = 512
+
+// Fetcher loads the serialized status list credential or token of an uri.
+type Fetcher interface {
+	Fetch(ctx context.Context, uri string) ([]byte, error)
+}
+
+/*
+HttpFetcher fetches the status lists from the issuers. The uris are taken from stored credentials, so with allowed
+hosts only these hosts are requested, without any host is requested but not on loopback, private or link-local
+addresses.
+*/
+type HttpFetcher struct {
+	client       *http.Client
+	allowedHosts map[string]bool
+}
+
+func NewHttpFetcher(timeout time.Duration, allowedHosts []string) *HttpFetcher {
+	f := &HttpFetcher{allowedHosts: make(map[string]bool)}
+
+	for _, host := range allowedHosts {
+		if host = strings.TrimSpace(host); host != "" {
+			f.allowedHosts[strings.ToLower(host)] = true
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if len(f.allowedHosts) == 0 {
+		// a proxy would be the address checked
+		transport.Proxy = nil
+		// checked on the resolved address, so that a host name can not be pointed at an internal one
+		dialer.Control = func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || internalAddress(ip) {
+				return fmt.Errorf("status list address %s is not public", host)
+			}
+
+			return nil
+		}
+	}
+
+	transport.DialContext = dialer.DialContext
+
+	f.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("too many redirects")
+			}
+			return f.checkUri(request.URL)
+		},
+	}
+
+	return f
+}
+
+func internalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+func (f *HttpFetcher) checkUri(parsed *url.URL) error {
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("status list uri %s is not a http uri", parsed)
+	}
+
+	if len(f.allowedHosts) > 0 && !f.allowedHosts[strings.ToLower(parsed.Hostname())] {
+		return fmt.Errorf("status list host %s is not allowed", parsed.Hostname())
+	}
+
+	return nil
+}
+
+func (f *HttpFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("status list uri %s is not a http uri", uri)
+	}
+
+	if err := f.checkUri(parsed); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", "application/statuslist+jwt, application/vc+jwt, application/vc+ld+json, application/json")
+
+	response, err := f.client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status list %s returned %d", uri, response.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, maxListSize))
+}
+
+/*
+FileFetcher serves status lists out of a local directory, the file name is the last path segment of the uri. It
+stands in for the issuers in tests and offline setups.
+*/
+type FileFetcher struct {
+	dir string
+}
+
+func NewFileFetcher(dir string) *FileFetcher {
+	return &FileFetcher{dir: dir}
+}
+
+func (f *FileFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(parsed.Path)
+
+	if name == "/" || name == "." || name == ".." {
+		return nil, fmt.Errorf("status list uri %s has no file name", uri)
+	}
+
+	return os.ReadFile(filepath.Join(f.dir, filepath.Base(name)))
+}
+
+type cacheEntry struct {
+	list    *statusList
+	err     error
+	expires time.Time
+}
+
+/*
+cache keeps the decoded status lists for the ttl, so that a list is fetched once for all credentials referencing it.
+Failures are kept for the failureTtl at most. At most maxCachedLists are kept, so that credentials with ever new status
+list uris can not grow the cache.
+*/
+type cache struct {
+	fetcher Fetcher
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newCache(fetcher Fetcher, ttl time.Duration) *cache {
+	return &cache{fetcher: fetcher, ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+func (c *cache) list(ctx context.Context, uri string) (*statusList, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[uri]
+	c.mutex.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.list, entry.err
+	}
+
+	list, err := c.fetch(ctx, uri)
+
+	if err != nil && ctx.Err() != nil {
+		// the request was cancelled, not the list failed
+		return nil, err
+	}
+
+	ttl := c.ttl
+	if err != nil && ttl > failureTtl {
+		ttl = failureTtl
+	}
+
+	c.mutex.Lock()
+	c.store(uri, cacheEntry{list: list, err: err, expires: time.Now().Add(ttl)})
+	c.mutex.Unlock()
+
+	return list, err
+}
+
+// store caches the entry, a full cache drops its expired entries first and else the entry which expires next.
+func (c *cache) store(uri string, entry cacheEntry) {
+	if _, ok := c.entries[uri]; !ok && len(c.entries) >= maxCachedLists {
+		now := time.Now()
+		next := ""
+
+		for cachedUri, cached := range c.entries {
+			if now.After(cached.expires) {
+				delete(c.entries, cachedUri)
+			} else if next == "" || cached.expires.Before(c.entries[next].expires) {
+				next = cachedUri
+			}
+		}
+
+		if len(c.entries) >= maxCachedLists {
+			delete(c.entries, next)
+		}
+	}
+
+	c.entries[uri] = entry
+}
+
+func (c *cache) fetch(ctx context.Context, uri string) (*statusList, error) {
+	data, err := c.fetcher.Fetch(ctx, uri)
+
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("status list %s could not be fetched", uri), err)
+	}
+
+	list, err := decodeList(data)
+
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("status list %s could not be decoded", uri), err)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,267 @@
+package status
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	b64 "encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
+)
+
+const (
+	Valid     = "valid"
+	Revoked   = "revoked"
+	Suspended = "suspended"
+	// Unknown is reported when the status list could not be fetched or the entry is malformed.
+	Unknown = "unknown"
+)
+
+// statusList is a decoded list of status values of a fixed bit size.
+type statusList struct {
+	bits int
+	data []byte
+	// lsbFirst orders the entries from the least significant bit of a byte, like the token status list does.
+	lsbFirst bool
+}
+
+func (l *statusList) value(index int) (int, error) {
+	bit := index * l.bits
+
+	if index < 0 || bit/8 >= len(l.data) {
+		return 0, errors.New("status list index out of range")
+	}
+
+	shift := bit % 8
+	if !l.lsbFirst {
+		shift = 8 - l.bits - shift
+	}
+
+	return int(l.data[bit/8]>>shift) & (1<<l.bits - 1), nil
+}
+
+/*
+Checker resolves the status of credentials by StatusList2021, BitstringStatusList and Token Status List entries.
+The signatures of the status lists are not verified.
+*/
+type Checker struct {
+	cache *cache
+}
+
+func NewChecker(fetcher Fetcher, ttl time.Duration) *Checker {
+	return &Checker{cache: newCache(fetcher, ttl)}
+}
+
+/*
+Usage: Returns the status of a plaintext credential. Credentials without status entry are valid. A revocation wins
+over a suspension, credentials which can not be decoded or checked are unknown.
+*/
+
+func (c *Checker) Check(ctx context.Context, msg []byte) string {
+	_, claims, err := metadata.Claims(msg)
+
+	if err != nil {
+		return Unknown
+	}
+
+	result := Valid
+
+	if token, ok := claims["status"].(map[string]interface{}); ok {
+		result = merge(result, c.checkToken(ctx, token))
+	}
+
+	for _, entry := range entries(claims["credentialStatus"]) {
+		result = merge(result, c.checkEntry(ctx, entry))
+	}
+
+	return result
+}
+
+func merge(current string, next string) string {
+	for _, s := range []string{Revoked, Suspended, Unknown} {
+		if current == s || next == s {
+			return s
+		}
+	}
+	return Valid
+}
+
+func entries(value interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		list := make([]map[string]interface{}, 0, len(v))
+		for _, e := range v {
+			if entry, ok := e.(map[string]interface{}); ok {
+				list = append(list, entry)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// checkToken evaluates the status claim of a JWT or SD-JWT, which references a Token Status List.
+func (c *Checker) checkToken(ctx context.Context, token map[string]interface{}) string {
+	reference, ok := token["status_list"].(map[string]interface{})
+
+	if !ok {
+		return Valid
+	}
+
+	uri, _ := reference["uri"].(string)
+	index, ok := reference["idx"].(float64)
+
+	if uri == "" || !ok {
+		return Unknown
+	}
+
+	list, err := c.cache.list(ctx, uri)
+
+	if err != nil || !list.lsbFirst {
+		return Unknown
+	}
+
+	value, err := list.value(int(index))
+
+	switch {
+	case err != nil:
+		return Unknown
+	case value == 0:
+		return Valid
+	case value == 1:
+		return Revoked
+	case value == 2:
+		return Suspended
+	}
+
+	return Unknown
+}
+
+// checkEntry evaluates a credentialStatus entry of a W3C credential.
+func (c *Checker) checkEntry(ctx context.Context, entry map[string]interface{}) string {
+	entryType, _ := entry["type"].(string)
+
+	if entryType != "StatusList2021Entry" && entryType != "BitstringStatusListEntry" {
+		return Valid
+	}
+
+	uri, _ := entry["statusListCredential"].(string)
+	purpose, _ := entry["statusPurpose"].(string)
+	index, err := strconv.Atoi(stringValue(entry["statusListIndex"]))
+
+	if uri == "" || err != nil {
+		return Unknown
+	}
+
+	list, err := c.cache.list(ctx, uri)
+
+	if err != nil || list.lsbFirst {
+		return Unknown
+	}
+
+	value, err := list.value(index)
+
+	if err != nil {
+		return Unknown
+	}
+
+	if value == 0 {
+		return Valid
+	}
+
+	switch purpose {
+	case "revocation":
+		return Revoked
+	case "suspension":
+		return Suspended
+	}
+
+	return Unknown
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// decodeList reads a status list credential (JSON-LD or JWT) or a status list token.
+func decodeList(data []byte) (*statusList, error) {
+	_, claims, err := metadata.Claims(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := claims["status_list"].(map[string]interface{}); ok {
+		bits, _ := token["bits"].(float64)
+		encoded, _ := token["lst"].(string)
+
+		if bits != 1 && bits != 2 && bits != 4 && bits != 8 {
+			return nil, errors.New("status list token has invalid bits")
+		}
+
+		compressed, err := decodeBase64(encoded)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(compressed))
+
+		if err != nil {
+			return nil, err
+		}
+
+		list, err := io.ReadAll(io.LimitReader(reader, maxListSize))
+		return &statusList{bits: int(bits), data: list, lsbFirst: true}, err
+	}
+
+	subject, _ := claims["credentialSubject"].(map[string]interface{})
+	encoded, _ := subject["encodedList"].(string)
+
+	if encoded == "" {
+		return nil, errors.New("status list credential without encodedList")
+	}
+
+	// the bitstring status list carries a multibase prefix
+	if subjectType, _ := subject["type"].(string); subjectType == "BitstringStatusList" {
+		encoded = strings.TrimPrefix(encoded, "u")
+	}
+
+	compressed, err := decodeBase64(encoded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := io.ReadAll(io.LimitReader(reader, maxListSize))
+	return &statusList{bits: 1, data: list}, err
+}
+
+func decodeBase64(encoded string) ([]byte, error) {
+	for _, encoding := range []*b64.Encoding{b64.RawURLEncoding, b64.URLEncoding, b64.RawStdEncoding, b64.StdEncoding} {
+		if data, err := encoding.DecodeString(encoded); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("status list is not base64 encoded")
+}
@@ -0,0 +1,163 @@
+package status
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func jwt(payload string) string {
+	return b64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." +
+		b64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func encodedList(list []byte, compressor func(io.Writer) io.WriteCloser) string {
+	var buffer bytes.Buffer
+	writer := compressor(&buffer)
+	writer.Write(list)
+	writer.Close()
+	return b64.RawURLEncoding.EncodeToString(buffer.Bytes())
+}
+
+func gzipList(list []byte) string {
+	return encodedList(list, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+}
+
+func zlibList(list []byte) string {
+	return encodedList(list, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+}
+
+func w3cCredential(entryType string, purpose string, uri string, index string) []byte {
+	return []byte(`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"credentialStatus":{"type":"` +
+		entryType + `","statusPurpose":"` + purpose + `","statusListIndex":"` + index + `","statusListCredential":"` + uri + `"}}`)
+}
+
+func TestStatusList2021OverHttp(t *testing.T) {
+	hits := 0
+	// index 3 is set, the first bit of a byte is the most significant one
+	list := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential","StatusList2021Credential"],` +
+		`"credentialSubject":{"type":"StatusList2021","statusPurpose":"revocation","encodedList":"` + gzipList([]byte{0x10, 0}) + `"}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/lists/1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(list))
+	}))
+	defer server.Close()
+
+	checker := NewChecker(NewHttpFetcher(time.Second, []string{"127.0.0.1"}), time.Minute)
+	ctx := context.Background()
+
+	if s := checker.Check(ctx, w3cCredential("StatusList2021Entry", "revocation", server.URL+"/lists/1", "3")); s != Revoked {
+		t.Error("credential should be revoked", s)
+	}
+
+	if s := checker.Check(ctx, w3cCredential("StatusList2021Entry", "revocation", server.URL+"/lists/1", "4")); s != Valid {
+		t.Error("credential should be valid", s)
+	}
+
+	if hits != 1 {
+		t.Error("status list should be cached", hits)
+	}
+
+	if s := checker.Check(ctx, w3cCredential("StatusList2021Entry", "revocation", server.URL+"/lists/2", "3")); s != Unknown {
+		t.Error("missing list should be unknown", s)
+	}
+
+	checker.Check(ctx, w3cCredential("StatusList2021Entry", "revocation", server.URL+"/lists/2", "4"))
+	if hits != 2 {
+		t.Error("failed fetch should be cached", hits)
+	}
+
+	if s := checker.Check(ctx, []byte(`{"@context":[],"type":["VerifiableCredential"]}`)); s != Valid {
+		t.Error("credential without status should be valid", s)
+	}
+}
+
+func TestInternalAddressRefused(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	if _, err := NewHttpFetcher(time.Second, nil).Fetch(context.Background(), server.URL+"/lists/1"); err == nil {
+		t.Error("loopback address should be refused")
+	}
+
+	if _, err := NewHttpFetcher(time.Second, []string{"status.example.com"}).Fetch(context.Background(), server.URL+"/lists/1"); err == nil {
+		t.Error("host which is not allowed should be refused")
+	}
+
+	if hits != 0 {
+		t.Error("server should not be requested", hits)
+	}
+}
+
+func TestCacheIsBounded(t *testing.T) {
+	cache := newCache(NewFileFetcher(t.TempDir()), time.Minute)
+
+	for i := 0; i < 2*maxCachedLists; i++ {
+		cache.list(context.Background(), fmt.Sprintf("https://status.example.com/lists/%d", i))
+	}
+
+	if len(cache.entries) != maxCachedLists {
+		t.Error("cache should be limited", len(cache.entries))
+	}
+
+	cache.entries["https://status.example.com/lists/0"] = cacheEntry{expires: time.Now().Add(-time.Second)}
+	cache.list(context.Background(), "https://status.example.com/lists/new")
+
+	if _, ok := cache.entries["https://status.example.com/lists/0"]; ok || len(cache.entries) != maxCachedLists {
+		t.Error("expired entry should be dropped first", len(cache.entries))
+	}
+}
+
+func TestTokenStatusList(t *testing.T) {
+	// two bits per entry starting at the least significant bits, index 1 is suspended and index 2 is revoked
+	token := jwt(`{"sub":"https://example.com/lists/token","status_list":{"bits":2,"lst":"` + zlibList([]byte{0x18}) + `"}}`)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "token"), []byte(token), 0600)
+
+	checker := NewChecker(NewFileFetcher(dir), time.Minute)
+
+	for index, expected := range map[string]string{"0": Valid, "1": Suspended, "2": Revoked, "9": Unknown} {
+		credential := jwt(`{"iss":"did:example:issuer","vct":"pid","status":{"status_list":{"idx":`+index+`,"uri":"https://example.com/lists/token"}}}`) + "~"
+
+		if s := checker.Check(context.Background(), []byte(credential)); s != expected {
+			t.Error("status is wrong", index, s)
+		}
+	}
+}
+
+func TestBitstringStatusList(t *testing.T) {
+	list := `{"@context":["https://www.w3.org/ns/credentials/v2"],"type":["VerifiableCredential","BitstringStatusListCredential"],` +
+		`"credentialSubject":{"type":"BitstringStatusList","statusPurpose":"suspension","encodedList":"u` + gzipList([]byte{0x80}) + `"}}`
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "suspension"), []byte(list), 0600)
+
+	checker := NewChecker(NewFileFetcher(dir), time.Minute)
+
+	if s := checker.Check(context.Background(), w3cCredential("BitstringStatusListEntry", "suspension", "https://example.com/suspension", "0")); s != Suspended {
+		t.Error("credential should be suspended", s)
+	}
+
+	if s := checker.Check(context.Background(), w3cCredential("BitstringStatusListEntry", "suspension", "https://example.com/../suspension", "1")); s != Valid {
+		t.Error("credential should be valid", s)
+	}
+}
@@ -0,0 +1,164 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+)
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// Tenant is a tenant which may use the service, with the keyspace its accounts are stored in.
+type Tenant struct {
+	Id       string
+	Keyspace string
+}
+
+// Limits of the cached registry lookups, the ids of unknown tenants come from unauthenticated requests.
+const (
+	maxKnownTenants   = 1024
+	maxUnknownTenants = 256
+)
+
+type cached struct {
+	tenant  *Tenant
+	expires time.Time
+}
+
+/*
+Resolver decides which tenants may use the service. Tenants are either configured with their keyspace or, when the
+registry is enabled, recorded by the tenant administration, then their keyspace is their name. Lookups in the
+registry are cached for the ttl. Unknown tenants are cached as well, but only up to maxUnknownTenants, so that
+requests with ever new tenant ids can not grow the cache. Such ids still cost a lookup in the registry each.
+*/
+type Resolver struct {
+	tenants  map[string]Tenant
+	registry bool
+	ttl      time.Duration
+	mutex    sync.Mutex
+	known    map[string]cached
+	unknown  map[string]cached
+}
+
+// NewResolver validates the keyspaces of the configured tenants, which are interpolated into queries.
+func NewResolver(keyspaces map[string]string, registry bool, ttl time.Duration) (*Resolver, error) {
+	tenants := make(map[string]Tenant, len(keyspaces))
+
+	for id, keyspace := range keyspaces {
+		if !repository.ValidTenantName(keyspace) {
+			return nil, fmt.Errorf("invalid keyspace %q of tenant %q", keyspace, id)
+		}
+		tenants[id] = Tenant{Id: id, Keyspace: keyspace}
+	}
+
+	return &Resolver{
+		tenants:  tenants,
+		registry: registry,
+		ttl:      ttl,
+		known:    make(map[string]cached),
+		unknown:  make(map[string]cached),
+	}, nil
+}
+
+// Configured returns the configured tenants ordered by id, tenants of the registry are not included.
+func (r *Resolver) Configured() []Tenant {
+	if r == nil {
+		return nil
+	}
+
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Id < tenants[j].Id })
+	return tenants
+}
+
+// Resolve returns the tenant of the id or ErrUnknownTenant when it may not use the service. A nil resolver knows no tenant.
+func (r *Resolver) Resolve(ctx context.Context, repo repository.Repository, id string) (Tenant, error) {
+	if r == nil {
+		return Tenant{}, ErrUnknownTenant
+	}
+
+	if tenant, ok := r.tenants[id]; ok {
+		return tenant, nil
+	}
+
+	if !r.registry || !repository.ValidTenantName(id) || repo == nil {
+		return Tenant{}, ErrUnknownTenant
+	}
+
+	r.mutex.Lock()
+	entry, ok := r.known[id]
+	if !ok {
+		entry, ok = r.unknown[id]
+	}
+	r.mutex.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		recorded, err := repo.LoadTenant(ctx, id)
+
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return Tenant{}, err
+		}
+
+		entry = cached{expires: time.Now().Add(r.ttl)}
+
+		r.mutex.Lock()
+		if recorded != nil {
+			entry.tenant = &Tenant{Id: id, Keyspace: recorded.Name}
+			delete(r.unknown, id)
+			store(r.known, maxKnownTenants, id, entry)
+		} else {
+			delete(r.known, id)
+			store(r.unknown, maxUnknownTenants, id, entry)
+		}
+		r.mutex.Unlock()
+	}
+
+	if entry.tenant == nil {
+		return Tenant{}, ErrUnknownTenant
+	}
+
+	return *entry.tenant, nil
+}
+
+// Forget drops the cached lookup of a tenant, after it was created or deleted.
+func (r *Resolver) Forget(id string) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.known, id)
+	delete(r.unknown, id)
+}
+
+// store caches the entry, a full cache drops its expired entries first and else the entry which expires next.
+func store(cache map[string]cached, limit int, id string, entry cached) {
+	if _, ok := cache[id]; !ok && len(cache) >= limit {
+		now := time.Now()
+		next := ""
+
+		for cachedId, cachedEntry := range cache {
+			if now.After(cachedEntry.expires) {
+				delete(cache, cachedId)
+			} else if next == "" || cachedEntry.expires.Before(cache[next].expires) {
+				next = cachedId
+			}
+		}
+
+		if len(cache) >= limit {
+			delete(cache, next)
+		}
+	}
+
+	cache[id] = entry
+}
@@ -0,0 +1,91 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+)
+
+func TestResolver(t *testing.T) {
+	if _, err := NewResolver(map[string]string{"customer": "space; DROP KEYSPACE x"}, false, time.Minute); err == nil {
+		t.Error("invalid keyspace should be rejected")
+	}
+
+	var unset *Resolver
+	if _, err := unset.Resolve(context.Background(), nil, "customer"); !errors.Is(err, ErrUnknownTenant) {
+		t.Error("unset resolver should know no tenant", err)
+	}
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	repo.CreateTenant(ctx, repository.Tenant{Name: "acme", Replication: repository.Replication{Class: repository.SimpleStrategy, Factor: 1}})
+
+	resolver, err := NewResolver(map[string]string{"customer": "space"}, false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tenant, err := resolver.Resolve(ctx, repo, "customer"); err != nil || tenant.Keyspace != "space" {
+		t.Error("configured tenant should be resolved", tenant, err)
+	}
+
+	if _, err := resolver.Resolve(ctx, repo, "acme"); !errors.Is(err, ErrUnknownTenant) {
+		t.Error("registry should be disabled", err)
+	}
+
+	resolver, _ = NewResolver(nil, true, 0)
+
+	if tenant, err := resolver.Resolve(ctx, repo, "acme"); err != nil || tenant.Keyspace != "acme" {
+		t.Error("provisioned tenant should be resolved", tenant, err)
+	}
+
+	repo.DeleteTenant(ctx, "acme")
+
+	if _, err := resolver.Resolve(ctx, repo, "acme"); !errors.Is(err, ErrUnknownTenant) {
+		t.Error("deleted tenant should be unknown after the ttl", err)
+	}
+}
+
+func TestResolverCacheIsBounded(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	repo.CreateTenant(ctx, repository.Tenant{Name: "acme", Replication: repository.Replication{Class: repository.SimpleStrategy, Factor: 1}})
+
+	resolver, _ := NewResolver(nil, true, time.Minute)
+
+	if _, err := resolver.Resolve(ctx, repo, "acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2*maxUnknownTenants; i++ {
+		if _, err := resolver.Resolve(ctx, repo, fmt.Sprintf("unknown%d", i)); !errors.Is(err, ErrUnknownTenant) {
+			t.Fatal("tenant should be unknown", err)
+		}
+	}
+
+	if len(resolver.unknown) != maxUnknownTenants || len(resolver.known) != 1 {
+		t.Error("unknown tenants should be limited without dropping known ones", len(resolver.unknown), len(resolver.known))
+	}
+
+	cache := map[string]cached{
+		"expired": {expires: time.Now().Add(-time.Second)},
+		"next":    {expires: time.Now().Add(time.Second)},
+		"later":   {expires: time.Now().Add(time.Minute)},
+	}
+
+	store(cache, 3, "new", cached{expires: time.Now().Add(time.Minute)})
+
+	if _, ok := cache["expired"]; ok || len(cache) != 3 {
+		t.Error("expired entry should be dropped first", cache)
+	}
+
+	store(cache, 3, "newer", cached{expires: time.Now().Add(time.Minute)})
+
+	if _, ok := cache["next"]; ok || len(cache) != 3 {
+		t.Error("entry which expires next should be dropped", cache)
+	}
+}
@@ -0,0 +1,164 @@
+package tenancy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Modes a tenant can be enabled for.
+const (
+	DirectMode = "DIRECT"
+	RemoteMode = "REMOTE"
+)
+
+// Settings overrides the global configuration for a tenant, empty fields keep the global value.
+type Settings struct {
+	Country         string   `yaml:"country"`
+	Region          string   `yaml:"region"`
+	CryptoNamespace string   `yaml:"cryptoNamespace"`
+	SignKey         string   `yaml:"signKey"`
+	Modes           []string `yaml:"modes"`
+	// EndToEnd switches the end-to-end storage of REMOTE items on or off, unset keeps the global value.
+	EndToEnd *bool `yaml:"endToEnd"`
+}
+
+type settingsFile struct {
+	Tenants map[string]Settings `yaml:"tenants"`
+}
+
+/*
+Overrides holds the settings of the tenants from a YAML file:
+
+	tenants:
+	  customer:
+	    cryptoNamespace: customer
+	    signKey: signer
+	    region: EU
+	    modes: [DIRECT]
+	    endToEnd: true
+
+The file is read again by Reload and replaces the settings when it changed and is valid, so that a broken file keeps
+the previous settings.
+*/
+type Overrides struct {
+	path    string
+	mutex   sync.RWMutex
+	content []byte
+	tenants map[string]Settings
+}
+
+// LoadOverrides reads the settings file, which must exist and be valid at startup.
+func LoadOverrides(path string) (*Overrides, error) {
+	overrides := &Overrides{path: path, tenants: make(map[string]Settings)}
+
+	if _, err := overrides.Reload(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// Get returns the settings of a tenant, empty ones for tenants without overrides. Nil overrides have no settings.
+func (o *Overrides) Get(tenantId string) Settings {
+	if o == nil {
+		return Settings{}
+	}
+
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	return o.tenants[tenantId]
+}
+
+// Tenants returns the settings of all tenants with overrides.
+func (o *Overrides) Tenants() map[string]Settings {
+	if o == nil {
+		return nil
+	}
+
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	tenants := make(map[string]Settings, len(o.tenants))
+	for id, settings := range o.tenants {
+		tenants[id] = settings
+	}
+	return tenants
+}
+
+// Reload reads the file again and reports whether the settings changed.
+func (o *Overrides) Reload() (bool, error) {
+	content, err := os.ReadFile(o.path)
+
+	if err != nil {
+		return false, err
+	}
+
+	o.mutex.RLock()
+	unchanged := o.content != nil && bytes.Equal(content, o.content)
+	o.mutex.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	var file settingsFile
+
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return false, fmt.Errorf("invalid tenant settings %s: %w", o.path, err)
+	}
+
+	for id, settings := range file.Tenants {
+		for _, mode := range settings.Modes {
+			if mode != DirectMode && mode != RemoteMode {
+				return false, fmt.Errorf("invalid tenant settings %s: unknown mode %q of tenant %q", o.path, mode, id)
+			}
+		}
+	}
+
+	if file.Tenants == nil {
+		file.Tenants = make(map[string]Settings)
+	}
+
+	o.mutex.Lock()
+	o.content = content
+	o.tenants = file.Tenants
+	o.mutex.Unlock()
+
+	return true, nil
+}
+
+/*
+Watch reloads the file every interval until the context is done. Changed settings are passed to changed, errors to
+failed, the previous settings stay in use then.
+*/
+func (o *Overrides) Watch(ctx context.Context, interval time.Duration, changed func(), failed func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := o.Reload()
+
+			if err != nil {
+				failed(err)
+			} else if reloaded {
+				changed()
+			}
+		}
+	}
+}
+
+// ModeEnabled reports whether the tenant may use the mode, tenants without modes may use all.
+func (s Settings) ModeEnabled(mode string) bool {
+	return len(s.Modes) == 0 || slices.Contains(s.Modes, mode)
+}
@@ -0,0 +1,54 @@
+package tenancy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.yaml")
+
+	if _, err := LoadOverrides(path); err == nil {
+		t.Error("missing file should be rejected at startup")
+	}
+
+	os.WriteFile(path, []byte("tenants:\n  customer:\n    cryptoNamespace: customer\n    region: EU\n    modes: [DIRECT]\n"), 0600)
+
+	overrides, err := LoadOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := overrides.Get("customer")
+
+	if settings.CryptoNamespace != "customer" || settings.Region != "EU" || !settings.ModeEnabled(DirectMode) || settings.ModeEnabled(RemoteMode) {
+		t.Error("settings are wrong", settings)
+	}
+
+	if other := overrides.Get("other"); other.CryptoNamespace != "" || !other.ModeEnabled(RemoteMode) {
+		t.Error("tenants without settings should keep the global ones", other)
+	}
+
+	if changed, err := overrides.Reload(); changed || err != nil {
+		t.Error("unchanged file should not be reloaded", changed, err)
+	}
+
+	os.WriteFile(path, []byte("tenants:\n  customer:\n    modes: [LOCAL]\n"), 0600)
+
+	if _, err := overrides.Reload(); err == nil || overrides.Get("customer").CryptoNamespace != "customer" {
+		t.Error("invalid file should keep the previous settings", err)
+	}
+
+	os.WriteFile(path, []byte("tenants:\n  customer:\n    signKey: other\n    endToEnd: false\n"), 0600)
+
+	if changed, err := overrides.Reload(); !changed || err != nil || overrides.Get("customer").SignKey != "other" || overrides.Get("customer").CryptoNamespace != "" ||
+		overrides.Get("customer").EndToEnd == nil || *overrides.Get("customer").EndToEnd {
+		t.Error("changed file should replace the settings", changed, err, overrides.Get("customer"))
+	}
+
+	var unset *Overrides
+	if settings := unset.Get("customer"); !settings.ModeEnabled(RemoteMode) || unset.Tenants() != nil {
+		t.Error("unset overrides should have no settings", settings)
+	}
+}
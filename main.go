@@ -2,14 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 
 	"github.com/eclipse-xfsc/credential-storage-service/internal/api"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/connection"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/middleware"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/status"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
 	core "github.com/eclipse-xfsc/crypto-provider-core"
 
 	"os"
@@ -22,6 +34,8 @@ import (
 	serverPkg "github.com/eclipse-xfsc/microservice-core-go/pkg/server"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	swaggerfiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 var env *common.Environment
@@ -44,12 +58,68 @@ func init() {
 	env.SetLogger(*logger)
 	env.SetCryptoNamespace(currentConf.Crypto.Namespace)
 	env.SetCryptoSignKey(currentConf.Crypto.SignKey)
+	env.SetEndToEnd(currentConf.Crypto.EndToEnd)
 	env.SetMode(currentConf.Mode)
 	env.SetUnitTestModeOn(currentConf.UnitTestModeOn)
+
+	indexer, err := metadata.NewIndexer(currentConf.Metadata.Mode, currentConf.Metadata.Salt)
+	if err != nil {
+		log.Fatalf("failed to init metadata index: %t", err)
+	}
+
+	env.SetIndexer(indexer)
+
+	keyspaces := currentConf.Tenants.Keyspaces
+	if len(keyspaces) == 0 && currentConf.Cassandra.KeySpace != "" {
+		keyspaces = map[string]string{currentConf.Cassandra.KeySpace: currentConf.Cassandra.KeySpace}
+	}
+
+	resolver, err := tenancy.NewResolver(keyspaces, currentConf.Tenants.Registry, currentConf.Tenants.CacheTtl)
+	if err != nil {
+		log.Fatalf("failed to init tenants: %t", err)
+	}
+
+	env.SetTenantResolver(resolver)
+
+	if currentConf.Tenants.Settings != "" {
+		overrides, err := tenancy.LoadOverrides(currentConf.Tenants.Settings)
+		if err != nil {
+			log.Fatalf("failed to load tenant settings: %t", err)
+		}
+
+		env.SetTenantOverrides(overrides)
+	}
+
+	if currentConf.Status.Enabled {
+		var fetcher status.Fetcher = status.NewHttpFetcher(currentConf.Status.Timeout, currentConf.Status.AllowedHosts)
+		if currentConf.Status.LocalDir != "" {
+			fetcher = status.NewFileFetcher(currentConf.Status.LocalDir)
+		}
+		env.SetStatusChecker(status.NewChecker(fetcher, currentConf.Status.CacheTtl))
+	}
+
 	env.SetHealthy(true)
 }
 
 func startDbConnection() error {
+	if config.CurrentStorageConfig.Profile == "DEBUG:MEMORY" {
+		env.SetRepository(repository.NewMemoryRepository())
+		log.Info("In memory storage used, data is not persisted")
+		return nil
+	}
+
+	if config.CurrentStorageConfig.Backend == "SQL" {
+		sqlConfig := config.CurrentStorageConfig.Sql
+		repo, err := repository.NewSqlRepository(sqlConfig.Driver, sqlConfig.Dsn)
+		if err != nil {
+			log.Fatal("Database could not be connected")
+			return err
+		}
+		env.SetRepository(repo)
+		log.Info("Database connected")
+		return nil
+	}
+
 	// Establish connections
 	dbSession, err := connection.Connection()
 	if err != nil {
@@ -62,77 +132,318 @@ func startDbConnection() error {
 	return nil
 }
 
-func refineRoutes(rg *gin.RouterGroup) {
+/*
+Usage: Moves the items of the given tenants, or of the configured keyspace, into the credential_items table and
+their devices into the account_devices table. With the SQL backend the devices of all tenants are moved out of the
+accounts table, the items are stored in their table already.
+*/
+
+func migrate(tenants []string) error {
+	if config.CurrentStorageConfig.Backend == "SQL" {
+		sqlConfig := config.CurrentStorageConfig.Sql
+		repo, err := repository.NewSqlRepository(sqlConfig.Driver, sqlConfig.Dsn)
+		if err != nil {
+			return err
+		}
+
+		defer repo.Close()
+
+		devices, err := repo.(*repository.SqlRepository).MigrateDevices(context.Background())
+		if err != nil {
+			return err
+		}
+		log.Infof("Database migrated, %d devices moved", devices)
+		return nil
+	}
+
+	if len(tenants) == 0 {
+		tenants = []string{config.CurrentStorageConfig.Cassandra.KeySpace}
+	}
+
+	dbSession, err := connection.Connection()
+	if err != nil {
+		return err
+	}
+
+	defer dbSession.Close()
+
+	for _, tenant := range tenants {
+		moved, err := repository.MigrateCassandraItems(context.Background(), dbSession, tenant)
+		if err != nil {
+			return err
+		}
+		devices, err := repository.MigrateCassandraDevices(context.Background(), dbSession, tenant)
+		if err != nil {
+			return err
+		}
+		log.Infof("Tenant %s migrated, %d items and %d devices moved", tenant, moved, devices)
+	}
+	return nil
+}
+
+/*
+Usage: Starts the background sweep of expired items for the given tenant ids, or for the configured tenants. The ids
+are resolved by the allow-list to their keyspaces. The returned channel is closed when the sweeper stopped after the
+context is cancelled.
+*/
+
+func startExpirySweeper(ctx context.Context) (<-chan struct{}, error) {
+	expiryConf := config.CurrentStorageConfig.Expiry
+	stopped := make(chan struct{})
+
+	resolver := env.GetTenantResolver()
+	tenants := resolver.Configured()
+
+	if len(expiryConf.Tenants) > 0 {
+		tenants = make([]tenancy.Tenant, 0, len(expiryConf.Tenants))
+
+		for _, id := range expiryConf.Tenants {
+			tenant, err := resolver.Resolve(ctx, env.GetRepository(), id)
+			if err != nil {
+				return nil, fmt.Errorf("expiry tenant %q: %w", id, err)
+			}
+			tenants = append(tenants, tenant)
+		}
+	}
+
+	sweeper, err := services.NewExpirySweeper(expiryConf.Policy, expiryConf.GracePeriod, tenants)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sweeper.Enabled() {
+		close(stopped)
+		return stopped, nil
+	}
+
+	if expiryConf.Interval <= 0 {
+		return nil, errors.New("expiry interval must be positive")
+	}
+
+	log.Infof("Expired items are processed with policy %s every %s", expiryConf.Policy, expiryConf.Interval)
+	go func() {
+		defer close(stopped)
+		sweeper.Run(ctx, env, expiryConf.Interval)
+	}()
+	return stopped, nil
+}
+
+func refineRoutes(rg *gin.RouterGroup, mode string) {
 	storageGroup := rg.Group("/storage")
 	accountGroup := storageGroup.Group("/:account")
+	accountGroup.Use(middleware.Tenant(env))
 
-	switch env.GetMode() {
-	case "REMOTE":
+	switch mode {
+	case tenancy.RemoteMode:
 		addRemoteRouterGroup(accountGroup)
-	case "DIRECT":
+	case tenancy.DirectMode:
 		addDirectRouterGroup(accountGroup)
 	}
 }
 
 func addDirectRouterGroup(rg *gin.RouterGroup) {
-	env.SetContentType("application/json")
+	contentType := common.NormalContentType
 
-	rg.Use(middleware.AuthModel())
+	rg.Use(middleware.TenantMode(env, tenancy.DirectMode))
+	rg.Use(middleware.AuthModel(contentType))
 	credentialGroup := rg.Group("/credentials")
-	credentialGroup.Use(middleware.AuthModel())
-	api.AddCredentialRoutes(credentialGroup, env)
+	credentialGroup.Use(middleware.AuthModel(contentType))
+	api.AddCredentialRoutes(credentialGroup, env, contentType)
 	presentationGroup := rg.Group("/presentations")
-	presentationGroup.Use(middleware.AuthModel())
-	api.AddPresentationRoutes(presentationGroup, env)
+	presentationGroup.Use(middleware.AuthModel(contentType))
+	api.AddPresentationRoutes(presentationGroup, env, contentType)
+	archiveGroup := rg.Group("/archive")
+	archiveGroup.Use(middleware.AuthModel(contentType))
+	api.AddArchiveRoutes(archiveGroup, env)
 }
 
 func addRemoteRouterGroup(rg *gin.RouterGroup) {
-	env.SetContentType("application/jose")
+	contentType := common.EncryptedContentType
+
+	rg.Use(middleware.TenantMode(env, tenancy.RemoteMode))
 
 	deviceGroup := rg.Group("/device")
 	remoteGroup := deviceGroup.Group("/remote")
-	remoteGroup.Use(middleware.AuthModel())
+	remoteGroup.Use(middleware.AuthModel(contentType))
 	remoteGroup.Use(middleware.Auth(env, false, false))
 	api.AddRemoteRoutes(remoteGroup, env)
 
 	registrationGroup := deviceGroup.Group("/registration")
-	registrationGroup.Use(middleware.AuthModel())
+	registrationGroup.Use(middleware.AuthModel(contentType))
 	registrationGroup.Use(middleware.SelfSignedAuth(env))
 
 	api.AddRegistrationRoutes(registrationGroup, env)
 
 	recoverGroup := deviceGroup.Group("/recovery")
-	recoverGroup.Use(middleware.AuthModel())
+	recoverGroup.Use(middleware.AuthModel(contentType))
 	recoverGroup.Use(middleware.Auth(env, true, true))
 
 	api.AddRecoverRoutes(recoverGroup, env)
 
+	devicesGroup := deviceGroup.Group("/devices")
+	devicesGroup.Use(middleware.AuthModel(contentType))
+	devicesGroup.Use(middleware.Auth(env, false, true))
+
+	api.AddDeviceRoutes(devicesGroup, env)
+
 	credentialGroup := rg.Group("/credentials")
 
-	credentialGroup.Use(middleware.AuthModel())
+	credentialGroup.Use(middleware.AuthModel(contentType))
 	credentialGroup.Use(middleware.Auth(env, false, true))
 
-	api.AddCredentialRoutes(credentialGroup, env)
+	api.AddCredentialRoutes(credentialGroup, env, contentType)
 
 	presentationGroup := rg.Group("/presentations")
 
-	presentationGroup.Use(middleware.AuthModel())
+	presentationGroup.Use(middleware.AuthModel(contentType))
 	presentationGroup.Use(middleware.Auth(env, false, true))
 
-	api.AddPresentationRoutes(presentationGroup, env)
+	api.AddPresentationRoutes(presentationGroup, env, contentType)
+
+	archiveGroup := rg.Group("/archive")
+
+	archiveGroup.Use(middleware.AuthModel(contentType))
+	archiveGroup.Use(middleware.Auth(env, false, true))
+
+	api.AddArchiveRoutes(archiveGroup, env)
 }
 
-func startServer() error {
-	server := serverPkg.New(env, config.CurrentStorageConfig.ServerMode)
-	server.Add(refineRoutes)
+// enabledModes parses the configured mode, a single mode or DIRECT,REMOTE for both.
+func enabledModes() []string {
+	var modes []string
+
+	for _, mode := range strings.Split(env.GetMode(), ",") {
+		mode = strings.ToUpper(strings.TrimSpace(mode))
 
-	// Run server
-	return server.Run(config.CurrentStorageConfig.ListenPort)
+		if (mode == tenancy.DirectMode || mode == tenancy.RemoteMode) && !slices.Contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+
+	return modes
+}
+
+/*
+Usage: Creates the HTTP servers with the routes of the microservice core server. The core server can not be shut
+down, so the same routes are mounted on own engines. The first mode is served on the listen port with swagger and the
+tenant administration, with both modes the REMOTE routes get a listener of their own on the remote listen port, so
+that the unauthenticated DIRECT routes do not need to be exposed with them.
+*/
+
+func newServers(modes []string) ([]*http.Server, error) {
+	switch config.CurrentStorageConfig.ServerMode {
+	case serverPkg.ModeProduction:
+		gin.SetMode(gin.ReleaseMode)
+	case serverPkg.ModeDebug:
+		gin.SetMode(gin.DebugMode)
+	case serverPkg.ModeTesting:
+		gin.SetMode(gin.TestMode)
+	default:
+		return nil, fmt.Errorf("invalid server mode %s", config.CurrentStorageConfig.ServerMode)
+	}
+
+	ports := map[string]int{modes[0]: config.CurrentStorageConfig.ListenPort}
+
+	if len(modes) > 1 {
+		remotePort := config.CurrentStorageConfig.RemoteListenPort
+
+		if remotePort == 0 || remotePort == config.CurrentStorageConfig.ListenPort {
+			return nil, fmt.Errorf("mode %s needs a remote listen port besides the listen port", env.GetMode())
+		}
+
+		ports[tenancy.DirectMode] = config.CurrentStorageConfig.ListenPort
+		ports[tenancy.RemoteMode] = remotePort
+	}
+
+	servers := make([]*http.Server, 0, len(modes))
+
+	for _, mode := range []string{tenancy.DirectMode, tenancy.RemoteMode} {
+		port, ok := ports[mode]
+
+		if !ok {
+			continue
+		}
+
+		router := gin.Default()
+
+		v1 := router.Group("/v1")
+		tenants := v1.Group("/tenants/" + serverPkg.RouteParamTenantID)
+
+		v1.Group("/metrics").GET("/health", func(c *gin.Context) {
+			c.JSON(http.StatusOK, serverPkg.HealthCheckResponse{Status: env.IsHealthy()})
+		})
+
+		refineRoutes(tenants, mode)
+
+		if port == config.CurrentStorageConfig.ListenPort {
+			env.SetSwaggerBasePath(strings.Replace(tenants.BasePath(), serverPkg.RouteParamTenantID, serverPkg.RouteParamTenantIDSwaggerNotation, 1))
+			router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler, env.SwaggerOptions()...))
+
+			if adminConf := config.CurrentStorageConfig.Admin; adminConf.Token != "" {
+				adminGroup := v1.Group("/admin/tenants")
+				adminGroup.Use(middleware.AdminAuth(adminConf.Token))
+				api.AddTenantRoutes(adminGroup, env, repository.Replication{
+					Class:       adminConf.Replication.Class,
+					Factor:      adminConf.Replication.Factor,
+					DataCenters: adminConf.Replication.DataCenters,
+				})
+			}
+		}
+
+		servers = append(servers, &http.Server{
+			Addr:    fmt.Sprintf(":%d", port),
+			Handler: router,
+		})
+	}
+
+	return servers, nil
+}
+
+/*
+Usage: Stops the service within the shutdown timeout. New HTTP requests are refused and the running ones finished,
+then the NATS messages in flight and the current item of the expiry sweep are finished, so that no write is cut off.
+Afterwards the crypto provider, NATS and the database are closed in this order.
+*/
+
+func shutdown(servers []*http.Server, sweeperStopped <-chan struct{}) {
+	logger := env.GetLogger()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.CurrentStorageConfig.ShutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error(err, "HTTP requests not finished in time", "address", server.Addr)
+		}
+	}
+
+	if err := event.Drain(ctx); err != nil {
+		logger.Error(err, "NATS messages not finished in time")
+	}
+
+	select {
+	case <-sweeperStopped:
+	case <-ctx.Done():
+		logger.Error(ctx.Err(), "Expiry sweep not finished in time")
+	}
+
+	if err := crypto.CloseCryptoProvider(); err != nil {
+		logger.Error(err, "Crypto provider could not be closed")
+	}
+
+	if err := event.Close(); err != nil {
+		logger.Error(err, "NATS connections could not be closed")
+	}
+
+	if repo := env.GetRepository(); repo != nil {
+		repo.Close()
+	}
+
+	logger.Info("Service stopped")
 }
 
 func initializeCrypto() error {
 	var err error
-	var exists bool
 
 	var engine types.CryptoProvider
 	ex, err := os.Executable()
@@ -143,7 +454,7 @@ func initializeCrypto() error {
 	exPath := filepath.Dir(ex)
 	enginePath := config.CurrentStorageConfig.Crypto.PluginPath
 
-	if !config.CurrentStorageConfig.UnitTestModeOn {
+	if !config.CurrentStorageConfig.UnitTestModeOn && config.CurrentStorageConfig.Profile != "DEBUG:MEMORY" {
 		if config.CurrentStorageConfig.Profile == "DEBUG:LOCAL" {
 			engine = core.CreateCryptoEngine(path.Join(exPath, ".engines/.local/crypto-provider-local-plugin.so"))
 		} else {
@@ -164,8 +475,30 @@ func initializeCrypto() error {
 
 	crypto.CreateCryptoProvider(config.CurrentStorageConfig.UnitTestModeOn, engine)
 
+	return createCryptoKeys()
+}
+
+// createCryptoKeys creates the crypto context and sign key of the global configuration and of every tenant overriding it.
+func createCryptoKeys() error {
+	if err := createCryptoKey(env.GetCryptoNamespace(""), env.GetCryptoSignKey("")); err != nil {
+		return err
+	}
+
+	for id := range env.GetTenantOverrides().Tenants() {
+		if err := createCryptoKey(env.GetCryptoNamespace(id), env.GetCryptoSignKey(id)); err != nil {
+			return fmt.Errorf("crypto keys of tenant %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+func createCryptoKey(namespace string, signKey string) error {
+	var err error
+	var exists bool
+
 	ctx := types.CryptoContext{
-		Namespace: env.GetCryptoNamespace(),
+		Namespace: namespace,
 		Context:   context.Background(),
 		Group:     common.StorageCryptoContext,
 	}
@@ -179,7 +512,7 @@ func initializeCrypto() error {
 	}
 
 	identifier := types.CryptoIdentifier{
-		KeyId:         env.GetCryptoSignKey(),
+		KeyId:         signKey,
 		CryptoContext: ctx,
 	}
 
@@ -203,6 +536,14 @@ func initializeCrypto() error {
 func main() {
 	logger := env.GetLogger()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			logger.Error(err, "Migration failed")
+			os.Exit(1)
+		}
+		return
+	}
+
 	err := initializeCrypto()
 	if err != nil {
 		logger.Error(err, "Failed initializing crypto keys")
@@ -213,17 +554,61 @@ func main() {
 		return
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if overrides := env.GetTenantOverrides(); overrides != nil && config.CurrentStorageConfig.Tenants.ReloadInterval > 0 {
+		go overrides.Watch(ctx, config.CurrentStorageConfig.Tenants.ReloadInterval, func() {
+			logger.Info("Tenant settings reloaded")
+			if err := createCryptoKeys(); err != nil {
+				logger.Error(err, "Failed creating crypto keys of tenants")
+			}
+		}, func(err error) {
+			logger.Error(err, "Tenant settings not reloaded, previous settings are kept")
+		})
+	}
+
+	sweeperStopped, err := startExpirySweeper(ctx)
+	if err != nil {
+		logger.Error(err, "Failed starting expiry sweeper")
+		os.Exit(1)
+	}
+
+	modes := enabledModes()
+
 	if config.CurrentStorageConfig.Messaging.Enabled {
-		if err := event.StartCloudEvents(); err != nil {
+		// messages carry the JWEs of the devices only in deployments which are REMOTE alone
+		contentType := common.NormalContentType
+		if slices.Equal(modes, []string{tenancy.RemoteMode}) {
+			contentType = common.EncryptedContentType
+		}
+
+		if err := event.StartCloudEvents(contentType); err != nil {
 			return
 		}
 	}
 
-	if env.GetMode() == "REMOTE" || env.GetMode() == "DIRECT" {
-		if err := startServer(); err != nil {
-			return
+	var servers []*http.Server
+
+	if len(modes) > 0 {
+		servers, err = newServers(modes)
+		if err != nil {
+			logger.Error(err, "Failed creating server")
+			os.Exit(1)
+		}
+
+		for _, server := range servers {
+			go func() {
+				if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logger.Error(err, "Server failed", "address", server.Addr)
+					stop()
+				}
+			}()
 		}
 	}
 
-	defer env.GetSession().Close()
+	<-ctx.Done()
+	logger.Info("Shutting down")
+
+	shutdown(servers, sweeperStopped)
 }
@@ -0,0 +1,428 @@
+package dcql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
+)
+
+// Formats which are named differently in DCQL and in the stored credentials.
+const (
+	FormatDcSdJwt = "dc+sd-jwt"
+	FormatVcSdJwt = "vc+sd-jwt"
+)
+
+var ErrInvalidQuery = errors.New("invalid dcql query")
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func queryError(reason string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(reason, args...))
+}
+
+// Query is a Digital Credentials Query Language query as defined by OpenID4VP.
+type Query struct {
+	Credentials    []CredentialQuery    `json:"credentials"`
+	CredentialSets []CredentialSetQuery `json:"credential_sets,omitempty"`
+}
+
+type CredentialQuery struct {
+	Id        string        `json:"id"`
+	Format    string        `json:"format"`
+	Multiple  bool          `json:"multiple,omitempty"`
+	Meta      *Meta         `json:"meta,omitempty"`
+	Claims    []ClaimsQuery `json:"claims,omitempty"`
+	ClaimSets [][]string    `json:"claim_sets,omitempty"`
+}
+
+// Meta holds the format specific constraints. Only the members of the queried format are evaluated.
+type Meta struct {
+	VctValues    []string   `json:"vct_values,omitempty"`
+	TypeValues   [][]string `json:"type_values,omitempty"`
+	DoctypeValue string     `json:"doctype_value,omitempty"`
+}
+
+/*
+ClaimsQuery selects claims by a path of object keys, array indices and null for all array elements. With values
+the claim must equal one of them.
+*/
+type ClaimsQuery struct {
+	Id     string        `json:"id,omitempty"`
+	Path   []interface{} `json:"path"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+type CredentialSetQuery struct {
+	Options  [][]string  `json:"options"`
+	Required *bool       `json:"required,omitempty"`
+	Purpose  interface{} `json:"purpose,omitempty"`
+}
+
+// Credential is a stored credential with its decoded claims. Data is returned as is in the results.
+type Credential struct {
+	Format string
+	Claims map[string]interface{}
+	Data   interface{}
+}
+
+// Result lists the credentials matching the credential query with the id.
+type Result struct {
+	Id          string                                   `json:"id"`
+	Credentials map[string]presentation.CredentialResult `json:"credentials"`
+}
+
+// Validate checks the structure of the query, so that malformed queries are rejected instead of matching nothing.
+func (q *Query) Validate() error {
+	if len(q.Credentials) == 0 {
+		return queryError("credentials must not be empty")
+	}
+
+	ids := make(map[string]bool)
+
+	for _, c := range q.Credentials {
+		if !idPattern.MatchString(c.Id) {
+			return queryError("credential query id %q is invalid", c.Id)
+		}
+
+		if ids[c.Id] {
+			return queryError("credential query id %s is not unique", c.Id)
+		}
+		ids[c.Id] = true
+
+		if c.Format == "" {
+			return queryError("credential query %s has no format", c.Id)
+		}
+
+		if err := c.validateClaims(); err != nil {
+			return err
+		}
+	}
+
+	for n, set := range q.CredentialSets {
+		if len(set.Options) == 0 {
+			return queryError("credential set %d has no options", n)
+		}
+
+		for _, option := range set.Options {
+			for _, id := range option {
+				if !ids[id] {
+					return queryError("credential set %d references unknown credential query %s", n, id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *CredentialQuery) validateClaims() error {
+	claimIds := make(map[string]bool)
+
+	for _, claim := range c.Claims {
+		if len(claim.Path) == 0 {
+			return queryError("claims query of %s has an empty path", c.Id)
+		}
+
+		for _, element := range claim.Path {
+			switch element.(type) {
+			case nil, string:
+			default:
+				if _, ok := arrayIndex(element); !ok {
+					return queryError("claims path of %s contains an invalid element", c.Id)
+				}
+			}
+		}
+
+		if claim.Id != "" {
+			claimIds[claim.Id] = true
+		} else if len(c.ClaimSets) > 0 {
+			return queryError("claims of %s need ids when claim sets are used", c.Id)
+		}
+	}
+
+	if len(c.ClaimSets) > 0 && len(c.Claims) == 0 {
+		return queryError("claim sets of %s require claims", c.Id)
+	}
+
+	for _, set := range c.ClaimSets {
+		for _, id := range set {
+			if !claimIds[id] {
+				return queryError("claim set of %s references unknown claim %s", c.Id, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+Usage: Evaluates the query on the credentials and returns the matches per credential query in the order of the
+query. All matching credentials are returned, even if multiple is false, the holder picks one of them. When the
+query can not be satisfied, because a required credential query or credential set has no match, the result is empty.
+*/
+
+func (q *Query) Evaluate(credentials map[string]Credential) []Result {
+	ids := make([]string, 0, len(credentials))
+	for id := range credentials {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	matches := make(map[string]map[string]presentation.CredentialResult)
+
+	for _, c := range q.Credentials {
+		for _, id := range ids {
+			credential := credentials[id]
+
+			if !c.matches(credential) {
+				continue
+			}
+
+			if matches[c.Id] == nil {
+				matches[c.Id] = make(map[string]presentation.CredentialResult)
+			}
+
+			matches[c.Id][id] = presentation.CredentialResult{
+				Type: credential.Format,
+				Data: credential.Data,
+			}
+		}
+	}
+
+	if !q.satisfied(matches) {
+		return []Result{}
+	}
+
+	results := make([]Result, 0, len(matches))
+
+	for _, c := range q.Credentials {
+		if m, ok := matches[c.Id]; ok {
+			results = append(results, Result{Id: c.Id, Credentials: m})
+		}
+	}
+
+	return results
+}
+
+// satisfied reports whether all credential queries, or with credential sets one option of every required set, matched.
+func (q *Query) satisfied(matches map[string]map[string]presentation.CredentialResult) bool {
+	if len(q.CredentialSets) == 0 {
+		return len(matches) == len(q.Credentials)
+	}
+
+	for _, set := range q.CredentialSets {
+		if set.Required != nil && !*set.Required {
+			continue
+		}
+
+		found := false
+		for _, option := range set.Options {
+			if allMatched(option, matches) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func allMatched(ids []string, matches map[string]map[string]presentation.CredentialResult) bool {
+	for _, id := range ids {
+		if _, ok := matches[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CredentialQuery) matches(credential Credential) bool {
+	if !sameFormat(c.Format, credential.Format) || !c.matchesMeta(credential) {
+		return false
+	}
+
+	if len(c.ClaimSets) == 0 {
+		for _, claim := range c.Claims {
+			if !claim.matches(credential.Claims) {
+				return false
+			}
+		}
+		return true
+	}
+
+	claims := make(map[string]ClaimsQuery, len(c.Claims))
+	for _, claim := range c.Claims {
+		claims[claim.Id] = claim
+	}
+
+	for _, set := range c.ClaimSets {
+		found := true
+		for _, id := range set {
+			if !claims[id].matches(credential.Claims) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameFormat(query string, stored string) bool {
+	if query == FormatDcSdJwt {
+		query = FormatVcSdJwt
+	}
+	return query == stored
+}
+
+func (c *CredentialQuery) matchesMeta(credential Credential) bool {
+	if c.Meta == nil {
+		return true
+	}
+
+	if len(c.Meta.VctValues) > 0 {
+		vct, _ := credential.Claims["vct"].(string)
+		if !contains(c.Meta.VctValues, vct) {
+			return false
+		}
+	}
+
+	if len(c.Meta.TypeValues) > 0 {
+		types := stringList(credential.Claims["type"])
+		found := false
+
+		for _, required := range c.Meta.TypeValues {
+			if containsAll(types, required) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	// doctype_value applies to mdoc documents, whose claims can not be decoded
+	return c.Meta.DoctypeValue == ""
+}
+
+func (claim ClaimsQuery) matches(claims map[string]interface{}) bool {
+	selected := selectPath([]interface{}{claims}, claim.Path)
+
+	if len(selected) == 0 {
+		return false
+	}
+
+	if len(claim.Values) == 0 {
+		return true
+	}
+
+	for _, s := range selected {
+		for _, v := range claim.Values {
+			if equalValue(s, v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// selectPath walks the claims path. Elements which do not fit the structure select nothing.
+func selectPath(current []interface{}, path []interface{}) []interface{} {
+	for _, element := range path {
+		next := make([]interface{}, 0)
+
+		for _, value := range current {
+			switch e := element.(type) {
+			case string:
+				if object, ok := value.(map[string]interface{}); ok {
+					if v, ok := object[e]; ok {
+						next = append(next, v)
+					}
+				}
+			case nil:
+				if array, ok := value.([]interface{}); ok {
+					next = append(next, array...)
+				}
+			default:
+				i, ok := arrayIndex(e)
+				if array, isArray := value.([]interface{}); ok && isArray && i < len(array) {
+					next = append(next, array[i])
+				}
+			}
+		}
+
+		if len(next) == 0 {
+			return nil
+		}
+
+		current = next
+	}
+
+	return current
+}
+
+// arrayIndex reads a non-negative integer path element, which is a float64 when the query was decoded from JSON.
+func arrayIndex(element interface{}) (int, bool) {
+	switch e := element.(type) {
+	case int:
+		return e, e >= 0
+	case float64:
+		return int(e), e >= 0 && e == float64(int(e))
+	}
+	return 0, false
+}
+
+func equalValue(claim interface{}, value interface{}) bool {
+	switch claim.(type) {
+	case string, float64, bool:
+		return claim == value
+	}
+	return false
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, e := range list {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(list []string, values []string) bool {
+	for _, v := range values {
+		if !contains(list, v) {
+			return false
+		}
+	}
+	return true
+}
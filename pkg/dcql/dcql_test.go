@@ -0,0 +1,108 @@
+package dcql
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func credentials() map[string]Credential {
+	var pid, degree map[string]interface{}
+
+	json.Unmarshal([]byte(`{"vct":"https://example.com/pid","given_name":"Alice","nationalities":["DE","FR"]}`), &pid)
+	json.Unmarshal([]byte(`{"type":["VerifiableCredential","UniversityDegreeCredential"],"credentialSubject":{"degree":{"type":"BachelorDegree"}}}`), &degree)
+
+	return map[string]Credential{
+		"pid":    {Format: FormatVcSdJwt, Claims: pid, Data: "pid"},
+		"degree": {Format: "ldp_vc", Claims: degree, Data: "degree"},
+	}
+}
+
+func parse(t *testing.T, query string) *Query {
+	var q Query
+
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &q
+}
+
+func TestEvaluateClaims(t *testing.T) {
+	q := parse(t, `{"credentials":[
+		{"id":"pid","format":"dc+sd-jwt","meta":{"vct_values":["https://example.com/pid"]},"claims":[{"path":["nationalities",null],"values":["FR"]}]},
+		{"id":"degree","format":"ldp_vc","meta":{"type_values":[["UniversityDegreeCredential"]]},"claims":[{"path":["credentialSubject","degree","type"]}]}
+	]}`)
+
+	results := q.Evaluate(credentials())
+
+	if len(results) != 2 || results[0].Id != "pid" || results[1].Id != "degree" {
+		t.Fatal("results are wrong", results)
+	}
+
+	if match, ok := results[0].Credentials["pid"]; !ok || match.Data != "pid" || match.Type != FormatVcSdJwt {
+		t.Error("pid match is wrong", results[0])
+	}
+
+	q = parse(t, `{"credentials":[{"id":"pid","format":"dc+sd-jwt","claims":[{"path":["nationalities",0],"values":["FR"]}]}]}`)
+
+	if results := q.Evaluate(credentials()); len(results) != 0 {
+		t.Error("value should not match", results)
+	}
+}
+
+func TestEvaluateClaimSets(t *testing.T) {
+	q := parse(t, `{"credentials":[{"id":"pid","format":"dc+sd-jwt","claims":[
+		{"id":"birthdate","path":["birthdate"]},
+		{"id":"name","path":["given_name"]}
+	],"claim_sets":[["birthdate"],["name"]]}]}`)
+
+	if results := q.Evaluate(credentials()); len(results) != 1 {
+		t.Error("second claim set should match", results)
+	}
+}
+
+func TestEvaluateCredentialSets(t *testing.T) {
+	q := parse(t, `{"credentials":[
+		{"id":"pid","format":"dc+sd-jwt"},
+		{"id":"mdl","format":"mso_mdoc","meta":{"doctype_value":"org.iso.18013.5.1.mDL"}}
+	],"credential_sets":[{"options":[["mdl"],["pid"]]},{"options":[["mdl"]],"required":false}]}`)
+
+	results := q.Evaluate(credentials())
+
+	if len(results) != 1 || results[0].Id != "pid" {
+		t.Error("pid option should satisfy the query", results)
+	}
+
+	q = parse(t, `{"credentials":[{"id":"pid","format":"dc+sd-jwt"},{"id":"mdl","format":"mso_mdoc"}]}`)
+
+	if results := q.Evaluate(credentials()); len(results) != 0 {
+		t.Error("query without credential sets requires all credential queries", results)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []string{
+		`{"credentials":[]}`,
+		`{"credentials":[{"id":"a b","format":"ldp_vc"}]}`,
+		`{"credentials":[{"id":"a","format":"ldp_vc"},{"id":"a","format":"ldp_vc"}]}`,
+		`{"credentials":[{"id":"a"}]}`,
+		`{"credentials":[{"id":"a","format":"ldp_vc","claims":[{"path":[]}]}]}`,
+		`{"credentials":[{"id":"a","format":"ldp_vc","claims":[{"path":[-1]}]}]}`,
+		`{"credentials":[{"id":"a","format":"ldp_vc","claims":[{"id":"x","path":["x"]}],"claim_sets":[["y"]]}]}`,
+		`{"credentials":[{"id":"a","format":"ldp_vc"}],"credential_sets":[{"options":[["b"]]}]}`,
+	}
+
+	for _, query := range invalid {
+		var q Query
+		json.Unmarshal([]byte(query), &q)
+
+		if err := q.Validate(); !errors.Is(err, ErrInvalidQuery) {
+			t.Error("query should be invalid", query, err)
+		}
+	}
+}
@@ -1,10 +1,52 @@
 package messaging
 
-import "github.com/eclipse-xfsc/nats-message-library/common"
+import (
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/dcql"
+
+	"github.com/eclipse-xfsc/nats-message-library/common"
+	"github.com/eclipse-xfsc/oid4-vci-vp-library/model/presentation"
+)
 
 const (
 	StorePresentationType = "storage.service.presentation"
 	StoreCredentialType   = "storage.service.credential"
+	StoreResultType       = "storage.service.store.result"
+)
+
+// Error ids of failed store messages.
+const (
+	InvalidMessageError   = "invalid_message"
+	InvalidPayloadError   = "invalid_payload"
+	InvalidFormatError    = "invalid_format"
+	StoreError            = "store_failed"
+	UnknownTenantError    = "unknown_tenant"
+	WrongContentTypeError = "wrong_content_type"
+)
+
+// Event types of the requests on the query topic and of their replies. Requests of other types are queries.
+const (
+	GetType         = "storage.service.get"
+	GetReplyType    = "storage.service.get.reply"
+	ListType        = "storage.service.list"
+	ListReplyType   = "storage.service.list.reply"
+	QueryType       = "storage.service.query"
+	QueryReplyType  = "storage.service.query.reply"
+	DeleteType      = "storage.service.delete"
+	DeleteReplyType = "storage.service.delete.reply"
+	ChainType       = "storage.service.chain"
+	ChainReplyType  = "storage.service.chain.reply"
+)
+
+// Event types of the lifecycle events on the lifecycle topic.
+const (
+	CredentialStoredType    = "storage.service.credential.stored"
+	CredentialDeletedType   = "storage.service.credential.deleted"
+	PresentationStoredType  = "storage.service.presentation.stored"
+	PresentationDeletedType = "storage.service.presentation.deleted"
+	DeviceRegisteredType    = "storage.service.device.registered"
+	DeviceRecoveredType     = "storage.service.device.recovered"
+	DeviceRevokedType       = "storage.service.device.revoked"
+	AccountLockedType       = "storage.service.account.locked"
 )
 
 type StorageServiceStoreMessage struct {
@@ -14,4 +56,131 @@ type StorageServiceStoreMessage struct {
 	Payload     []byte `json:"payload"`
 	ContentType string `json:"contentType"`
 	Id          string `json:"id"`
+	// IdempotencyKey identifies the message, a redelivery with the key of the last store does not change the item.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+/*
+StorageServiceStoreResult reports the outcome of a store message. It answers a store message sent as request and is
+published on the result topic for the store topic.
+*/
+type StorageServiceStoreResult struct {
+	common.Reply
+	AccountId string `json:"accountId"`
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+	Success   bool   `json:"success"`
+	Version   int64  `json:"version,omitempty"`
+	Receipt   string `json:"receipt,omitempty"`
+}
+
+// StorageServiceGetMessage reads a single credential, or with the presentation type a presentation, of an account.
+type StorageServiceGetMessage struct {
+	common.Request
+	AccountId string `json:"accountId"`
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+}
+
+// StorageServiceGetReply contains the item, unknown ids are answered with status 404.
+type StorageServiceGetReply struct {
+	common.Reply
+	Id         string      `json:"id,omitempty"`
+	Credential interface{} `json:"credential,omitempty"`
+	Format     string      `json:"format,omitempty"`
+	Expired    bool        `json:"expired,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Version    int64       `json:"version,omitempty"`
+	Receipt    string      `json:"receipt,omitempty"`
+}
+
+// StorageServiceListMessage lists the items of an account ordered by id, a limit of 0 returns all.
+type StorageServiceListMessage struct {
+	common.Request
+	AccountId      string `json:"accountId"`
+	Type           string `json:"type"`
+	Limit          int    `json:"limit,omitempty"`
+	Cursor         string `json:"cursor,omitempty"`
+	IncludeExpired bool   `json:"includeExpired,omitempty"`
+}
+
+// StorageServiceListReply contains a page of items and the cursor of the next page.
+type StorageServiceListReply struct {
+	common.Reply
+	Credentials map[string]interface{} `json:"credentials,omitempty"`
+	Next        string                 `json:"next,omitempty"`
+	Formats     map[string]string      `json:"formats,omitempty"`
+	Expired     []string               `json:"expired,omitempty"`
+	Status      map[string]string      `json:"status,omitempty"`
+	Receipt     string                 `json:"receipt,omitempty"`
+}
+
+/*
+StorageServiceQueryMessage queries the credentials, or with the presentation type the presentations, of an account
+by a DCQL query or, if none is given, by a presentation definition.
+*/
+type StorageServiceQueryMessage struct {
+	common.Request
+	AccountId              string                               `json:"accountId"`
+	Type                   string                               `json:"type"`
+	DcqlQuery              *dcql.Query                          `json:"dcql_query,omitempty"`
+	PresentationDefinition *presentation.PresentationDefinition `json:"presentation_definition,omitempty"`
+	IncludeExpired         bool                                 `json:"includeExpired,omitempty"`
+}
+
+/*
+StorageServiceQueryReply contains the matches per credential query id of a DCQL query or the groups of a presentation
+definition, in remote mode all items and a receipt.
+*/
+type StorageServiceQueryReply struct {
+	common.Reply
+	Matches     []dcql.Result               `json:"matches,omitempty"`
+	Groups      []presentation.FilterResult `json:"groups,omitempty"`
+	Credentials map[string]interface{}      `json:"credentials,omitempty"`
+	Receipt     string                      `json:"receipt,omitempty"`
+	Expired     []string                    `json:"expired,omitempty"`
+	Status      map[string]string           `json:"status,omitempty"`
+}
+
+// StorageServiceDeleteMessage deletes a credential, or with the presentation type a presentation, of an account.
+type StorageServiceDeleteMessage struct {
+	common.Request
+	AccountId string `json:"accountId"`
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+}
+
+type StorageServiceDeleteReply struct {
+	common.Reply
+	Receipt string `json:"receipt,omitempty"`
+}
+
+type ChainItem struct {
+	Item  string      `json:"item"`
+	Chain []ChainItem `json:"chain,omitempty"`
+}
+
+// StorageServiceChainMessage builds a chain of credentials of an account, like the chain endpoint.
+type StorageServiceChainMessage struct {
+	common.Request
+	AccountId string      `json:"accountId"`
+	Root      string      `json:"root"`
+	Chain     []ChainItem `json:"chain,omitempty"`
+	ChainName string      `json:"chainName"`
+}
+
+type StorageServiceChainReply struct {
+	common.Reply
+	Chain map[string]interface{} `json:"chain,omitempty"`
+}
+
+/*
+StorageServiceLifecycleEvent announces a change of a wallet. Item events carry the id and the type of the item,
+account events neither. The content is never part of the event.
+*/
+type StorageServiceLifecycleEvent struct {
+	TenantId  string `json:"tenant_id"`
+	AccountId string `json:"accountId"`
+	Id        string `json:"id,omitempty"`
+	Type      string `json:"type,omitempty"`
 }
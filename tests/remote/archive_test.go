@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	handlers "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+const remoteCredential = "eyJyZWNpcGllbnQiOiIwNDdmMzJiYzlhMTA5ZWVmMzI3OTczOGFlMDEwM2EyNTU4YzI3MTE1MWFlODA4NDRiMjEyNjc4ZWQ5MGI3YTdhIiwiY3R5IjoiSldUIiwiZXBrIjp7Imt0eSI6IkVDIiwiY3J2IjoiUC0yNTYiLCJ4IjoiR3lETlV2Y2gwcHVxVUY4cUNMM1ZSWUVRUE84ZmdXd0N5eXFBbFpoa0RRSSIsInkiOiJGeHByMnNESTdxV2Y1R21MOHg3M1RybUYzeFFzNlctMG9WeEdrUWRReWRVIn0sImVuYyI6IkEyNTZHQ00iLCJhbGciOiJFQ0RILUVTK0EyNTZLVyJ9.vMoj_MHEbwJ7XQ-0t6n2Wmj4-3CXVHl4lawN8KSKESypmg-SKFjmag.dqorQWUEp1_ThhGx.ON1vEAETJCnpzI3KdDQTbDjjZS08CXpa_BQkWKSYODEeCPXmUaGkbDzTY1nldYfwAT5OUzyi4fjh4j9pzYYklhKDWknSpRD5plXcX6qG20hpMTjDiEGKGpQSDfXlE4_yMntJKfiquWc0Cw9HJ6E9m800CSAxuLqgmTGa9F-2mFHKog.4kHTg5dUSFcUf1jwDD0fbQ"
+
+// nonceCounter counts the renewals of the device nonce.
+type nonceCounter struct {
+	repository.Repository
+	renewals int
+}
+
+func (r *nonceCounter) SetNonce(ctx context.Context, key repository.AccountKey, id string, nonce string, ttl time.Duration) error {
+	r.renewals++
+	return r.Repository.SetNonce(ctx, key, id, nonce, ttl)
+}
+
+func importArchive(t *testing.T, engine http.Handler, url string, contentType string, body string) model.ImportResultModel {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Content-Type", contentType)
+
+	engine.ServeHTTP(recorder, request)
+
+	if recorder.Code != 200 {
+		t.Fatal("Here should be a 200", recorder.Code, recorder.Body.String())
+	}
+
+	var result model.ImportResultModel
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestArchiveExportImport(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		storeExpiryCredentials(t)
+
+		recorder := directRequest(t, "GET", "/tenant_space/ABCD123/archive", "")
+
+		var archive model.ArchiveModel
+		json.Unmarshal(recorder.Body.Bytes(), &archive)
+
+		if recorder.Code != 200 || len(archive.Items) != 2 || archive.Items[0].Id != "expired" || archive.Items[0].Expiry == nil || archive.Items[1].Content != validCredential {
+			t.Fatal("Export is wrong", recorder.Code, recorder.Body.String())
+		}
+
+		request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/archive", nil)
+		request.Header.Add("Accept", "application/x-ndjson")
+		recorder = httptest.NewRecorder()
+		directEngine.ServeHTTP(recorder, request)
+
+		ndjson := recorder.Body.String()
+
+		if recorder.Code != 200 || strings.Count(ndjson, "\n") != 2 || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/x-ndjson") {
+			t.Fatal("NDJSON export is wrong", recorder.Code, ndjson)
+		}
+
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		archiveJson, _ := json.Marshal(archive)
+
+		result := importArchive(t, directEngine, "/tenant_space/ABCD123/archive", common.NormalContentType, string(archiveJson))
+
+		if len(result.Items) != 2 || result.Items[0].Status != model.ImportStored || result.Items[1].Status != model.ImportStored {
+			t.Error("Items should be stored", result)
+		}
+
+		result = importArchive(t, directEngine, "/tenant_space/ABCD123/archive", "application/x-ndjson", ndjson)
+
+		if len(result.Items) != 2 || result.Items[0].Status != model.ImportSkipped {
+			t.Error("Existing items should be skipped", result)
+		}
+
+		result = importArchive(t, directEngine, "/tenant_space/ABCD123/archive?conflict=overwrite", "application/x-ndjson", ndjson)
+
+		if result.Items[0].Status != model.ImportOverwritten || result.Items[0].Version != 2 {
+			t.Error("Existing items should be overwritten", result)
+		}
+
+		result = importArchive(t, directEngine, "/tenant_space/ABCD123/archive?conflict=rename", "application/x-ndjson", ndjson)
+
+		if result.Items[0].Status != model.ImportRenamed || result.Items[0].StoredId == "" || result.Items[0].StoredId == "expired" {
+			t.Error("Existing items should be renamed", result)
+		}
+
+		if recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials?includeExpired=true", ""); strings.Count(recorder.Body.String(), "credentialSubject") != 4 {
+			t.Error("Renamed items should be stored besides", recorder.Body.String())
+		}
+
+		result = importArchive(t, directEngine, "/tenant_space/ABCD123/archive", "application/x-ndjson", `{"kind":"credential","id":"broken","content":"{\"type\":"}
+{"kind":"unknown","id":"other","content":"{}"}`)
+
+		if result.Items[0].Status != model.ImportFailed || result.Items[1].Status != model.ImportFailed || result.Items[1].Error == "" {
+			t.Error("Broken items should fail", result)
+		}
+
+		if recorder := directRequest(t, "POST", "/tenant_space/ABCD123/archive?conflict=merge", string(archiveJson)); recorder.Code != 400 {
+			t.Error("Unknown conflict policy should be rejected", recorder.Code)
+		}
+	})
+}
+
+func TestArchiveImportLimits(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+
+		post := func(contentType string, body []byte) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			request, _ := http.NewRequest("POST", "/tenant_space/ABCD123/archive", bytes.NewReader(body))
+			request.Header.Add("Content-Type", contentType)
+			directEngine.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		line := `{"kind":"credential","id":"item","content":"{}"}` + "\n"
+		ndjson := []byte(strings.Repeat(line, 10001))
+
+		if recorder := post("application/x-ndjson", ndjson); recorder.Code != 413 {
+			t.Error("NDJSON archive with too many items should be refused", recorder.Code)
+		}
+
+		archive := model.ArchiveModel{Items: make([]model.ArchiveItem, 10001)}
+		archiveJson, _ := json.Marshal(archive)
+
+		if recorder := post(common.NormalContentType, archiveJson); recorder.Code != 413 {
+			t.Error("Archive with too many items should be refused", recorder.Code)
+		}
+
+		if recorder := post("application/x-ndjson", bytes.Repeat([]byte(" "), 64<<20+1)); recorder.Code != 413 {
+			t.Error("Archive above the size limit should be refused", recorder.Code)
+		}
+
+		if items, _ := directEnv.GetRepository().LoadItems(context.Background(), directEnv.GetAccountKey(model.AuthModel{Account: "ABCD123", TenantId: "tenant_space"}), false); len(items) != 0 {
+			t.Error("Refused archives should not store items", len(items))
+		}
+	})
+}
+
+func TestRemoteArchiveExportImport(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		counter := &nonceCounter{Repository: repository.NewMemoryRepository()}
+		credentialEnv.SetRepository(counter)
+
+		archive := `{"items":[{"kind":"credential","id":"device","content":"` + remoteCredential + `"},{"kind":"credential","content":"` + remoteCredential + `"},{"kind":"presentation","id":"plain","content":"{}"}]}`
+		result := importArchive(t, credentialEngine, "/tenant_space/ABCD123/archive", common.NormalContentType, archive)
+
+		if len(result.Items) != 3 || result.Items[0].Status != model.ImportStored || result.Items[1].Status != model.ImportStored || result.Items[2].Status != model.ImportFailed || result.Items[2].Error != handlers.BodyParseError {
+			t.Fatal("Only JWE items should be imported", result)
+		}
+
+		key, _ := CreateTestJWK()
+		var rawKey interface{}
+		key.Raw(&rawKey)
+
+		var transaction model.TransactionModel
+		if plain, err := jwe.Decrypt([]byte(result.Receipt), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey)); err != nil || json.Unmarshal(plain, &transaction) != nil || transaction.Nonce == "" {
+			t.Fatal("Import should carry a receipt", result.Receipt, err)
+		}
+
+		if counter.renewals != 1 {
+			t.Fatal("Import should renew the nonce once", counter.renewals)
+		}
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/archive", nil)
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 200 || recorder.Header().Get("Content-Type") != common.EncryptedContentType {
+			t.Fatal("Here should be a JWE", recorder.Code, recorder.Body.String())
+		}
+
+		plain, err := jwe.Decrypt(recorder.Body.Bytes(), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey))
+
+		if err != nil {
+			t.Fatal("Export can not be decrypted", err)
+		}
+
+		var exported model.ArchiveModel
+		json.Unmarshal(plain, &exported)
+
+		// the generated id of the second item decides about the order
+		ids := make(map[string]string)
+		for _, item := range exported.Items {
+			ids[item.Id] = item.Content
+		}
+
+		if len(exported.Items) != 2 || ids["device"] != remoteCredential || exported.Receipt == "" {
+			t.Error("Export is wrong", string(plain))
+		}
+
+		if counter.renewals != 2 {
+			t.Error("Export should renew the nonce", counter.renewals)
+		}
+	})
+}
@@ -54,7 +54,7 @@ func init() {
 
 	group2 := accGroup.Group("/test2")
 	k, _ := CreateTestJWK()
-	group2.Use(middleware.AuthTestModel(&k))
+	group2.Use(middleware.AuthTestModel(common.EncryptedContentType, &k))
 	group2.Use(middleware.Auth(authEnv, false, false))
 
 	group2.GET("", func(c *gin.Context) {
@@ -62,7 +62,7 @@ func init() {
 	})
 
 	group3 := accGroup.Group("/test3")
-	group3.Use(middleware.AuthModel())
+	group3.Use(middleware.AuthModel(common.EncryptedContentType))
 	group3.Use(middleware.SelfSignedAuth(authEnv))
 
 	group3.GET("", func(c *gin.Context) {
@@ -3,10 +3,12 @@ package tests
 import (
 	"bytes"
 	"context"
+	b64 "encoding/base64"
 	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/eclipse-xfsc/microservice-core-go/pkg/logr"
@@ -15,8 +17,10 @@ import (
 	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
 	cryptoProvider "github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
 	commonHandler "github.com/eclipse-xfsc/credential-storage-service/internal/handlers/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/middleware"
 	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
 
 	"github.com/stretchr/testify/mock"
 
@@ -56,9 +60,17 @@ func init() {
 	accountGroup := tenantGroup.Group("/:account")
 
 	group := accountGroup.Group("/test")
-	group.Use(middleware.AuthTestModel(&deviceKey))
-	credentialEnv.SetContentType("application/jose")
-	api.AddCredentialRoutes(group, credentialEnv)
+	group.Use(middleware.AuthTestModel(common.EncryptedContentType, &deviceKey))
+	api.AddCredentialRoutes(group, credentialEnv, common.EncryptedContentType)
+
+	// the same service with items stored in plain text
+	plainGroup := accountGroup.Group("/plain")
+	plainGroup.Use(middleware.AuthTestModel(common.NormalContentType, &deviceKey))
+	api.AddCredentialRoutes(plainGroup, credentialEnv, common.NormalContentType)
+
+	archiveGroup := accountGroup.Group("/archive")
+	archiveGroup.Use(middleware.AuthTestModel(common.EncryptedContentType, &deviceKey))
+	api.AddArchiveRoutes(archiveGroup, credentialEnv)
 
 	cryptoProvider.CreateCryptoProvider(true, nil)
 	credentialEnv.SetCryptoNamespace("unique")
@@ -67,7 +79,7 @@ func init() {
 		Identifier: types.CryptoIdentifier{
 			KeyId: "ABCD123",
 			CryptoContext: types.CryptoContext{
-				Namespace: credentialEnv.GetCryptoNamespace(),
+				Namespace: credentialEnv.GetCryptoNamespace("tenant_space"),
 				Context:   context.Background(),
 				Group:     common.StorageCryptoContext,
 			},
@@ -102,7 +114,6 @@ func init() {
 
 func TestAddCredentialNoBody(t *testing.T) {
 	common.WithTestEnvironment(credentialEnv, func() {
-		credentialEnv.SetContentType("application/jose")
 		recorder := httptest.NewRecorder()
 		request, err := http.NewRequest("PUT", "/tenant_space/ABCD123/test/123", nil)
 		request.Header.Add("Content-Type", "application/jose")
@@ -269,19 +280,20 @@ func TestAddCredential(t *testing.T) {
 func TestGetCredential(t *testing.T) {
 	common.WithTestEnvironment(credentialEnv, func() {
 
-		mockDb := &SessionMock{}
-		mockQ := &QueryMock{}
-		mockQ.
-			On("Scan", mock.Anything).
-			Run(func(args mock.Arguments) {
-				arg := args.Get(0).(*model.GetCredentialModel)
-				arg.Credentials = map[string]interface{}{"cred1": "cred1"}
-				arg.Receipt = "receipt"
-			})
-		mockDb.
-			On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
-			Return(mockQ)
-		credentialEnv.SetSession(mockDb)
+		repo := repository.NewMemoryRepository()
+		credentialEnv.SetRepository(repo)
+
+		cipher, err := cryptoProvider.EncryptMessage("ABCD123", credentialEnv.GetCryptoNamespace("tenant_space"), common.StorageCryptoContext, []byte("cred1"), context.Background(), cryptoProvider.GetCryptoProvider())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authModel := model.AuthModel{Account: "ABCD123", TenantId: "tenant_space"}
+		err = repo.StoreItem(context.Background(), credentialEnv.GetAccountKey(authModel), "cred1", b64.RawStdEncoding.EncodeToString(cipher), repository.ItemMetadata{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		jwk, _ := CreateTestJWK()
 
 		var rawKey interface{}
@@ -317,9 +329,9 @@ func TestGetCredential(t *testing.T) {
 			t.Error()
 		}
 
-		_, ok = j["credentials"]
+		credentials, ok := j["credentials"].(map[string]interface{})
 
-		if !ok {
+		if !ok || credentials["cred1"] != "cred1" {
 			t.Error()
 		}
 	})
@@ -379,3 +391,385 @@ func TestDeleteCredential(t *testing.T) {
 		t.Error()
 	}
 }
+
+func seedCredentials(t *testing.T, ids ...string) {
+	repo := repository.NewMemoryRepository()
+	credentialEnv.SetRepository(repo)
+
+	authModel := model.AuthModel{Account: "ABCD123", TenantId: "tenant_space"}
+
+	for _, id := range ids {
+		cipher, err := cryptoProvider.EncryptMessage("ABCD123", credentialEnv.GetCryptoNamespace("tenant_space"), common.StorageCryptoContext, []byte("content"+id), context.Background(), cryptoProvider.GetCryptoProvider())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repo.StoreItem(context.Background(), credentialEnv.GetAccountKey(authModel), id, b64.RawStdEncoding.EncodeToString(cipher), repository.ItemMetadata{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetSingleCredential(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		seedCredentials(t, "cred1", "cred2")
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/test/cred2", nil)
+		request.Header.Add("Content-Type", "application/jose")
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 200 {
+			t.Fatal("Here should be a 200")
+		}
+
+		var result model.GetCredentialItemModel
+		err := json.Unmarshal(recorder.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Id != "cred2" || result.Credential != "contentcred2" || result.Receipt == "" {
+			t.Error("Result is wrong.")
+		}
+
+		recorder = httptest.NewRecorder()
+		request, _ = http.NewRequest("GET", "/tenant_space/ABCD123/test/unknown", nil)
+		request.Header.Add("Content-Type", "application/jose")
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 404 {
+			t.Error("Here should be a 404")
+		}
+	})
+}
+
+func TestGetCredentialPages(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		seedCredentials(t, "a", "b", "c")
+
+		found := make(map[string]interface{})
+		cursor := ""
+		pages := 0
+
+		for {
+			recorder := httptest.NewRecorder()
+			request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/test?limit=2&cursor="+cursor, nil)
+			request.Header.Add("Content-Type", "application/jose")
+
+			credentialEngine.ServeHTTP(recorder, request)
+
+			if recorder.Code != 200 {
+				t.Fatal("Here should be a 200")
+			}
+
+			var result model.GetCredentialModel
+			err := json.Unmarshal(recorder.Body.Bytes(), &result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(result.Credentials) > 2 || result.Receipt == "" {
+				t.Error("Page is wrong.")
+			}
+
+			for k, v := range result.Credentials {
+				found[k] = v
+			}
+
+			pages++
+			cursor = result.Next
+
+			if cursor == "" || pages > 3 {
+				break
+			}
+		}
+
+		if pages != 2 || len(found) != 3 || found["c"] != "contentc" {
+			t.Error("Pages are wrong.", pages, found)
+		}
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/test?limit=-1", nil)
+		request.Header.Add("Content-Type", "application/jose")
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 400 {
+			t.Error("Here should be a 400")
+		}
+	})
+}
+
+func TestGetCredentialsByMetadata(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		indexer, _ := metadata.NewIndexer(metadata.ModeHashed, "salt")
+		credentialEnv.SetIndexer(indexer)
+		defer credentialEnv.SetIndexer(nil)
+
+		repo := repository.NewMemoryRepository()
+		credentialEnv.SetRepository(repo)
+
+		authModel := model.AuthModel{Account: "ABCD123", TenantId: "tenant_space"}
+		credentials := map[string]string{
+			"degree":  `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential","UniversityDegreeCredential"],"issuer":"did:example:university"}`,
+			"license": `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential","DriversLicense"],"issuer":"did:example:authority"}`,
+		}
+
+		for id, credential := range credentials {
+			cipher, err := cryptoProvider.EncryptMessage("ABCD123", credentialEnv.GetCryptoNamespace("tenant_space"), common.StorageCryptoContext, []byte(credential), context.Background(), cryptoProvider.GetCryptoProvider())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.StoreItem(context.Background(), credentialEnv.GetAccountKey(authModel), id, b64.RawStdEncoding.EncodeToString(cipher), indexer.Metadata([]byte(credential)), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/test?type=DriversLicense", nil)
+		request.Header.Add("Content-Type", "application/jose")
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 200 {
+			t.Fatal("Here should be a 200")
+		}
+
+		var result model.GetCredentialModel
+		err := json.Unmarshal(recorder.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Credentials) != 1 || result.Credentials["license"] != credentials["license"] {
+			t.Error("Filter result is wrong.", result.Credentials)
+		}
+
+		credentialEnv.SetIndexer(nil)
+
+		recorder = httptest.NewRecorder()
+		request, _ = http.NewRequest("GET", "/tenant_space/ABCD123/test?type=DriversLicense", nil)
+		request.Header.Add("Content-Type", "application/jose")
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 400 {
+			t.Error("Here should be a 400 without metadata index")
+		}
+	})
+}
+
+func TestAddCredentialFormatValidation(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		credentialEnv.SetRepository(repository.NewMemoryRepository())
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("PUT", "/tenant_space/ABCD123/plain/broken", bytes.NewReader([]byte("eyJhbGciOiJFUzI1NiJ9.e30.c2ln~not-a-disclosure~")))
+		request.Header.Add("Content-Type", common.NormalContentType)
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 400 {
+			t.Fatal("Here should be a 400")
+		}
+
+		var result map[string]string
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if !strings.HasPrefix(result["message"], metadata.ErrInvalidFormat.Error()) {
+			t.Error("Result Message is wrong.", result["message"])
+		}
+
+		credential := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"issuer":"did:example:issuer"}`
+
+		recorder = httptest.NewRecorder()
+		request, _ = http.NewRequest("PUT", "/tenant_space/ABCD123/plain/valid", bytes.NewReader([]byte(credential)))
+		request.Header.Add("Content-Type", common.NormalContentType)
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		if recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		recorder = httptest.NewRecorder()
+		request, _ = http.NewRequest("GET", "/tenant_space/ABCD123/plain/valid", nil)
+		request.Header.Add("Content-Type", common.NormalContentType)
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		var item model.GetCredentialItemModel
+		err := json.Unmarshal(recorder.Body.Bytes(), &item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.Format != metadata.FormatLdpVc || item.Credential != credential {
+			t.Error("Stored format is wrong.", item)
+		}
+	})
+}
+
+func TestAddCredentialVersions(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		credentialEnv.SetRepository(repository.NewMemoryRepository())
+
+		credential := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"issuer":"did:example:issuer"}`
+
+		put := func(headers map[string]string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			request, _ := http.NewRequest("PUT", "/tenant_space/ABCD123/plain/versioned", bytes.NewReader([]byte(credential)))
+			request.Header.Add("Content-Type", common.NormalContentType)
+			for k, v := range headers {
+				request.Header.Add(k, v)
+			}
+			credentialEngine.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		if recorder := put(map[string]string{"If-Match": `"1"`}); recorder.Code != 412 {
+			t.Error("Updating a missing item should fail", recorder.Code)
+		}
+
+		if recorder := put(map[string]string{"If-None-Match": "*"}); recorder.Code != 200 || recorder.Header().Get("ETag") != `"1"` {
+			t.Fatal("Item should be created", recorder.Code, recorder.Header().Get("ETag"))
+		}
+
+		if recorder := put(map[string]string{"If-None-Match": "*"}); recorder.Code != 409 {
+			t.Error("Creating an existing item should conflict", recorder.Code)
+		}
+
+		if recorder := put(map[string]string{"If-Match": `"1"`}); recorder.Code != 200 || recorder.Header().Get("ETag") != `"2"` {
+			t.Error("Item should be updated", recorder.Code, recorder.Header().Get("ETag"))
+		}
+
+		if recorder := put(map[string]string{"If-Match": `"1"`}); recorder.Code != 412 {
+			t.Error("Stale update should fail", recorder.Code)
+		}
+
+		if recorder := put(map[string]string{"If-Match": "1"}); recorder.Code != 400 {
+			t.Error("Unquoted entity tag should be rejected", recorder.Code)
+		}
+
+		if recorder := put(nil); recorder.Code != 200 || recorder.Header().Get("ETag") != `"3"` {
+			t.Error("Unconditional store should update", recorder.Code, recorder.Header().Get("ETag"))
+		}
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/tenant_space/ABCD123/plain/versioned", nil)
+		request.Header.Add("Content-Type", common.NormalContentType)
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		var item model.GetCredentialItemModel
+		json.Unmarshal(recorder.Body.Bytes(), &item)
+
+		if item.Version != 3 || recorder.Header().Get("ETag") != `"3"` {
+			t.Error("Version is wrong.", item.Version, recorder.Header().Get("ETag"))
+		}
+	})
+}
+
+func TestCreateCredential(t *testing.T) {
+	common.WithTestEnvironment(credentialEnv, func() {
+		repo := repository.NewMemoryRepository()
+		credentialEnv.SetRepository(repo)
+
+		tok := "eyJyZWNpcGllbnQiOiIwNDdmMzJiYzlhMTA5ZWVmMzI3OTczOGFlMDEwM2EyNTU4YzI3MTE1MWFlODA4NDRiMjEyNjc4ZWQ5MGI3YTdhIiwiY3R5IjoiSldUIiwiZXBrIjp7Imt0eSI6IkVDIiwiY3J2IjoiUC0yNTYiLCJ4IjoiR3lETlV2Y2gwcHVxVUY4cUNMM1ZSWUVRUE84ZmdXd0N5eXFBbFpoa0RRSSIsInkiOiJGeHByMnNESTdxV2Y1R21MOHg3M1RybUYzeFFzNlctMG9WeEdrUWRReWRVIn0sImVuYyI6IkEyNTZHQ00iLCJhbGciOiJFQ0RILUVTK0EyNTZLVyJ9.vMoj_MHEbwJ7XQ-0t6n2Wmj4-3CXVHl4lawN8KSKESypmg-SKFjmag.dqorQWUEp1_ThhGx.ON1vEAETJCnpzI3KdDQTbDjjZS08CXpa_BQkWKSYODEeCPXmUaGkbDzTY1nldYfwAT5OUzyi4fjh4j9pzYYklhKDWknSpRD5plXcX6qG20hpMTjDiEGKGpQSDfXlE4_yMntJKfiquWc0Cw9HJ6E9m800CSAxuLqgmTGa9F-2mFHKog.4kHTg5dUSFcUf1jwDD0fbQ"
+
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/tenant_space/ABCD123/test", bytes.NewReader([]byte(tok)))
+		request.Header.Add("Content-Type", "application/jose")
+
+		credentialEngine.ServeHTTP(recorder, request)
+
+		location := recorder.Header().Get("Location")
+
+		if recorder.Code != 201 || !strings.HasPrefix(location, "/tenant_space/ABCD123/test/") || recorder.Body.String() == "" {
+			t.Fatal("Here should be a 201 with location and receipt", recorder.Code, location)
+		}
+
+		items, _ := repo.LoadItems(context.Background(), credentialEnv.GetAccountKey(model.AuthModel{Account: "ABCD123", TenantId: "tenant_space"}), false)
+
+		if _, ok := items[strings.TrimPrefix(location, "/tenant_space/ABCD123/test/")]; !ok || len(items) != 1 {
+			t.Error("Item is not stored under the location", items)
+		}
+	})
+}
+
+func TestCreateDirectCredential(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+
+		credential := `{"@context":["https://www.w3.org/2018/credentials/v1"],"id":"urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5","type":["VerifiableCredential"]}`
+
+		// posting the same credential again keeps the item
+		for n := 0; n < 2; n++ {
+			recorder := directRequest(t, "POST", "/tenant_space/ABCD123/credentials/create", credential)
+
+			var created model.CreatedModel
+			json.Unmarshal(recorder.Body.Bytes(), &created)
+
+			if recorder.Code != 201 || created.Id != "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5" || recorder.Header().Get("ETag") != `"1"` {
+				t.Error("Credential should be stored under its id", recorder.Code, created.Id, recorder.Header().Get("ETag"))
+			}
+		}
+
+		// another credential with the same id, e.g. of another issuer, does not replace it
+		other := `{"@context":["https://www.w3.org/2018/credentials/v1"],"id":"urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5","type":["VerifiableCredential"],"issuer":"did:example:other"}`
+		recorder := directRequest(t, "POST", "/tenant_space/ABCD123/credentials/create", other)
+
+		var created model.CreatedModel
+		json.Unmarshal(recorder.Body.Bytes(), &created)
+
+		if recorder.Code != 201 || len(created.Id) != 36 {
+			t.Error("Colliding credential should get a generated id", recorder.Code, created.Id)
+		}
+
+		recorder = directRequest(t, "GET", "/tenant_space/ABCD123/credentials/urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5", "")
+
+		var item model.GetCredentialItemModel
+		json.Unmarshal(recorder.Body.Bytes(), &item)
+
+		if item.Credential != credential || item.Version != 1 {
+			t.Error("Credential should not be replaced", recorder.Body.String())
+		}
+
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials/create", createSdJwt(map[string]interface{}{"iss": "did:example:issuer", "vct": "pid"}))
+		json.Unmarshal(recorder.Body.Bytes(), &created)
+
+		if recorder.Code != 201 || len(created.Id) != 36 || recorder.Header().Get("Location") != "/tenant_space/ABCD123/credentials/"+created.Id {
+			t.Error("Credential without id should get a generated one", recorder.Code, created.Id)
+		}
+
+		// POST on the collection only queries, other content types are rejected
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials", `{"vct":"pid","iss":"did:example:issuer","jti":"query"}`)
+
+		if recorder.Code == 201 {
+			t.Error("JSON body should not be stored", recorder.Body.String())
+		}
+
+		if recorder := directTypedRequest(t, "POST", "/tenant_space/ABCD123/credentials", "application/vc+ld+json", credential); recorder.Code != 400 {
+			t.Error("Unknown content type should be rejected", recorder.Code, recorder.Body.String())
+		}
+
+		if recorder := directTypedRequest(t, "POST", "/tenant_space/ABCD123/credentials/create", "text/plain", credential); recorder.Code != 400 {
+			t.Error("Create should require the content type of the mode", recorder.Code, recorder.Body.String())
+		}
+
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials", `{"id":"query","input_descriptors":[]}`)
+
+		var result map[string][]interface{}
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if recorder.Code != 200 || len(result["groups"]) != 2 {
+			t.Error("Presentation definition should still query", recorder.Code, recorder.Body.String())
+		}
+	})
+}
@@ -37,11 +37,30 @@ func (q *QueryMock) Exec() error {
 	return nil
 }
 
+func (q *QueryMock) Iter() connection.IterInterface {
+	return &IterMock{}
+}
+
 // Scan wraps the query's Scan method
 func (q *QueryMock) Scan(dest ...interface{}) error {
 	return nil
 }
 
+func (q *QueryMock) MapScanCAS(dest map[string]interface{}) (bool, error) {
+	return true, nil
+}
+
 func (q *QueryMock) WithContext(c context.Context) connection.QueryInterface {
 	return q
 }
+
+type IterMock struct {
+}
+
+func (i *IterMock) Scan(dest ...interface{}) bool {
+	return false
+}
+
+func (i *IterMock) Close() error {
+	return nil
+}
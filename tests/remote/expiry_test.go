@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/lifecycle"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/services"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+)
+
+const expiredCredential = `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"expirationDate":"2000-01-01T00:00:00Z","credentialSubject":{"name":"Alice"}}`
+const validCredential = `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"expirationDate":"2999-01-01T00:00:00Z","credentialSubject":{"name":"Bob"}}`
+
+func storeExpiryCredentials(t *testing.T) {
+	if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/expired", expiredCredential); recorder.Code != 200 {
+		t.Fatal("Here should be a 200", recorder.Body.String())
+	}
+
+	if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/valid", validCredential); recorder.Code != 200 {
+		t.Fatal("Here should be a 200", recorder.Body.String())
+	}
+}
+
+func TestExpiredCredentialsFiltered(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		storeExpiryCredentials(t)
+
+		var result model.GetCredentialModel
+		recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials", "")
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if _, ok := result.Credentials["expired"]; ok || len(result.Credentials) != 1 || len(result.Expired) != 0 {
+			t.Error("Expired credential should be filtered.", recorder.Body.String())
+		}
+
+		result = model.GetCredentialModel{}
+		recorder = directRequest(t, "GET", "/tenant_space/ABCD123/credentials?includeExpired=true", "")
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if len(result.Credentials) != 2 || len(result.Expired) != 1 || result.Expired[0] != "expired" {
+			t.Error("Expired credential should be included and flagged.", recorder.Body.String())
+		}
+
+		result = model.GetCredentialModel{}
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials", "")
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		for _, group := range result.Groups {
+			if _, ok := group.Credentials["expired"]; ok {
+				t.Error("Expired credential should not be matched.", recorder.Body.String())
+			}
+		}
+
+		var item model.GetCredentialItemModel
+		recorder = directRequest(t, "GET", "/tenant_space/ABCD123/credentials/expired", "")
+		json.Unmarshal(recorder.Body.Bytes(), &item)
+
+		if recorder.Code != 200 || !item.Expired {
+			t.Error("Expired item should be flagged.", recorder.Body.String())
+		}
+
+		if recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials?includeExpired=maybe", ""); recorder.Code != 400 {
+			t.Error("Here should be a 400", recorder.Body.String())
+		}
+	})
+}
+
+func TestExpirySweeper(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		for _, policy := range []string{services.ExpiryPolicyArchive, services.ExpiryPolicyDelete} {
+			directEnv.SetRepository(repository.NewMemoryRepository())
+			storeExpiryCredentials(t)
+
+			sweeper, err := services.NewExpirySweeper(policy, 24*time.Hour, []tenancy.Tenant{{Id: "tenant_space", Keyspace: "tenant_space"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := sweeper.Sweep(context.Background(), directEnv); err != nil {
+				t.Fatal(err)
+			}
+
+			var result model.GetCredentialModel
+			recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials?includeExpired=true", "")
+			json.Unmarshal(recorder.Body.Bytes(), &result)
+
+			if _, ok := result.Credentials["expired"]; ok || len(result.Credentials) != 1 {
+				t.Error("Expired credential should be removed.", policy, recorder.Body.String())
+			}
+		}
+
+		if _, err := services.NewExpirySweeper("SOMETIMES", 0, nil); err == nil {
+			t.Error("unknown policy should fail")
+		}
+
+		if _, err := services.NewExpirySweeper(services.ExpiryPolicyDelete, 0, []tenancy.Tenant{{Id: "acme", Keyspace: "acme; DROP KEYSPACE x"}}); err == nil {
+			t.Error("invalid keyspace should fail")
+		}
+	})
+}
+
+func TestExpirySweeperEvents(t *testing.T) {
+	recorder := new(eventRecorder)
+
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		directEnv.SetPublisher(lifecycle.NewPublisher(recorder, common.EventSource, nil))
+		defer directEnv.SetPublisher(nil)
+
+		storeExpiryCredentials(t)
+		recorder.events = nil
+
+		// the tenant acme is stored in the keyspace tenant_space, its events name the tenant
+		sweeper, err := services.NewExpirySweeper(services.ExpiryPolicyDelete, 24*time.Hour, []tenancy.Tenant{{Id: "acme", Keyspace: "tenant_space"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sweeper.Sweep(context.Background(), directEnv); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if len(recorder.events) != 1 || recorder.events[0].Type() != messaging.CredentialDeletedType {
+		t.Fatal("Deleted item should be announced.", recorder.types())
+	}
+
+	var deleted messaging.StorageServiceLifecycleEvent
+	json.Unmarshal(recorder.events[0].Data(), &deleted)
+
+	if deleted.TenantId != "acme" || deleted.Id != "expired" {
+		t.Error("Event should name the tenant id.", deleted)
+	}
+}
+
+// cancellingRepository cancels the sweep while it deletes an item.
+type cancellingRepository struct {
+	repository.Repository
+	cancel  context.CancelFunc
+	deleted int
+}
+
+func (r *cancellingRepository) DeleteItem(ctx context.Context, key repository.AccountKey, id string, presentation bool) error {
+	r.cancel()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	r.deleted++
+	return r.Repository.DeleteItem(ctx, key, id, presentation)
+}
+
+func TestExpirySweeperStops(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		storeExpiryCredentials(t)
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/expired2", expiredCredential); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		sweeper, err := services.NewExpirySweeper(services.ExpiryPolicyDelete, 24*time.Hour, []tenancy.Tenant{{Id: "tenant_space", Keyspace: "tenant_space"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a sweep cancelled while it deletes an item finishes the item and stops before the next one
+		ctx, cancel := context.WithCancel(context.Background())
+		repo := &cancellingRepository{Repository: directEnv.GetRepository(), cancel: cancel}
+		directEnv.SetRepository(repo)
+
+		stopped := make(chan struct{})
+		go func() {
+			sweeper.Run(ctx, directEnv, time.Hour)
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Sweeper should stop after cancellation.")
+		}
+
+		if repo.deleted != 1 {
+			t.Error("Only the running item should be finished.", repo.deleted)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eclipse-xfsc/microservice-core-go/pkg/logr"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/api"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/metadata"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/middleware"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+var directEngine *gin.Engine
+var directEnv *common.Environment
+
+func init() {
+	directEnv = new(common.Environment)
+
+	logger, err := logr.New("info", true, nil)
+	if err != nil {
+		log.Fatalf("failed to init logger: %t", err)
+	}
+
+	directEnv.SetLogger(*logger)
+	directEnv.SetCryptoNamespace("direct")
+
+	directEngine = gin.Default()
+	group := directEngine.Group("/:tenantId").Group("/:account").Group("/credentials")
+	group.Use(middleware.AuthTestModel(common.NormalContentType, nil))
+	api.AddCredentialRoutes(group, directEnv, common.NormalContentType)
+
+	archiveGroup := directEngine.Group("/:tenantId").Group("/:account").Group("/archive")
+	archiveGroup.Use(middleware.AuthTestModel(common.NormalContentType, nil))
+	api.AddArchiveRoutes(archiveGroup, directEnv)
+}
+
+func directRequest(t *testing.T, method string, url string, body string) *httptest.ResponseRecorder {
+	return directTypedRequest(t, method, url, common.NormalContentType, body)
+}
+
+func directTypedRequest(t *testing.T, method string, url string, contentType string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Content-Type", contentType)
+
+	directEngine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func createSdJwt(claims map[string]interface{}, disclosures ...string) string {
+	payload, _ := json.Marshal(claims)
+	sdJwt := b64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"vc+sd-jwt"}`)) + "." +
+		b64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl~"
+
+	for _, disclosure := range disclosures {
+		sdJwt += disclosure + "~"
+	}
+
+	return sdJwt
+}
+
+func disclose(values ...interface{}) (string, string) {
+	data, _ := json.Marshal(values)
+	disclosure := b64.RawURLEncoding.EncodeToString(data)
+	digest := sha256.Sum256([]byte(disclosure))
+	return disclosure, b64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+func TestPresentationDefinitionWithSdJwt(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+
+		dob, dobDigest := disclose("salt1", "dob", "2000-01-01")
+		_, hiddenDigest := disclose("salt2", "name", "Alice")
+
+		sdJwt := createSdJwt(map[string]interface{}{
+			"iss":     "did:example:issuer",
+			"vct":     "https://example.com/pid",
+			"_sd_alg": "sha-256",
+			"credentialSubject": map[string]interface{}{
+				"_sd": []string{dobDigest, hiddenDigest},
+			},
+		}, dob)
+
+		jsonLd := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"credentialSubject":{"name":"Bob"}}`
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/pid", sdJwt); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/other", jsonLd); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		definition := `{"id":"pd","input_descriptors":[{"id":"dob","constraints":{"fields":[{"path":["$.credentialSubject.dob"],"filter":{"type":"string","pattern":"^2000"}}]}}]}`
+		recorder := directRequest(t, "POST", "/tenant_space/ABCD123/credentials", definition)
+
+		if recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		var result model.GetCredentialModel
+		err := json.Unmarshal(recorder.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Groups) != 1 || len(result.Groups[0].Credentials) != 1 {
+			t.Fatal("Filter result is wrong.", result.Groups)
+		}
+
+		match, ok := result.Groups[0].Credentials["pid"]
+		if !ok || match.Data != sdJwt || match.Type != metadata.FormatSdJwtVc || result.Groups[0].FormatType != metadata.FormatSdJwtVc {
+			t.Error("Original SD-JWT was not returned.", result.Groups[0])
+		}
+
+		definition = `{"id":"pd","input_descriptors":[{"id":"name","constraints":{"fields":[{"path":["$.credentialSubject.name"],"filter":{"type":"string","pattern":"Alice"}}]}}]}`
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials", definition)
+
+		result = model.GetCredentialModel{}
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if len(result.Groups) != 0 {
+			t.Error("Undisclosed claims should not match.", result.Groups)
+		}
+	})
+}
+
+func TestDcqlQuery(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+
+		given, givenDigest := disclose("salt1", "given_name", "Alice")
+
+		sdJwt := createSdJwt(map[string]interface{}{
+			"iss":     "did:example:issuer",
+			"vct":     "https://example.com/pid",
+			"_sd_alg": "sha-256",
+			"_sd":     []string{givenDigest},
+		}, given)
+
+		jsonLd := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"credentialSubject":{"name":"Bob"}}`
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/pid", sdJwt); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/other", jsonLd); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		query := `{"credentials":[{"id":"pid_query","format":"dc+sd-jwt","meta":{"vct_values":["https://example.com/pid"]},"claims":[{"path":["given_name"],"values":["Alice"]}]}]}`
+
+		recorder := directRequest(t, "POST", "/tenant_space/ABCD123/credentials", `{"dcql_query":`+query+`}`)
+
+		if recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		var result model.GetCredentialModel
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if len(result.Matches) != 1 || result.Matches[0].Id != "pid_query" || len(result.Matches[0].Credentials) != 1 {
+			t.Fatal("Query result is wrong.", result.Matches)
+		}
+
+		if match := result.Matches[0].Credentials["pid"]; match.Data != sdJwt || match.Type != metadata.FormatSdJwtVc {
+			t.Error("Original SD-JWT was not returned.", match)
+		}
+
+		recorder = httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/tenant_space/ABCD123/credentials", bytes.NewReader([]byte(query)))
+		request.Header.Add("Content-Type", common.DcqlContentType)
+		directEngine.ServeHTTP(recorder, request)
+
+		result = model.GetCredentialModel{}
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if recorder.Code != 200 || len(result.Matches) != 1 {
+			t.Error("Query by content type failed.", recorder.Body.String())
+		}
+
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials", `{"dcql_query":{"credentials":[{"id":"no format"}]}}`)
+
+		if recorder.Code != 400 || !strings.Contains(recorder.Body.String(), "invalid dcql query") {
+			t.Error("Here should be a 400", recorder.Body.String())
+		}
+	})
+}
@@ -0,0 +1,610 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/crypto-provider-core/types"
+	"github.com/eclipse-xfsc/microservice-core-go/pkg/logr"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/api"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/crypto"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/middleware"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+var flowEngine *gin.Engine
+var flowEnv *common.Environment
+var flowRepository *repository.MemoryRepository
+
+func init() {
+	flowEnv = new(common.Environment)
+
+	logger, err := logr.New("info", true, nil)
+	if err != nil {
+		log.Fatalf("failed to init logger: %t", err)
+	}
+
+	flowEnv.SetLogger(*logger)
+
+	key, _ := CreateTestJWK()
+	var rawKey interface{}
+	key.Raw(&rawKey)
+
+	provider := new(crypto.TestProvider)
+	provider.AddKey("test", rawKey)
+	crypto.CreateCryptoProvider(true, provider)
+
+	flowEnv.SetCryptoNamespace("transit")
+	flowEnv.SetCryptoSignKey("test")
+
+	flowRepository = repository.NewMemoryRepository()
+	flowEnv.SetRepository(flowRepository)
+
+	flowEngine = gin.Default()
+	accountGroup := flowEngine.Group("/:tenantId").Group("/:account")
+
+	deviceGroup := accountGroup.Group("/device")
+	remoteGroup := deviceGroup.Group("/remote")
+	remoteGroup.Use(middleware.AuthModel(common.EncryptedContentType))
+	remoteGroup.Use(middleware.Auth(flowEnv, false, false))
+	api.AddRemoteRoutes(remoteGroup, flowEnv)
+
+	registrationGroup := deviceGroup.Group("/registration")
+	registrationGroup.Use(middleware.AuthModel(common.EncryptedContentType))
+	registrationGroup.Use(middleware.SelfSignedAuth(flowEnv))
+	api.AddRegistrationRoutes(registrationGroup, flowEnv)
+
+	recoverGroup := deviceGroup.Group("/recovery")
+	recoverGroup.Use(middleware.AuthModel(common.EncryptedContentType))
+	recoverGroup.Use(middleware.Auth(flowEnv, true, true))
+	api.AddRecoverRoutes(recoverGroup, flowEnv)
+
+	devicesGroup := deviceGroup.Group("/devices")
+	devicesGroup.Use(middleware.AuthModel(common.EncryptedContentType))
+	devicesGroup.Use(middleware.Auth(flowEnv, false, true))
+	api.AddDeviceRoutes(devicesGroup, flowEnv)
+
+	credentialGroup := accountGroup.Group("/credentials")
+	credentialGroup.Use(middleware.AuthModel(common.EncryptedContentType))
+	credentialGroup.Use(middleware.Auth(flowEnv, false, true))
+	api.AddCredentialRoutes(credentialGroup, flowEnv, common.EncryptedContentType)
+}
+
+func flowRequest(t *testing.T, method string, url string, token []byte, contentType string, body []byte) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "" {
+		request.Header.Add("Content-Type", contentType)
+	}
+
+	if token != nil {
+		request.Header.Add("Authorization", "Bearer "+string(token))
+	}
+
+	flowEngine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decryptReceipt(t *testing.T, recorder *httptest.ResponseRecorder, key jwk.Key, target any) {
+	if recorder.Code != 200 {
+		t.Fatalf("Here should be a 200, but was %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var rawKey interface{}
+	key.Raw(&rawKey)
+
+	plain, err := jwe.Decrypt(recorder.Body.Bytes(), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey))
+	if err != nil {
+		t.Fatal("Message cant be decoded", err)
+	}
+
+	err = json.Unmarshal(plain, target)
+	if err != nil {
+		t.Fatal("Format not serializable", err)
+	}
+}
+
+func createRecoveryToken(key jwk.Key, account string) ([]byte, error) {
+	tok, err := jwt.NewBuilder().
+		IssuedAt(time.Now()).
+		Subject(account).
+		Expiration(time.Now().Add(time.Hour)).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var k interface{}
+	key.Raw(&k)
+	pub, _ := key.PublicKey()
+	headers := jws.NewHeaders()
+	headers.Set("jwk", pub)
+
+	return jwt.Sign(tok, jwt.WithKey(jwa.ES256, k, jws.WithProtectedHeaders(headers)))
+}
+
+func TestRemoteFlowWithMemoryStorage(t *testing.T) {
+	common.WithTestEnvironment(flowEnv, func() {
+		const account = "FLOW1234"
+		base := "/tenant_space/" + account
+
+		key, _ := CreateTestJWK()
+		pub, _ := key.PublicKey()
+
+		selfSigned, err := CreateSelfSignedToken(key, base, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var registration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register", selfSigned, common.NormalContentType, nil), key, &registration)
+
+		if registration.Recovery_Nonce == "" {
+			t.Fatal("Recovery nonce missing.")
+		}
+
+		plainToken, _ := CreateToken(key, base, account, "", false)
+
+		var transaction model.TransactionModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", plainToken, "", nil), key, &transaction)
+
+		var rawPub interface{}
+		pub.Raw(&rawPub)
+		credential, err := jwe.Encrypt([]byte("credential"), jwe.WithKey(jwa.ECDH_ES_A256KW, rawPub), jwe.WithContentEncryption(jwa.A256GCM))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _ := CreateToken(key, base, account, transaction.Nonce, true)
+		decryptReceipt(t, flowRequest(t, "PUT", base+"/credentials/1", token, common.EncryptedContentType, credential), key, &transaction)
+
+		token, _ = CreateToken(key, base, account, transaction.Nonce, true)
+		recorder := flowRequest(t, "GET", base+"/credentials", token, common.EncryptedContentType, nil)
+
+		var result model.GetCredentialModel
+		err = json.Unmarshal(recorder.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Credentials["1"] != string(credential) {
+			t.Error("Stored credential was not returned.")
+		}
+
+		var rawKey interface{}
+		key.Raw(&rawKey)
+		plain, err := jwe.Decrypt([]byte(result.Receipt), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(plain, &transaction)
+
+		token, _ = CreateToken(key, base, account, transaction.Nonce, true)
+		decryptReceipt(t, flowRequest(t, "DELETE", base+"/credentials/1", token, "", nil), key, &transaction)
+
+		items, _ := flowRepository.LoadItems(context.Background(), flowEnv.GetAccountKey(model.AuthModel{Account: account, TenantId: "tenant_space"}), false)
+		if len(items) != 0 {
+			t.Error("Credential was not deleted.")
+		}
+
+		newPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		newKey, _ := jwk.FromRaw(newPriv)
+
+		recoveryToken, _ := CreateToken(key, base, account, registration.Recovery_Nonce, true)
+		recoveryBody, _ := createRecoveryToken(newKey, account)
+
+		decryptReceipt(t, flowRequest(t, "PATCH", base+"/device/recovery/recover", recoveryToken, "application/jwt", recoveryBody), newKey, &registration)
+
+		oldToken, _ := CreateToken(key, base, account, "", false)
+		recorder = flowRequest(t, "GET", base+"/device/remote/session", oldToken, "", nil)
+		if recorder.Code != 403 {
+			t.Error("Old device key should be rejected after recovery.")
+		}
+
+		newToken, _ := CreateToken(newKey, base, account, "", false)
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", newToken, "", nil), newKey, &transaction)
+	})
+}
+
+func TestRemoteConflictRenewsNonce(t *testing.T) {
+	common.WithTestEnvironment(flowEnv, func() {
+		const account = "CONFLICT1"
+		base := "/tenant_space/" + account
+
+		key, _ := CreateTestJWK()
+		pub, _ := key.PublicKey()
+
+		selfSigned, _ := CreateSelfSignedToken(key, base, account)
+
+		var registration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register", selfSigned, common.NormalContentType, nil), key, &registration)
+
+		plainToken, _ := CreateToken(key, base, account, "", false)
+
+		var transaction model.TransactionModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", plainToken, "", nil), key, &transaction)
+
+		var rawPub interface{}
+		pub.Raw(&rawPub)
+		credential, _ := jwe.Encrypt([]byte("credential"), jwe.WithKey(jwa.ECDH_ES_A256KW, rawPub), jwe.WithContentEncryption(jwa.A256GCM))
+
+		put := func(header string, value string) *httptest.ResponseRecorder {
+			token, _ := CreateToken(key, base, account, transaction.Nonce, true)
+			request, _ := http.NewRequest("PUT", base+"/credentials/1", bytes.NewReader(credential))
+			request.Header.Add("Content-Type", common.EncryptedContentType)
+			request.Header.Add("Authorization", "Bearer "+string(token))
+			request.Header.Add(header, value)
+
+			recorder := httptest.NewRecorder()
+			flowEngine.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		decryptReceipt(t, put("If-None-Match", "*"), key, &transaction)
+
+		var rawKey interface{}
+		key.Raw(&rawKey)
+
+		// the failed conditions renew the nonce like a store, the receipt is part of the answer
+		for _, c := range []struct {
+			header string
+			value  string
+			code   int
+		}{{"If-None-Match", "*", 409}, {"If-Match", `"7"`, 412}} {
+			recorder := put(c.header, c.value)
+
+			var answer struct {
+				Message string `json:"message"`
+				Receipt string `json:"receipt"`
+			}
+			json.Unmarshal(recorder.Body.Bytes(), &answer)
+
+			if recorder.Code != c.code || answer.Receipt == "" {
+				t.Fatal("Conflict should carry a receipt.", recorder.Code, recorder.Body.String())
+			}
+
+			plain, err := jwe.Decrypt([]byte(answer.Receipt), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal(plain, &transaction)
+		}
+
+		decryptReceipt(t, put("If-Match", `"1"`), key, &transaction)
+	})
+}
+
+func TestLockedAccountWithMemoryStorage(t *testing.T) {
+	common.WithTestEnvironment(flowEnv, func() {
+		const account = "LOCK1234"
+		base := "/tenant_space/" + account
+
+		key, _ := CreateTestJWK()
+		selfSigned, _ := CreateSelfSignedToken(key, base, account)
+
+		var registration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register", selfSigned, common.NormalContentType, nil), key, &registration)
+
+		flowRepository.SetLocked(flowEnv.GetAccountKey(model.AuthModel{Account: account, TenantId: "tenant_space"}), true)
+
+		token, _ := CreateToken(key, base, account, "", false)
+		recorder := flowRequest(t, "GET", base+"/device/remote/session", token, "", nil)
+
+		if recorder.Code != 403 {
+			t.Error("Locked account should be rejected.")
+		}
+	})
+}
+
+// createDeviceToken is signed by a new device with its key in the header, as body of an added device.
+func createDeviceToken(key jwk.Key, account string, label string) ([]byte, error) {
+	tok, err := jwt.NewBuilder().
+		IssuedAt(time.Now()).
+		Subject(account).
+		Expiration(time.Now().Add(time.Hour)).
+		Claim("label", label).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var k interface{}
+	key.Raw(&k)
+	pub, _ := key.PublicKey()
+	headers := jws.NewHeaders()
+	headers.Set("jwk", pub)
+
+	return jwt.Sign(tok, jwt.WithKey(jwa.ES256, k, jws.WithProtectedHeaders(headers)))
+}
+
+// createKidToken is signed by a bound device which names itself by kid.
+func createKidToken(key jwk.Key, kid string, audience string, account string, nonce string) ([]byte, error) {
+	tok, err := jwt.NewBuilder().
+		IssuedAt(time.Now()).
+		Audience([]string{audience}).
+		Subject(account).
+		Expiration(time.Now().Add(time.Hour)).
+		Claim("nonce", nonce).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var k interface{}
+	key.Raw(&k)
+	headers := jws.NewHeaders()
+	headers.Set(jws.KeyIDKey, kid)
+
+	return jwt.Sign(tok, jwt.WithKey(jwa.ES256, k, jws.WithProtectedHeaders(headers)))
+}
+
+func TestMultipleDevicesWithMemoryStorage(t *testing.T) {
+	common.WithTestEnvironment(flowEnv, func() {
+		const account = "MULTI1234"
+		base := "/tenant_space/" + account
+
+		phone, _ := CreateTestJWK()
+		selfSigned, _ := CreateSelfSignedToken(phone, base, account)
+
+		var phoneRegistration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register?label=Phone", selfSigned, common.NormalContentType, nil), phone, &phoneRegistration)
+
+		phoneId, _ := repository.DeviceId(phone)
+		if phoneRegistration.DeviceId != phoneId {
+			t.Fatal("Device id should be the thumbprint of the key.", phoneRegistration.DeviceId)
+		}
+
+		var phoneTransaction model.TransactionModel
+		token, _ := CreateToken(phone, base, account, "", false)
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", token, "", nil), phone, &phoneTransaction)
+
+		tabletPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tablet, _ := jwk.FromRaw(tabletPriv)
+		body, _ := createDeviceToken(tablet, account, "Tablet")
+
+		token, _ = createKidToken(phone, phoneId, base, account, phoneTransaction.Nonce)
+		recorder := flowRequest(t, "POST", base+"/device/devices", token, "application/jwt", body)
+		if recorder.Code != 201 {
+			t.Fatal("Device should be added.", recorder.Code, recorder.Body.String())
+		}
+
+		var added model.AddedDeviceModel
+		json.Unmarshal(recorder.Body.Bytes(), &added)
+
+		var rawTablet interface{}
+		tablet.Raw(&rawTablet)
+		plain, err := jwe.Decrypt([]byte(added.Registration), jwe.WithKey(jwa.ECDH_ES_A256KW, rawTablet))
+		if err != nil {
+			t.Fatal("Registration should be encrypted for the new device.", err)
+		}
+
+		var tabletRegistration model.RegistrationModel
+		json.Unmarshal(plain, &tabletRegistration)
+
+		if added.Device.Id != tabletRegistration.DeviceId || added.Device.Label != "Tablet" || added.Device.Created.IsZero() || tabletRegistration.Recovery_Nonce == "" {
+			t.Fatal("Added device is wrong.", added.Device, tabletRegistration)
+		}
+
+		var rawPhone interface{}
+		phone.Raw(&rawPhone)
+		plain, err = jwe.Decrypt([]byte(added.Receipt), jwe.WithKey(jwa.ECDH_ES_A256KW, rawPhone))
+		if err != nil {
+			t.Fatal("Receipt should be encrypted for the calling device.", err)
+		}
+		json.Unmarshal(plain, &phoneTransaction)
+
+		token, _ = createKidToken(phone, phoneId, base, account, phoneTransaction.Nonce)
+		if recorder := flowRequest(t, "POST", base+"/device/devices", token, "application/jwt", body); recorder.Code != 409 {
+			t.Error("Bound device should not be added twice.", recorder.Code)
+		}
+
+		token, _ = CreateToken(phone, base, account, "", false)
+		if recorder := flowRequest(t, "GET", base+"/device/remote/session", token, "", nil); recorder.Code != 403 {
+			t.Error("Token without kid should be rejected for several devices.", recorder.Code)
+		}
+
+		var tabletTransaction model.TransactionModel
+		token, _ = createKidToken(tablet, tabletRegistration.DeviceId, base, account, "")
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", token, "", nil), tablet, &tabletTransaction)
+
+		token, _ = createKidToken(tablet, tabletRegistration.DeviceId, base, account, tabletTransaction.Nonce)
+		recorder = flowRequest(t, "GET", base+"/device/devices", token, "", nil)
+
+		var devices model.DevicesModel
+		json.Unmarshal(recorder.Body.Bytes(), &devices)
+
+		if recorder.Code != 200 || len(devices.Devices) != 2 || devices.Devices[0].Label != "Phone" || devices.Devices[0].Current ||
+			!devices.Devices[1].Current || devices.Devices[1].LastSeen == nil {
+			t.Fatal("Devices are wrong.", recorder.Code, recorder.Body.String())
+		}
+
+		plain, err = jwe.Decrypt([]byte(devices.Receipt), jwe.WithKey(jwa.ECDH_ES_A256KW, rawTablet))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(plain, &tabletTransaction)
+
+		token, _ = createKidToken(tablet, tabletRegistration.DeviceId, base, account, tabletTransaction.Nonce)
+		decryptReceipt(t, flowRequest(t, "DELETE", base+"/device/devices/"+phoneId, token, "", nil), tablet, &tabletTransaction)
+
+		token, _ = createKidToken(phone, phoneId, base, account, "")
+		if recorder := flowRequest(t, "GET", base+"/device/remote/session", token, "", nil); recorder.Code != 403 {
+			t.Error("Revoked device should be rejected.", recorder.Code)
+		}
+
+		token, _ = createKidToken(tablet, tabletRegistration.DeviceId, base, account, tabletTransaction.Nonce)
+		if recorder := flowRequest(t, "DELETE", base+"/device/devices/"+phoneId, token, "", nil); recorder.Code != 404 {
+			t.Error("Unknown device should not be found.", recorder.Code)
+		}
+
+		token, _ = createKidToken(tablet, tabletRegistration.DeviceId, base, account, tabletTransaction.Nonce)
+		if recorder := flowRequest(t, "DELETE", base+"/device/devices/"+tabletRegistration.DeviceId, token, "", nil); recorder.Code != 409 {
+			t.Error("Last device should not be revoked.", recorder.Code)
+		}
+	})
+}
+
+func TestDeleteDeviceWithMemoryStorage(t *testing.T) {
+	common.WithTestEnvironment(flowEnv, func() {
+		const account = "DELETE1234"
+		base := "/tenant_space/" + account
+		key := flowEnv.GetAccountKey(model.AuthModel{Account: account, TenantId: "tenant_space"})
+
+		phone, _ := CreateTestJWK()
+		phoneId, _ := repository.DeviceId(phone)
+		selfSigned, _ := CreateSelfSignedToken(phone, base, account)
+
+		var registration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register", selfSigned, common.NormalContentType, nil), phone, &registration)
+
+		var phoneTransaction model.TransactionModel
+		token, _ := CreateToken(phone, base, account, "", false)
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", token, "", nil), phone, &phoneTransaction)
+
+		tabletPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tablet, _ := jwk.FromRaw(tabletPriv)
+		tabletId, _ := repository.DeviceId(tablet)
+		body, _ := createDeviceToken(tablet, account, "Tablet")
+
+		token, _ = createKidToken(phone, phoneId, base, account, phoneTransaction.Nonce)
+		if recorder := flowRequest(t, "POST", base+"/device/devices", token, "application/jwt", body); recorder.Code != 201 {
+			t.Fatal("Device should be added.", recorder.Code, recorder.Body.String())
+		}
+
+		var tabletTransaction model.TransactionModel
+		token, _ = createKidToken(tablet, tabletId, base, account, "")
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", token, "", nil), tablet, &tabletTransaction)
+
+		var deletion model.DeletionModel
+		token, _ = createKidToken(tablet, tabletId, base, account, tabletTransaction.Nonce)
+		decryptReceipt(t, flowRequest(t, "DELETE", base+"/device/remote/delete", token, "", nil), tablet, &deletion)
+
+		if deletion.Account != account || deletion.Device != tabletId {
+			t.Error("Deletion should name the deleted device.", deletion)
+		}
+
+		devices, err := flowRepository.ListDevices(context.Background(), key)
+		if err != nil || len(devices) != 1 || devices[0].Id != phoneId {
+			t.Fatal("Only the calling device should be deleted.", devices, err)
+		}
+
+		token, _ = createKidToken(phone, phoneId, base, account, "")
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", token, "", nil), phone, &phoneTransaction)
+
+		deletion = model.DeletionModel{}
+		token, _ = createKidToken(phone, phoneId, base, account, phoneTransaction.Nonce)
+		decryptReceipt(t, flowRequest(t, "DELETE", base+"/device/remote/account", token, "", nil), phone, &deletion)
+
+		if deletion.Account != account || deletion.Device != "" {
+			t.Error("Deletion should name the account only.", deletion)
+		}
+
+		if _, err := flowRepository.ListDevices(context.Background(), key); !errors.Is(err, repository.ErrNotFound) {
+			t.Error("Account should be deleted.", err)
+		}
+	})
+}
+
+func TestEndToEndFlowWithMemoryStorage(t *testing.T) {
+	common.WithTestEnvironment(flowEnv, func() {
+		flowEnv.SetEndToEnd(true)
+		defer flowEnv.SetEndToEnd(false)
+
+		const account = "E2E12345"
+		base := "/tenant_space/" + account
+
+		key, _ := CreateTestJWK()
+		pub, _ := key.PublicKey()
+		selfSigned, _ := CreateSelfSignedToken(key, base, account)
+
+		var registration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register", selfSigned, common.NormalContentType, nil), key, &registration)
+
+		var transaction model.TransactionModel
+		token, _ := CreateToken(key, base, account, "", false)
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/remote/session", token, "", nil), key, &transaction)
+
+		headers := jwe.NewHeaders()
+		headers.Set("type", "PID")
+		headers.Set("exp", 1893456000)
+
+		var rawPub interface{}
+		pub.Raw(&rawPub)
+		credential, err := jwe.Encrypt([]byte("credential"), jwe.WithKey(jwa.ECDH_ES_A256KW, rawPub), jwe.WithContentEncryption(jwa.A256GCM), jwe.WithProtectedHeaders(headers))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _ = CreateToken(key, base, account, transaction.Nonce, true)
+		decryptReceipt(t, flowRequest(t, "PUT", base+"/credentials/1", token, common.EncryptedContentType, credential), key, &transaction)
+
+		accountKey := flowEnv.GetAccountKey(model.AuthModel{Account: account, TenantId: "tenant_space"})
+		stored, _ := flowRepository.LoadItem(context.Background(), accountKey, "1", false)
+		if stored != b64.RawStdEncoding.EncodeToString(credential) {
+			t.Error("JWE of the device should be stored as it is.")
+		}
+
+		index, _ := flowRepository.LoadMetadata(context.Background(), accountKey, false)
+		if index["1"].Expiry.Unix() != 1893456000 {
+			t.Error("Expiry should be read from the protected header.", index["1"])
+		}
+
+		if exists, _ := crypto.GetCryptoProvider().IsKeyExisting(types.CryptoIdentifier{KeyId: account}); exists {
+			t.Error("No content key should be created for the account.")
+		}
+
+		token, _ = CreateToken(key, base, account, transaction.Nonce, true)
+		recorder := flowRequest(t, "GET", base+"/credentials", token, common.EncryptedContentType, nil)
+		if recorder.Header().Get("Content-Type") != common.EncryptedContentType {
+			t.Error("Response should be encrypted for the device.", recorder.Header().Get("Content-Type"))
+		}
+
+		var result model.GetCredentialModel
+		decryptReceipt(t, recorder, key, &result)
+
+		if result.Credentials["1"] != string(credential) || result.Receipt == "" {
+			t.Fatal("Stored JWE was not returned.", result)
+		}
+
+		var rawKey interface{}
+		key.Raw(&rawKey)
+		plain, err := jwe.Decrypt([]byte(result.Receipt), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(plain, &transaction)
+
+		token, _ = CreateToken(key, base, account, transaction.Nonce, true)
+		var item model.GetCredentialItemModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/credentials/1", token, common.EncryptedContentType, nil), key, &item)
+
+		if item.Credential != string(credential) || item.Version != 1 {
+			t.Error("Stored item was not returned.", item)
+		}
+	})
+}
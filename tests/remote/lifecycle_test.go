@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/lifecycle"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/pkg/messaging"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+type eventRecorder struct {
+	events []event.Event
+}
+
+func (r *eventRecorder) PubCtx(ctx context.Context, e event.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *eventRecorder) types() []string {
+	types := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		types = append(types, e.Type())
+	}
+	return types
+}
+
+func TestCredentialLifecycleEvents(t *testing.T) {
+	recorder := new(eventRecorder)
+
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		directEnv.SetPublisher(lifecycle.NewPublisher(recorder, common.EventSource, []string{"tenant_space"}))
+		defer directEnv.SetPublisher(nil)
+
+		credential := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"]}`
+
+		if response := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/1", credential); response.Code != 200 {
+			t.Fatal("Here should be a 200", response.Body.String())
+		}
+
+		if response := directRequest(t, "DELETE", "/tenant_space/ABCD123/credentials/1", ""); response.Code != 200 {
+			t.Fatal("Here should be a 200", response.Body.String())
+		}
+
+		if response := directRequest(t, "PUT", "/other_space/ABCD123/credentials/1", credential); response.Code != 200 {
+			t.Fatal("Here should be a 200", response.Body.String())
+		}
+	})
+
+	types := recorder.types()
+
+	if len(types) != 2 || types[0] != messaging.CredentialStoredType || types[1] != messaging.CredentialDeletedType {
+		t.Fatal("Events are wrong.", types)
+	}
+
+	var stored messaging.StorageServiceLifecycleEvent
+	json.Unmarshal(recorder.events[0].Data(), &stored)
+
+	if stored.TenantId != "tenant_space" || stored.AccountId != "ABCD123" || stored.Id != "1" || stored.Type != messaging.StoreCredentialType {
+		t.Error("Event content is wrong.", stored)
+	}
+}
+
+func TestDeviceLifecycleEvents(t *testing.T) {
+	recorder := new(eventRecorder)
+
+	common.WithTestEnvironment(flowEnv, func() {
+		flowEnv.SetPublisher(lifecycle.NewPublisher(recorder, common.EventSource, nil))
+		defer flowEnv.SetPublisher(nil)
+
+		const account = "EVENT123"
+		base := "/tenant_space/" + account
+
+		key, _ := CreateTestJWK()
+		selfSigned, _ := CreateSelfSignedToken(key, base, account)
+
+		var registration model.RegistrationModel
+		decryptReceipt(t, flowRequest(t, "GET", base+"/device/registration/register", selfSigned, common.NormalContentType, nil), key, &registration)
+
+		accountKey := flowEnv.GetAccountKey(model.AuthModel{Account: account, TenantId: "tenant_space"})
+		flowRepository.SetLocked(accountKey, true)
+
+		// tokens of other keys naming the locked account are refused before the lock is announced
+		forgedPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		forgedKey, _ := jwk.FromRaw(forgedPriv)
+		for i := 0; i < 3; i++ {
+			forged, _ := CreateToken(forgedKey, base, account, "", false)
+			if response := flowRequest(t, "GET", base+"/device/remote/session", forged, "", nil); response.Code != 403 || strings.Contains(response.Body.String(), "locked") {
+				t.Fatal("Forged token should be invalid", response.Code, response.Body.String())
+			}
+		}
+
+		// the retries of a locked account are refused without a further event
+		for i := 0; i < 3; i++ {
+			token, _ := CreateToken(key, base, account, "", false)
+			if response := flowRequest(t, "GET", base+"/device/remote/session", token, "", nil); response.Code != 403 || !strings.Contains(response.Body.String(), "locked") {
+				t.Fatal("Here should be a 403", response.Code, response.Body.String())
+			}
+		}
+
+		flowRepository.SetLocked(accountKey, false)
+		token, _ := CreateToken(key, base, account, "", false)
+		flowRequest(t, "GET", base+"/device/remote/session", token, "", nil)
+
+		flowRepository.SetLocked(accountKey, true)
+		token, _ = CreateToken(key, base, account, "", false)
+		flowRequest(t, "GET", base+"/device/remote/session", token, "", nil)
+	})
+
+	types := recorder.types()
+
+	if len(types) != 3 || types[0] != messaging.DeviceRegisteredType || types[1] != messaging.AccountLockedType ||
+		types[2] != messaging.AccountLockedType {
+		t.Error("Events are wrong.", types)
+	}
+}
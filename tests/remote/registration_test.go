@@ -2,6 +2,7 @@ package tests
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -14,6 +15,9 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
 var registrationEngine *gin.Engine
@@ -109,3 +113,91 @@ func TestGetSession(t *testing.T) {
 		t.Error("Here should be a 200")
 	}
 }
+
+func TestDeleteDevice(t *testing.T) {
+	mockDb := &SessionMock{}
+	mockQ := &QueryMock{}
+	mockDb.
+		On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(mockQ)
+	registrationEnv.SetSession(mockDb)
+
+	key, _ := CreateTestJWK()
+	pub, _ := key.PublicKey()
+
+	token, err := jwt.NewBuilder().Subject("ABCD123").Claim("nonce", "5555").Build()
+	if err != nil {
+		t.Error(err)
+	}
+
+	authModel := model.AuthModel{
+		Account:    "ABCD123",
+		TenantId:   "tenant_space",
+		Device_Key: &pub,
+		Nonce:      "5555",
+		Token:      &token,
+	}
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/tenant_space/ABCD123/test2/delete", nil)
+	if err != nil {
+		t.Error()
+	}
+	request = request.WithContext(context.WithValue(request.Context(), model.AuthModelKey, authModel))
+
+	registrationEngine.ServeHTTP(recorder, request)
+
+	if recorder.Result().StatusCode != 200 {
+		t.Fatal("Here should be a 200")
+	}
+
+	var rawKey interface{}
+	key.Raw(&rawKey)
+
+	plain, err := jwe.Decrypt(recorder.Body.Bytes(), jwe.WithKey(jwa.ECDH_ES_A256KW, rawKey))
+	if err != nil {
+		t.Fatal("Message cant be decoded")
+	}
+
+	var deletion model.DeletionModel
+	err = json.Unmarshal(plain, &deletion)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deletion.Account != "ABCD123" || deletion.Deleted == 0 {
+		t.Error("Receipt content is wrong.")
+	}
+}
+
+func TestDeleteDeviceWithWrongNonce(t *testing.T) {
+	mockDb := &SessionMock{}
+	mockQ := &QueryMock{}
+	mockDb.
+		On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(mockQ)
+	registrationEnv.SetSession(mockDb)
+
+	key, _ := CreateTestJWK()
+	pub, _ := key.PublicKey()
+
+	token, _ := jwt.NewBuilder().Subject("ABCD123").Claim("nonce", "1234").Build()
+
+	authModel := model.AuthModel{
+		Account:    "ABCD123",
+		TenantId:   "tenant_space",
+		Device_Key: &pub,
+		Nonce:      "5555",
+		Token:      &token,
+	}
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("DELETE", "/tenant_space/ABCD123/test2/delete", nil)
+	request = request.WithContext(context.WithValue(request.Context(), model.AuthModelKey, authModel))
+
+	registrationEngine.ServeHTTP(recorder, request)
+
+	if recorder.Result().StatusCode != 400 {
+		t.Error("Here should be a 400")
+	}
+}
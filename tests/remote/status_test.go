@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	b64 "encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/status"
+)
+
+func statusCredential(index string) string {
+	return `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential"],"credentialStatus":` +
+		`{"type":"StatusList2021Entry","statusPurpose":"revocation","statusListIndex":"` + index + `","statusListCredential":"https://issuer.example.com/status/1"}}`
+}
+
+func TestCredentialStatus(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte{0x80})
+	writer.Close()
+
+	list := `{"@context":["https://www.w3.org/2018/credentials/v1"],"type":["VerifiableCredential","StatusList2021Credential"],` +
+		`"credentialSubject":{"type":"StatusList2021","statusPurpose":"revocation","encodedList":"` + b64.RawURLEncoding.EncodeToString(buffer.Bytes()) + `"}}`
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1"), []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+		directEnv.SetStatusChecker(status.NewChecker(status.NewFileFetcher(dir), time.Minute))
+		defer directEnv.SetStatusChecker(nil)
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/revoked", statusCredential("0")); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/valid", statusCredential("1")); recorder.Code != 200 {
+			t.Fatal("Here should be a 200", recorder.Body.String())
+		}
+
+		var result model.GetCredentialModel
+		recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials", "")
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if result.Status["revoked"] != status.Revoked || result.Status["valid"] != status.Valid {
+			t.Error("Status is wrong.", recorder.Body.String())
+		}
+
+		result = model.GetCredentialModel{}
+		recorder = directRequest(t, "POST", "/tenant_space/ABCD123/credentials", "")
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+
+		if result.Status["revoked"] != status.Revoked {
+			t.Error("Status of filtered credentials is wrong.", recorder.Body.String())
+		}
+
+		var item model.GetCredentialItemModel
+		recorder = directRequest(t, "GET", "/tenant_space/ABCD123/credentials/revoked", "")
+		json.Unmarshal(recorder.Body.Bytes(), &item)
+
+		if item.Status != status.Revoked {
+			t.Error("Status of item is wrong.", recorder.Body.String())
+		}
+	})
+}
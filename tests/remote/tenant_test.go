@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eclipse-xfsc/credential-storage-service/internal/api"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/common"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/middleware"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/model"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/repository"
+	"github.com/eclipse-xfsc/credential-storage-service/internal/tenancy"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTenantAdministration(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		repo := repository.NewMemoryRepository()
+		directEnv.SetRepository(repo)
+
+		engine := gin.Default()
+		group := engine.Group("/admin/tenants")
+		group.Use(middleware.AdminAuth("secret"))
+		api.AddTenantRoutes(group, directEnv, repository.Replication{Class: repository.SimpleStrategy, Factor: 3})
+
+		request := func(method string, url string, body string, token string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			request, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+			request.Header.Add("Authorization", "Bearer "+token)
+			engine.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		if recorder := request("GET", "/admin/tenants", "", "wrong"); recorder.Code != 401 {
+			t.Error("Wrong token should be rejected", recorder.Code)
+		}
+
+		recorder := request("POST", "/admin/tenants", `{"name":"acme","metadata":{"owner":"ops"}}`, "secret")
+
+		var tenant model.TenantModel
+		json.Unmarshal(recorder.Body.Bytes(), &tenant)
+
+		if recorder.Code != 201 || tenant.Replication == nil || tenant.Replication.Factor != 3 || tenant.Created == nil || tenant.Metadata["owner"] != "ops" {
+			t.Fatal("Tenant should be created with default replication", recorder.Code, recorder.Body.String())
+		}
+
+		recorder = request("POST", "/admin/tenants", `{"name":"beta","replication":{"class":"NetworkTopologyStrategy","dataCenters":{"dc1":3,"dc2":2}}}`, "secret")
+
+		if recorder.Code != 201 {
+			t.Error("Tenant with data centers should be created", recorder.Code, recorder.Body.String())
+		}
+
+		if recorder := request("POST", "/admin/tenants", `{"name":"acme"}`, "secret"); recorder.Code != 409 {
+			t.Error("Existing tenant should conflict", recorder.Code)
+		}
+
+		for _, body := range []string{`{"name":"acme; DROP KEYSPACE x"}`, `{"name":"gamma","replication":{"class":"NetworkTopologyStrategy"}}`, `{"name":"gamma","replication":{"class":"LocalStrategy","factor":1}}`} {
+			if recorder := request("POST", "/admin/tenants", body, "secret"); recorder.Code != 400 {
+				t.Error("Invalid tenant should be rejected", body, recorder.Code)
+			}
+		}
+
+		var tenants []model.TenantModel
+		recorder = request("GET", "/admin/tenants", "", "secret")
+		json.Unmarshal(recorder.Body.Bytes(), &tenants)
+
+		if recorder.Code != 200 || len(tenants) != 2 || tenants[0].Name != "acme" || tenants[1].Replication.DataCenters["dc2"] != 2 {
+			t.Error("Tenants are listed wrong", recorder.Body.String())
+		}
+
+		key := directEnv.GetAccountKey(model.AuthModel{Account: "ABCD123", TenantId: "acme"})
+		repo.StoreItem(context.Background(), key, "one", "content", repository.ItemMetadata{}, false)
+
+		if recorder := request("DELETE", "/admin/tenants/acme", "", "secret"); recorder.Code != 204 {
+			t.Error("Tenant should be deleted", recorder.Code)
+		}
+
+		if items, _ := repo.LoadItems(context.Background(), key, false); len(items) != 0 {
+			t.Error("Items of the tenant should be deleted", items)
+		}
+
+		if recorder := request("GET", "/admin/tenants/acme", "", "secret"); recorder.Code != 404 {
+			t.Error("Deleted tenant should not be found", recorder.Code)
+		}
+
+		if recorder := request("DELETE", "/admin/tenants/acme", "", "secret"); recorder.Code != 404 {
+			t.Error("Unknown tenant should not be found", recorder.Code)
+		}
+	})
+}
+
+func TestTenantAllowList(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		repo := repository.NewMemoryRepository()
+		directEnv.SetRepository(repo)
+
+		resolver, err := tenancy.NewResolver(map[string]string{"customer": "tenant_space"}, true, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		directEnv.SetTenantResolver(resolver)
+		defer directEnv.SetTenantResolver(nil)
+
+		engine := gin.Default()
+		group := engine.Group("/tenants/:tenantId/storage/:account")
+		group.Use(middleware.Tenant(directEnv))
+		credentialGroup := group.Group("/credentials")
+		credentialGroup.Use(middleware.AuthModel(common.NormalContentType))
+		api.AddCredentialRoutes(credentialGroup, directEnv, common.NormalContentType)
+
+		request := func(method string, url string, body string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			request, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+			request.Header.Add("Content-Type", common.NormalContentType)
+			engine.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		for _, tenant := range []string{"system_schema", "acme", "tenant_space", "x'%20OR%201=1"} {
+			if recorder := request("GET", "/tenants/"+tenant+"/storage/ABCD123/credentials", ""); recorder.Code != 403 {
+				t.Error("Unknown tenant should be rejected", tenant, recorder.Code)
+			}
+		}
+
+		if recorder := request("PUT", "/tenants/customer/storage/ABCD123/credentials/mapped", validCredential); recorder.Code != 200 {
+			t.Fatal("Configured tenant should be allowed", recorder.Code, recorder.Body.String())
+		}
+
+		if recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials/mapped", ""); recorder.Code != 200 {
+			t.Error("Credential should be stored in the keyspace of the tenant", recorder.Code)
+		}
+
+		if err := repo.CreateTenant(context.Background(), repository.Tenant{Name: "acme", Replication: repository.Replication{Class: repository.SimpleStrategy, Factor: 1}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if recorder := request("GET", "/tenants/acme/storage/ABCD123/credentials", ""); recorder.Code != 403 {
+			t.Error("Unknown tenant should be cached", recorder.Code)
+		}
+
+		resolver.Forget("acme")
+
+		if recorder := request("GET", "/tenants/acme/storage/ABCD123/credentials", ""); recorder.Code != 200 {
+			t.Error("Provisioned tenant should be allowed", recorder.Code, recorder.Body.String())
+		}
+	})
+}
+
+func TestTenantSettings(t *testing.T) {
+	common.WithTestEnvironment(directEnv, func() {
+		directEnv.SetRepository(repository.NewMemoryRepository())
+
+		path := filepath.Join(t.TempDir(), "tenants.yaml")
+		os.WriteFile(path, []byte("tenants:\n  tenant_space:\n    region: EU\n    country: DE\n    cryptoNamespace: tenant\n  remote_only:\n    modes: [REMOTE]\n"), 0600)
+
+		overrides, err := tenancy.LoadOverrides(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		directEnv.SetTenantOverrides(overrides)
+		defer directEnv.SetTenantOverrides(nil)
+
+		key := directEnv.GetAccountKey(model.AuthModel{TenantId: "tenant_space", Account: "ABCD123"})
+
+		if key.Region != "EU" || key.Country != "DE" || directEnv.GetCryptoNamespace("tenant_space") != "tenant" || directEnv.GetCryptoNamespace("other") != directEnv.GetCryptoNamespace("") {
+			t.Error("Settings of the tenant should override the global ones", key)
+		}
+
+		if recorder := directRequest(t, "PUT", "/tenant_space/ABCD123/credentials/regional", validCredential); recorder.Code != 200 {
+			t.Fatal("Credential should be stored", recorder.Code, recorder.Body.String())
+		}
+
+		os.WriteFile(path, []byte("tenants: {}\n"), 0600)
+
+		if changed, err := overrides.Reload(); !changed || err != nil {
+			t.Fatal("Settings should be reloaded", err)
+		}
+
+		if recorder := directRequest(t, "GET", "/tenant_space/ABCD123/credentials/regional", ""); recorder.Code != 404 {
+			t.Error("Credential should be stored in the region of the tenant", recorder.Code)
+		}
+
+		os.WriteFile(path, []byte("tenants:\n  remote_only:\n    modes: [REMOTE]\n"), 0600)
+		overrides.Reload()
+
+		engine := gin.Default()
+		group := engine.Group("/tenants/:tenantId/storage/:account")
+		group.Use(middleware.TenantMode(directEnv, tenancy.DirectMode))
+		group.GET("/credentials", func(c *gin.Context) { c.Status(200) })
+
+		for tenant, code := range map[string]int{"remote_only": 403, "tenant_space": 200} {
+			recorder := httptest.NewRecorder()
+			request, _ := http.NewRequest("GET", "/tenants/"+tenant+"/storage/ABCD123/credentials", nil)
+			engine.ServeHTTP(recorder, request)
+
+			if recorder.Code != code {
+				t.Error("Mode of the tenant is not enforced", tenant, recorder.Code)
+			}
+		}
+	})
+}